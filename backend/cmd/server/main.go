@@ -12,8 +12,13 @@ import (
 
 	"filmfolk/internal/config"
 	"filmfolk/internal/db"
+	"filmfolk/internal/mailer"
 	"filmfolk/internal/middleware"
+	"filmfolk/internal/oauth"
+	"filmfolk/internal/passwordpolicy"
+	"filmfolk/internal/revocation"
 	"filmfolk/internal/routes"
+	"filmfolk/internal/services"
 	"filmfolk/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -35,9 +40,60 @@ func main() {
 	logger := utils.GetLogger()
 	logger.Info().Msg("Logger initialized successfully")
 
-	// 3. Initialize JWT utilities
-	logger.Info().Msg("Initializing JWT...")
-	utils.InitJWT(cfg.Jwt.Secret)
+	// 3. Initialize JWT utilities, token revocation, mailer, OAuth providers and password handling
+	logger.Info().Str("algorithm", cfg.Jwt.Algorithm).Msg("Initializing JWT...")
+	// Retired keys must outlive the refresh tokens they signed unless told otherwise
+	keyGracePeriod := cfg.Jwt.KeyGracePeriod
+	if keyGracePeriod == 0 {
+		keyGracePeriod = cfg.Jwt.RefreshTokenTTL
+	}
+	// Access tokens signed with the secret before the switch to EdDSA/RS256 expire within one TTL
+	legacyUntil := time.Now().Add(time.Duration(cfg.Jwt.AccessTokenTTL) * time.Minute)
+	if cfg.Jwt.LegacyUntil != "" {
+		legacyUntil, _ = time.Parse(time.RFC3339, cfg.Jwt.LegacyUntil) // checked by config validation
+	}
+	err = utils.InitJWT(utils.KeyRingOptions{
+		Algorithm:        cfg.Jwt.Algorithm,
+		Dir:              cfg.Jwt.KeysDir,
+		RotationInterval: time.Duration(cfg.Jwt.KeyRotationInterval) * 24 * time.Hour,
+		GracePeriod:      time.Duration(keyGracePeriod) * 24 * time.Hour,
+		LegacySecret:     cfg.Jwt.Secret,
+		LegacyUntil:      legacyUntil,
+	})
+	if err != nil {
+		logger.Fatal().Err(err).Msg("JWT initialization failed")
+	}
+
+	// Reload shared keys and rotate on schedule until shutdown
+	keyRotationCtx, stopKeyRotation := context.WithCancel(context.Background())
+	defer stopKeyRotation()
+	go utils.GetKeyRing().Run(keyRotationCtx)
+
+	revocation.Init(revocation.NewMemoryStore(), time.Duration(cfg.Jwt.AccessTokenTTL)*time.Minute)
+
+	logger.Info().Str("driver", cfg.Mail.Driver).Msg("Initializing mailer...")
+	if err := mailer.InitMailer(cfg); err != nil {
+		logger.Fatal().Err(err).Msg("Mailer initialization failed")
+	}
+
+	oauth.InitProviders(cfg)
+	logger.Info().Strs("providers", oauth.Names()).Msg("OAuth providers registered")
+
+	if err := passwordpolicy.InitPolicy(cfg); err != nil {
+		logger.Fatal().Err(err).Msg("Password policy initialization failed")
+	}
+
+	err = utils.InitPasswordHashing(utils.PasswordHashOptions{
+		Algorithm:         cfg.Auth.PasswordHash,
+		BcryptCost:        cfg.Auth.BcryptCost,
+		Argon2Memory:      uint32(cfg.Auth.Argon2Memory),
+		Argon2Iterations:  uint32(cfg.Auth.Argon2Iterations),
+		Argon2Parallelism: uint8(cfg.Auth.Argon2Parallelism),
+	})
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Password hashing initialization failed")
+	}
+	logger.Info().Str("algorithm", cfg.Auth.PasswordHash).Msg("Password hashing configured")
 
 	// 4. Connect to database
 	logger.Info().Msg("Connecting to database...")
@@ -46,6 +102,20 @@ func main() {
 	}
 	defer db.CloseDB()
 
+	// Background jobs run until shutdown
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	// Delete guest accounts that were abandoned
+	go services.NewGuestService(cfg).RunPurge(jobsCtx)
+
+	// Build requested data exports and delete accounts whose grace period is over
+	go services.NewDataExportService(cfg).Run(jobsCtx)
+	go services.NewAccountService(cfg).RunDeletions(jobsCtx)
+
+	// Lift suspensions that have run out
+	go services.NewSanctionService().RunExpiry(jobsCtx)
+
 	// 5. Auto-migrations disabled. Use the new migrate tool.
 	// if cfg.App.Env == "development" {
 	// 	logger.Info().Msg("Running auto-migrations...")
@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
@@ -17,6 +19,7 @@ type Config struct {
 		Port           int      `mapstructure:"port" validate:"required,min=1,max=65535"`
 		Env            string   `mapstructure:"env" validate:"required"` // development, production
 		AllowedOrigins []string `mapstructure:"allowed_origins"`         // CORS allowed origins
+		FrontendURL    string   `mapstructure:"frontend_url"`            // Base URL for links in emails
 	} `mapstructure:"app"`
 	Db struct {
 		Host     string `mapstructure:"host" validate:"required"`
@@ -27,15 +30,75 @@ type Config struct {
 		SSLMode  string `mapstructure:"sslmode" validate:"required"`
 	} `mapstructure:"db"`
 	Jwt struct {
-		Secret          string `mapstructure:"secret" validate:"required,min=16"`
-		AccessTokenTTL  int    `mapstructure:"access_token_ttl" validate:"required"`  // minutes
-		RefreshTokenTTL int    `mapstructure:"refresh_token_ttl" validate:"required"` // days
+		Secret              string `mapstructure:"secret"`                                // HS256 key; with RS256/EdDSA only verifies legacy tokens
+		AccessTokenTTL      int    `mapstructure:"access_token_ttl" validate:"required"`  // minutes
+		RefreshTokenTTL     int    `mapstructure:"refresh_token_ttl" validate:"required"` // days
+		Algorithm           string `mapstructure:"algorithm"`                             // EdDSA, RS256, HS256
+		KeysDir             string `mapstructure:"keys_dir"`                              // signing keys (PEM), shared between instances
+		KeyRotationInterval int    `mapstructure:"key_rotation_interval"`                 // days, 0 disables scheduled rotation
+		KeyGracePeriod      int    `mapstructure:"key_grace_period"`                      // days a retired key still verifies, 0 = refresh token TTL
+		LegacyUntil         string `mapstructure:"legacy_until"`                          // RFC 3339; kid-less HS256 tokens rejected after, empty = access token TTL after startup
 	} `mapstructure:"jwt"`
+	Auth struct {
+		UnverifiedAccess     string `mapstructure:"unverified_access"`      // full, read_only, none
+		VerificationTokenTTL int    `mapstructure:"verification_token_ttl"` // hours
+		PasswordResetTTL     int    `mapstructure:"password_reset_ttl"`     // minutes
+		LockoutThreshold     int    `mapstructure:"lockout_threshold"`      // failed logins before lockout, 0 disables
+		LockoutDuration      int    `mapstructure:"lockout_duration"`       // minutes
+		LoginDelayBase       int    `mapstructure:"login_delay_base"`       // seconds, doubles per failure, 0 disables
+		LoginDelayMax        int    `mapstructure:"login_delay_max"`        // seconds
+		GuestRetention       int    `mapstructure:"guest_retention"`        // days an unused guest account is kept, 0 disables purging
+		PasswordMinLength    int    `mapstructure:"password_min_length"`    // characters
+		PasswordBreachPath   string `mapstructure:"password_breach_path"`   // Pwned Passwords SHA-1 data (range dir or sorted file), optional
+		PasswordHash         string `mapstructure:"password_hash"`          // argon2id, bcrypt - existing hashes are upgraded on login
+		BcryptCost           int    `mapstructure:"bcrypt_cost"`
+		Argon2Memory         int    `mapstructure:"argon2_memory"` // KiB
+		Argon2Iterations     int    `mapstructure:"argon2_iterations"`
+		Argon2Parallelism    int    `mapstructure:"argon2_parallelism"`
+		CookieMode           bool   `mapstructure:"cookie_mode"`       // let browsers keep the refresh token in an httpOnly cookie
+		CookieDomain         string `mapstructure:"cookie_domain"`     // empty = API host only
+		CookieSecure         bool   `mapstructure:"cookie_secure"`     // HTTPS only
+		CookieSameSite       string `mapstructure:"cookie_same_site"`  // strict, lax, none
+		MagicLinkTTL         int    `mapstructure:"magic_link_ttl"`    // minutes an emailed sign-in link is valid
+		MagicLinkSignup      bool   `mapstructure:"magic_link_signup"` // create an account when a link is used for an unknown email
+		NewDeviceAlerts      bool   `mapstructure:"new_device_alerts"` // mail the owner when someone signs in from a new device
+	} `mapstructure:"auth"`
+	Account struct {
+		DeletionGracePeriod int    `mapstructure:"deletion_grace_period"` // days between the request and the deletion
+		DeletionMode        string `mapstructure:"deletion_mode"`         // anonymize, hard_delete
+		DeletedContent      string `mapstructure:"deleted_content"`       // reattribute, remove - reviews and comments
+		ExportDir           string `mapstructure:"export_dir"`            // where data export archives are built
+		ExportTTL           int    `mapstructure:"export_ttl"`            // hours a finished export can be downloaded
+	} `mapstructure:"account"`
+	Mail struct {
+		Driver       string `mapstructure:"driver"` // smtp, outbox
+		From         string `mapstructure:"from"`
+		SMTPHost     string `mapstructure:"smtp_host"`
+		SMTPPort     int    `mapstructure:"smtp_port"`
+		SMTPUsername string `mapstructure:"smtp_username"`
+		SMTPPassword string `mapstructure:"smtp_password"`
+		OutboxDir    string `mapstructure:"outbox_dir"` // outbox driver: also write messages to files here
+	} `mapstructure:"mail"`
 	OAuth struct {
 		GoogleClientID     string `mapstructure:"google_client_id"`
 		GoogleClientSecret string `mapstructure:"google_client_secret"`
 		GoogleRedirectURL  string `mapstructure:"google_redirect_url"`
+		// Frontend page Google returns to when linking to a signed-in account
+		GoogleLinkRedirectURL string `mapstructure:"google_link_redirect_url"`
+
+		FacebookClientID        string `mapstructure:"facebook_client_id"`
+		FacebookClientSecret    string `mapstructure:"facebook_client_secret"`
+		FacebookRedirectURL     string `mapstructure:"facebook_redirect_url"`
+		FacebookLinkRedirectURL string `mapstructure:"facebook_link_redirect_url"`
+
+		// Extra OpenID Connect providers, listed in OAUTH_PROVIDERS
+		Providers []OIDCProviderConfig `mapstructure:"-"`
 	} `mapstructure:"oauth"`
+	WebAuthn struct {
+		RPID      string   `mapstructure:"rp_id"`      // domain passkeys are bound to (default: FRONTEND_URL host)
+		RPName    string   `mapstructure:"rp_name"`    // shown by the authenticator (default: APP_NAME)
+		RPOrigins []string `mapstructure:"rp_origins"` // origins allowed to use passkeys (default: FRONTEND_URL)
+	} `mapstructure:"webauthn"`
 	TMDB struct {
 		APIKey string `mapstructure:"api_key"` // For movie data
 	} `mapstructure:"tmdb"`
@@ -44,6 +107,26 @@ type Config struct {
 	} `mapstructure:"ai"`
 }
 
+// OIDCProviderConfig configures an OpenID Connect login provider
+// Read from OAUTH_<NAME>_* variables for every name in OAUTH_PROVIDERS
+type OIDCProviderConfig struct {
+	Name            string   // route name: /auth/<name>
+	Issuer          string   // OAUTH_<NAME>_ISSUER, discovery document is read from here
+	ClientID        string   // OAUTH_<NAME>_CLIENT_ID
+	ClientSecret    string   // OAUTH_<NAME>_CLIENT_SECRET
+	RedirectURL     string   // OAUTH_<NAME>_REDIRECT_URL, our /auth/<name>/callback
+	LinkRedirectURL string   // OAUTH_<NAME>_LINK_REDIRECT_URL, frontend link page
+	Scopes          []string // OAUTH_<NAME>_SCOPES, comma separated (default: openid,email,profile)
+}
+
+// reservedProviderNames are /auth routes a provider name would collide with
+var reservedProviderNames = map[string]bool{
+	"register": true, "login": true, "refresh": true, "logout": true, "me": true,
+	"sessions": true, "identities": true, "link": true, "2fa": true, "unlock": true,
+	"verify-email": true, "resend-verification": true, "forgot-password": true, "reset-password": true,
+	"google": true, "facebook": true, "providers": true, "webauthn": true, "magic-link": true, "devices": true, "email-change": true,
+}
+
 func LoadConfig() (*Config, error) {
 
 	envConfig, err := loadEnvConfig()
@@ -69,6 +152,7 @@ func loadEnvConfig() (*Config, error) {
 	v.BindEnv("app.port", "APP_PORT")
 	v.BindEnv("app.env", "APP_ENV")
 	v.BindEnv("app.allowed_origins", "ALLOWED_ORIGINS")
+	v.BindEnv("app.frontend_url", "FRONTEND_URL")
 	v.BindEnv("db.host", "DB_HOST")
 	v.BindEnv("db.port", "DB_PORT")
 	v.BindEnv("db.user", "DB_USER")
@@ -78,15 +162,96 @@ func loadEnvConfig() (*Config, error) {
 	v.BindEnv("jwt.secret", "JWT_SECRET_KEY")
 	v.BindEnv("jwt.access_token_ttl", "JWT_ACCESS_TOKEN_TTL")
 	v.BindEnv("jwt.refresh_token_ttl", "JWT_REFRESH_TOKEN_TTL")
+	v.BindEnv("jwt.algorithm", "JWT_ALGORITHM")
+	v.BindEnv("jwt.keys_dir", "JWT_KEYS_DIR")
+	v.BindEnv("jwt.key_rotation_interval", "JWT_KEY_ROTATION_INTERVAL")
+	v.BindEnv("jwt.key_grace_period", "JWT_KEY_GRACE_PERIOD")
+	v.BindEnv("jwt.legacy_until", "JWT_LEGACY_UNTIL")
+	v.BindEnv("auth.unverified_access", "AUTH_UNVERIFIED_ACCESS")
+	v.BindEnv("auth.verification_token_ttl", "AUTH_VERIFICATION_TOKEN_TTL")
+	v.BindEnv("auth.password_reset_ttl", "AUTH_PASSWORD_RESET_TTL")
+	v.BindEnv("auth.lockout_threshold", "AUTH_LOCKOUT_THRESHOLD")
+	v.BindEnv("auth.lockout_duration", "AUTH_LOCKOUT_DURATION")
+	v.BindEnv("auth.login_delay_base", "AUTH_LOGIN_DELAY_BASE")
+	v.BindEnv("auth.login_delay_max", "AUTH_LOGIN_DELAY_MAX")
+	v.BindEnv("auth.guest_retention", "AUTH_GUEST_RETENTION")
+	v.BindEnv("auth.password_min_length", "AUTH_PASSWORD_MIN_LENGTH")
+	v.BindEnv("auth.password_breach_path", "AUTH_PASSWORD_BREACH_PATH")
+	v.BindEnv("auth.password_hash", "AUTH_PASSWORD_HASH")
+	v.BindEnv("auth.bcrypt_cost", "AUTH_BCRYPT_COST")
+	v.BindEnv("auth.argon2_memory", "AUTH_ARGON2_MEMORY")
+	v.BindEnv("auth.argon2_iterations", "AUTH_ARGON2_ITERATIONS")
+	v.BindEnv("auth.argon2_parallelism", "AUTH_ARGON2_PARALLELISM")
+	v.BindEnv("auth.cookie_mode", "AUTH_COOKIE_MODE")
+	v.BindEnv("auth.cookie_domain", "AUTH_COOKIE_DOMAIN")
+	v.BindEnv("auth.cookie_secure", "AUTH_COOKIE_SECURE")
+	v.BindEnv("auth.cookie_same_site", "AUTH_COOKIE_SAME_SITE")
+	v.BindEnv("auth.magic_link_ttl", "AUTH_MAGIC_LINK_TTL")
+	v.BindEnv("auth.magic_link_signup", "AUTH_MAGIC_LINK_SIGNUP")
+	v.BindEnv("auth.new_device_alerts", "AUTH_NEW_DEVICE_ALERTS")
+	v.BindEnv("account.deletion_grace_period", "ACCOUNT_DELETION_GRACE_PERIOD")
+	v.BindEnv("account.deletion_mode", "ACCOUNT_DELETION_MODE")
+	v.BindEnv("account.deleted_content", "ACCOUNT_DELETED_CONTENT")
+	v.BindEnv("account.export_dir", "ACCOUNT_EXPORT_DIR")
+	v.BindEnv("account.export_ttl", "ACCOUNT_EXPORT_TTL")
+	v.BindEnv("mail.driver", "MAIL_DRIVER")
+	v.BindEnv("mail.from", "MAIL_FROM")
+	v.BindEnv("mail.smtp_host", "SMTP_HOST")
+	v.BindEnv("mail.smtp_port", "SMTP_PORT")
+	v.BindEnv("mail.smtp_username", "SMTP_USERNAME")
+	v.BindEnv("mail.smtp_password", "SMTP_PASSWORD")
+	v.BindEnv("mail.outbox_dir", "MAIL_OUTBOX_DIR")
 	v.BindEnv("oauth.google_client_id", "GOOGLE_CLIENT_ID")
 	v.BindEnv("oauth.google_client_secret", "GOOGLE_CLIENT_SECRET")
 	v.BindEnv("oauth.google_redirect_url", "GOOGLE_REDIRECT_URL")
+	v.BindEnv("oauth.google_link_redirect_url", "GOOGLE_LINK_REDIRECT_URL")
 	v.BindEnv("oauth.facebook_client_id", "FACEBOOK_CLIENT_ID")
 	v.BindEnv("oauth.facebook_client_secret", "FACEBOOK_CLIENT_SECRET")
 	v.BindEnv("oauth.facebook_redirect_url", "FACEBOOK_REDIRECT_URL")
+	v.BindEnv("oauth.facebook_link_redirect_url", "FACEBOOK_LINK_REDIRECT_URL")
+	v.BindEnv("oauth.providers", "OAUTH_PROVIDERS")
+	v.BindEnv("webauthn.rp_id", "WEBAUTHN_RP_ID")
+	v.BindEnv("webauthn.rp_name", "WEBAUTHN_RP_NAME")
+	v.BindEnv("webauthn.rp_origins", "WEBAUTHN_RP_ORIGINS")
 	v.BindEnv("tmdb.api_key", "TMDB_API_KEY")
 	v.BindEnv("ai.openai_key", "OPENAI_API_KEY")
 
+	// Optional settings
+	v.SetDefault("app.frontend_url", "http://localhost:3000")
+	v.SetDefault("oauth.google_link_redirect_url", "http://localhost:3000/settings/link/google")
+	v.SetDefault("oauth.facebook_link_redirect_url", "http://localhost:3000/settings/link/facebook")
+	v.SetDefault("jwt.algorithm", "EdDSA")
+	v.SetDefault("jwt.keys_dir", "keys")
+	v.SetDefault("jwt.key_rotation_interval", 30)
+	v.SetDefault("auth.unverified_access", "read_only")
+	v.SetDefault("auth.verification_token_ttl", 48)
+	v.SetDefault("auth.password_reset_ttl", 30)
+	v.SetDefault("auth.lockout_threshold", 5)
+	v.SetDefault("auth.lockout_duration", 15)
+	v.SetDefault("auth.login_delay_base", 1)
+	v.SetDefault("auth.login_delay_max", 30)
+	v.SetDefault("auth.guest_retention", 30)
+	v.SetDefault("auth.password_min_length", 8)
+	v.SetDefault("auth.password_hash", "argon2id")
+	v.SetDefault("auth.bcrypt_cost", 12)
+	v.SetDefault("auth.argon2_memory", 64*1024)
+	v.SetDefault("auth.argon2_iterations", 3)
+	v.SetDefault("auth.argon2_parallelism", 4)
+	v.SetDefault("auth.cookie_mode", false)
+	v.SetDefault("auth.cookie_secure", true)
+	v.SetDefault("auth.cookie_same_site", "strict")
+	v.SetDefault("auth.magic_link_ttl", 15)
+	v.SetDefault("auth.magic_link_signup", true)
+	v.SetDefault("auth.new_device_alerts", true)
+	v.SetDefault("account.deletion_grace_period", 14)
+	v.SetDefault("account.deletion_mode", "anonymize")
+	v.SetDefault("account.deleted_content", "reattribute")
+	v.SetDefault("account.export_dir", "./tmp/exports")
+	v.SetDefault("account.export_ttl", 48)
+	v.SetDefault("mail.driver", "outbox")
+	v.SetDefault("mail.from", "FilmFolk <no-reply@filmfolk.local>")
+	v.SetDefault("mail.smtp_port", 587)
+
 	v.AutomaticEnv()
 
 	var cfg Config
@@ -94,9 +259,70 @@ func loadEnvConfig() (*Config, error) {
 		return nil, fmt.Errorf("error unmarshaling env config: %w", err)
 	}
 
+	cfg.OAuth.Providers = loadOIDCProviders(v, cfg.App.FrontendURL)
+	setWebAuthnDefaults(&cfg)
+
 	return &cfg, nil
 }
 
+// loadOIDCProviders reads the OAUTH_<NAME>_* settings of every provider in OAUTH_PROVIDERS
+func loadOIDCProviders(v *viper.Viper, frontendURL string) []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+
+	for _, name := range strings.Split(v.GetString("oauth.providers"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OAUTH_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		key := "oauth_provider." + name + "."
+		for _, field := range []string{"issuer", "client_id", "client_secret", "redirect_url", "link_redirect_url", "scopes"} {
+			v.BindEnv(key+field, prefix+strings.ToUpper(field))
+		}
+		v.SetDefault(key+"link_redirect_url", strings.TrimRight(frontendURL, "/")+"/settings/link/"+name)
+		v.SetDefault(key+"scopes", "openid,email,profile")
+
+		var scopes []string
+		for _, scope := range strings.Split(v.GetString(key+"scopes"), ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+
+		providers = append(providers, OIDCProviderConfig{
+			Name:            name,
+			Issuer:          v.GetString(key + "issuer"),
+			ClientID:        v.GetString(key + "client_id"),
+			ClientSecret:    v.GetString(key + "client_secret"),
+			RedirectURL:     v.GetString(key + "redirect_url"),
+			LinkRedirectURL: v.GetString(key + "link_redirect_url"),
+			Scopes:          scopes,
+		})
+	}
+
+	return providers
+}
+
+// setWebAuthnDefaults makes passkeys work for the frontend out of the box
+// The relying party is the site the user sees, so the defaults come from FRONTEND_URL
+func setWebAuthnDefaults(cfg *Config) {
+	if cfg.WebAuthn.RPName == "" {
+		cfg.WebAuthn.RPName = cfg.App.Name
+	}
+
+	frontend, err := url.Parse(cfg.App.FrontendURL)
+	if err != nil || frontend.Host == "" {
+		return // validateConfig reports what's missing
+	}
+	if cfg.WebAuthn.RPID == "" {
+		cfg.WebAuthn.RPID = frontend.Hostname()
+	}
+	if len(cfg.WebAuthn.RPOrigins) == 0 {
+		cfg.WebAuthn.RPOrigins = []string{frontend.Scheme + "://" + frontend.Host}
+	}
+}
+
 func validateConfig(cfg *Config) error {
 	var missingFields []string
 
@@ -126,11 +352,29 @@ func validateConfig(cfg *Config) error {
 		missingFields = append(missingFields, "db.sslmode")
 	}
 
-	if cfg.Jwt.Secret == "" {
-		missingFields = append(missingFields, "jwt.secret")
-	} else if len(cfg.Jwt.Secret) < 16 {
+	switch cfg.Jwt.Algorithm {
+	case "HS256":
+		if cfg.Jwt.Secret == "" {
+			missingFields = append(missingFields, "jwt.secret")
+		}
+	case "RS256", "EdDSA":
+		if cfg.Jwt.KeysDir == "" {
+			missingFields = append(missingFields, "jwt.keys_dir")
+		}
+	default:
+		missingFields = append(missingFields, "jwt.algorithm (must be EdDSA, RS256 or HS256)")
+	}
+	if cfg.Jwt.Secret != "" && len(cfg.Jwt.Secret) < 16 {
 		missingFields = append(missingFields, "jwt.secret (must be at least 16 characters)")
 	}
+	if cfg.Jwt.KeyRotationInterval < 0 || cfg.Jwt.KeyGracePeriod < 0 {
+		missingFields = append(missingFields, "jwt.key_rotation_interval/key_grace_period (must not be negative)")
+	}
+	if cfg.Jwt.LegacyUntil != "" {
+		if _, err := time.Parse(time.RFC3339, cfg.Jwt.LegacyUntil); err != nil {
+			missingFields = append(missingFields, "jwt.legacy_until (must be an RFC 3339 time)")
+		}
+	}
 	if cfg.Jwt.AccessTokenTTL <= 0 {
 		missingFields = append(missingFields, "jwt.access_token_ttl (must be greater than 0)")
 	}
@@ -138,6 +382,100 @@ func validateConfig(cfg *Config) error {
 		missingFields = append(missingFields, "jwt.refresh_token_ttl (must be greater than 0)")
 	}
 
+	switch cfg.Auth.UnverifiedAccess {
+	case "full", "read_only", "none":
+	default:
+		missingFields = append(missingFields, "auth.unverified_access (must be full, read_only or none)")
+	}
+	if cfg.Auth.VerificationTokenTTL <= 0 {
+		missingFields = append(missingFields, "auth.verification_token_ttl (must be greater than 0)")
+	}
+	if cfg.Auth.PasswordResetTTL <= 0 {
+		missingFields = append(missingFields, "auth.password_reset_ttl (must be greater than 0)")
+	}
+	if cfg.Auth.LockoutThreshold < 0 {
+		missingFields = append(missingFields, "auth.lockout_threshold (must not be negative)")
+	}
+	if cfg.Auth.LockoutThreshold > 0 && cfg.Auth.LockoutDuration <= 0 {
+		missingFields = append(missingFields, "auth.lockout_duration (must be greater than 0)")
+	}
+	if cfg.Auth.LoginDelayBase < 0 || cfg.Auth.LoginDelayMax < 0 {
+		missingFields = append(missingFields, "auth.login_delay_base/login_delay_max (must not be negative)")
+	}
+	if cfg.Auth.GuestRetention < 0 {
+		missingFields = append(missingFields, "auth.guest_retention (must not be negative)")
+	}
+	if cfg.Auth.PasswordMinLength <= 0 {
+		missingFields = append(missingFields, "auth.password_min_length (must be greater than 0)")
+	}
+	switch cfg.Auth.PasswordHash {
+	case "argon2id":
+		if cfg.Auth.Argon2Memory <= 0 || cfg.Auth.Argon2Iterations <= 0 ||
+			cfg.Auth.Argon2Parallelism <= 0 || cfg.Auth.Argon2Parallelism > 255 {
+			missingFields = append(missingFields, "auth.argon2_memory/argon2_iterations/argon2_parallelism (must be greater than 0, parallelism at most 255)")
+		}
+	case "bcrypt":
+		if cfg.Auth.BcryptCost < 4 || cfg.Auth.BcryptCost > 31 {
+			missingFields = append(missingFields, "auth.bcrypt_cost (must be between 4 and 31)")
+		}
+	default:
+		missingFields = append(missingFields, "auth.password_hash (must be argon2id or bcrypt)")
+	}
+	if cfg.Auth.MagicLinkTTL <= 0 {
+		missingFields = append(missingFields, "auth.magic_link_ttl (must be greater than 0)")
+	}
+	switch cfg.Auth.CookieSameSite {
+	case "strict", "lax":
+	case "none":
+		if !cfg.Auth.CookieSecure {
+			missingFields = append(missingFields, "auth.cookie_secure (must be true when cookie_same_site is none)")
+		}
+	default:
+		missingFields = append(missingFields, "auth.cookie_same_site (must be strict, lax or none)")
+	}
+
+	if cfg.Account.DeletionGracePeriod < 0 {
+		missingFields = append(missingFields, "account.deletion_grace_period (must not be negative)")
+	}
+	if cfg.Account.DeletionMode != "anonymize" && cfg.Account.DeletionMode != "hard_delete" {
+		missingFields = append(missingFields, "account.deletion_mode (must be anonymize or hard_delete)")
+	}
+	if cfg.Account.DeletedContent != "reattribute" && cfg.Account.DeletedContent != "remove" {
+		missingFields = append(missingFields, "account.deleted_content (must be reattribute or remove)")
+	}
+	if cfg.Account.ExportDir == "" {
+		missingFields = append(missingFields, "account.export_dir")
+	}
+	if cfg.Account.ExportTTL <= 0 {
+		missingFields = append(missingFields, "account.export_ttl (must be greater than 0)")
+	}
+
+	switch cfg.Mail.Driver {
+	case "outbox":
+	case "smtp":
+		if cfg.Mail.SMTPHost == "" {
+			missingFields = append(missingFields, "mail.smtp_host (required for smtp driver)")
+		}
+	default:
+		missingFields = append(missingFields, "mail.driver (must be smtp or outbox)")
+	}
+
+	for _, provider := range cfg.OAuth.Providers {
+		if reservedProviderNames[provider.Name] {
+			missingFields = append(missingFields, "oauth.providers ("+provider.Name+" is a reserved name)")
+		}
+		if provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			missingFields = append(missingFields, "oauth_provider."+provider.Name+" (issuer, client_id and redirect_url are required)")
+		}
+	}
+
+	if cfg.WebAuthn.RPID == "" {
+		missingFields = append(missingFields, "webauthn.rp_id (or a valid app.frontend_url)")
+	}
+	if len(cfg.WebAuthn.RPOrigins) == 0 {
+		missingFields = append(missingFields, "webauthn.rp_origins (or a valid app.frontend_url)")
+	}
+
 	if len(missingFields) > 0 {
 		return errors.New("missing or invalid configuration fields: " + strings.Join(missingFields, ", "))
 	}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"filmfolk/internal/middleware"
+	"filmfolk/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessTokenHandler handles personal access token management
+type AccessTokenHandler struct {
+	accessTokenService *services.AccessTokenService
+}
+
+// NewAccessTokenHandler creates a new access token handler
+func NewAccessTokenHandler() *AccessTokenHandler {
+	return &AccessTokenHandler{
+		accessTokenService: services.NewAccessTokenService(),
+	}
+}
+
+// ListTokens handles GET /auth/tokens
+// @Summary List personal access tokens
+// @Description Tokens that haven't been revoked, including expired ones. The token itself is never shown again.
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} gin.H
+// @Router /auth/tokens [get]
+func (h *AccessTokenHandler) ListTokens(c *gin.Context) {
+	tokens, err := h.accessTokenService.ListTokens(middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// CreateToken handles POST /auth/tokens
+// @Summary Create a personal access token
+// @Description Create a scoped token for scripts. The token is only returned in this response.
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body services.CreateAccessTokenInput true "Name, scopes and optional expiry"
+// @Success 201 {object} services.CreatedAccessToken
+// @Failure 400 {object} gin.H
+// @Router /auth/tokens [post]
+func (h *AccessTokenHandler) CreateToken(c *gin.Context) {
+	var input services.CreateAccessTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.accessTokenService.CreateToken(middleware.GetUserID(c), input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// RevokeToken handles DELETE /auth/tokens/:id
+// @Summary Revoke a personal access token
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Token ID"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /auth/tokens/{id} [delete]
+func (h *AccessTokenHandler) RevokeToken(c *gin.Context) {
+	tokenID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	if err := h.accessTokenService.RevokeToken(middleware.GetUserID(c), tokenID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/middleware"
+	"filmfolk/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccountHandler handles data export, account deletion, email changes and the user's security log
+type AccountHandler struct {
+	accountService       *services.AccountService
+	dataExportService    *services.DataExportService
+	securityEventService *services.SecurityEventService
+	emailChangeService   *services.EmailChangeService
+}
+
+// NewAccountHandler creates a new account handler
+func NewAccountHandler(cfg *config.Config) *AccountHandler {
+	return &AccountHandler{
+		accountService:       services.NewAccountService(cfg),
+		dataExportService:    services.NewDataExportService(cfg),
+		securityEventService: services.NewSecurityEventService(),
+		emailChangeService:   services.NewEmailChangeService(cfg),
+	}
+}
+
+// RequestExport handles POST /me/export
+// @Summary Request a data export
+// @Description Queue an archive of your profile, reviews, comments, likes, follows and sessions. You get an email when it's ready.
+// @Tags account
+// @Security BearerAuth
+// @Produce json
+// @Success 202 {object} models.DataExport
+// @Failure 409,429 {object} gin.H
+// @Router /me/export [post]
+func (h *AccountHandler) RequestExport(c *gin.Context) {
+	export, err := h.dataExportService.RequestExport(middleware.GetUserID(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case strings.Contains(err.Error(), "already being prepared"):
+			status = http.StatusConflict
+		case strings.Contains(err.Error(), "requested recently"):
+			status = http.StatusTooManyRequests
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, export)
+}
+
+// GetExport handles GET /me/export
+// @Summary Get data export status
+// @Description The most recent export request
+// @Tags account
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} models.DataExport
+// @Failure 404 {object} gin.H
+// @Router /me/export [get]
+func (h *AccountHandler) GetExport(c *gin.Context) {
+	export, err := h.dataExportService.GetLatestExport(middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, export)
+}
+
+// DownloadExport handles GET /me/export/:id/download
+// @Summary Download a data export
+// @Description Download the zip archive. Works once; the file is deleted afterwards.
+// @Tags account
+// @Security BearerAuth
+// @Produce application/zip
+// @Param id path int true "Export ID"
+// @Success 200 {file} file
+// @Failure 404 {object} gin.H
+// @Router /me/export/{id}/download [get]
+func (h *AccountHandler) DownloadExport(c *gin.Context) {
+	exportID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID"})
+		return
+	}
+
+	file, size, err := h.dataExportService.OpenDownload(middleware.GetUserID(c), exportID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	filename := fmt.Sprintf("filmfolk-export-%s.zip", time.Now().Format("2006-01-02"))
+	c.DataFromReader(http.StatusOK, size, "application/zip", file, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, filename),
+		"Cache-Control":       "no-store",
+	})
+}
+
+// DeleteAccount handles DELETE /me
+// @Summary Delete account
+// @Description Schedule the account for deletion after the grace period. Confirm with your password, or your username if the account has none. Other sessions are logged out.
+// @Tags account
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body services.DeleteAccountInput true "Password or username confirmation"
+// @Success 202 {object} gin.H
+// @Failure 400,409,429 {object} gin.H
+// @Router /me [delete]
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	var input services.DeleteAccountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scheduledAt, err := h.accountService.RequestDeletion(middleware.GetUserID(c), middleware.GetSessionID(c), input)
+	if err != nil {
+		var throttled *services.LoginThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			respondLoginError(c, err)
+		case err.Error() == "account deletion is already scheduled":
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":               "Account scheduled for deletion",
+		"deletion_scheduled_at": scheduledAt,
+	})
+}
+
+// CancelDeletion handles POST /me/deletion/cancel
+// @Summary Cancel account deletion
+// @Description Keep an account that is scheduled for deletion
+// @Tags account
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /me/deletion/cancel [post]
+func (h *AccountHandler) CancelDeletion(c *gin.Context) {
+	if err := h.accountService.CancelDeletion(middleware.GetUserID(c)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deletion cancelled"})
+}
+
+// ChangeEmail handles POST /me/email
+// @Summary Change email address
+// @Description Start changing the email address. Confirm with your password; accounts without one must have signed in within the last 10 minutes. A confirmation link goes to the new address and a notice with a cancel link to the current one. The address only changes once the new one is confirmed.
+// @Tags account
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body services.ChangeEmailInput true "New address and password"
+// @Success 202 {object} gin.H
+// @Failure 400,409,429 {object} gin.H
+// @Router /me/email [post]
+func (h *AccountHandler) ChangeEmail(c *gin.Context) {
+	var input services.ChangeEmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	change, err := h.emailChangeService.RequestChange(middleware.GetUserID(c), middleware.GetSessionID(c), input, deviceInfo(c, ""))
+	if err != nil {
+		var throttled *services.LoginThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			respondLoginError(c, err)
+		case err.Error() == "email already registered":
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "Check your new address for a confirmation link",
+		"new_email":  change.NewEmail,
+		"expires_at": change.ExpiresAt,
+	})
+}
+
+// ConfirmEmailChange handles POST /auth/email-change/confirm
+// @Summary Confirm email change
+// @Description Switch to the new address with the token from the confirmation email. Also verifies the new address.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param input body object{token=string} true "Token from the confirmation email"
+// @Success 200 {object} gin.H
+// @Failure 400,409 {object} gin.H
+// @Router /auth/email-change/confirm [post]
+func (h *AccountHandler) ConfirmEmailChange(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.emailChangeService.ConfirmChange(input.Token, deviceInfo(c, "")); err != nil {
+		status := http.StatusBadRequest
+		if err.Error() == "email already registered" {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email address changed"})
+}
+
+// CancelEmailChange handles POST /auth/email-change/cancel
+// @Summary Cancel email change
+// @Description Stop an email change with the token from the notice sent to the old address. An already confirmed change is undone, all sessions are logged out and personal access tokens revoked.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param input body object{token=string} true "Token from the notice email"
+// @Success 200 {object} gin.H
+// @Failure 400,409 {object} gin.H
+// @Router /auth/email-change/cancel [post]
+func (h *AccountHandler) CancelEmailChange(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reverted, revoked, err := h.emailChangeService.CancelChange(input.Token, deviceInfo(c, ""))
+	if err != nil {
+		status := http.StatusBadRequest
+		if err.Error() == "email already registered" {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if reverted {
+		c.JSON(http.StatusOK, gin.H{
+			"message":               "Email address changed back, all sessions logged out and access tokens revoked. Reset your password to keep the account safe.",
+			"reverted":              true,
+			"revoked":               revoked.Sessions,
+			"access_tokens_revoked": revoked.AccessTokens,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email change cancelled", "reverted": false})
+}
+
+// ListSecurityEvents handles GET /me/security-events
+// @Summary List security events
+// @Description Logins, failed logins, refreshes, logouts, linked providers and password changes on your account, newest first
+// @Tags account
+// @Security BearerAuth
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Events per page (max 100)" default(50)
+// @Success 200 {object} gin.H
+// @Router /me/security-events [get]
+func (h *AccountHandler) ListSecurityEvents(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+
+	events, total, err := h.securityEventService.ListUserEvents(middleware.GetUserID(c), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events":    events,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
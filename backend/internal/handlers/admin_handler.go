@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"filmfolk/internal/middleware"
+	"filmfolk/internal/models"
+	"filmfolk/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler handles admin-only HTTP requests
+type AdminHandler struct {
+	adminService         *services.AdminService
+	sanctionService      *services.SanctionService
+	securityEventService *services.SecurityEventService
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler() *AdminHandler {
+	return &AdminHandler{
+		adminService:         services.NewAdminService(),
+		sanctionService:      services.NewSanctionService(),
+		securityEventService: services.NewSecurityEventService(),
+	}
+}
+
+// UpdateUserRole handles PUT /api/v1/admin/users/:id/role
+func (h *AdminHandler) UpdateUserRole(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input services.UpdateRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.adminService.UpdateUserRole(userID, middleware.GetUserID(c), input.Role, deviceInfo(c, ""))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":       user.ID,
+		"username": user.Username,
+		"role":     user.Role,
+	})
+}
+
+// SuspendUser handles POST /api/v1/admin/users/:id/suspend
+// The user is signed out everywhere and can log in again once the suspension ends
+func (h *AdminHandler) SuspendUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input services.SuspendInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.sanctionService.SuspendUser(userID, middleware.GetUserID(c), input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sanctionResponse(user))
+}
+
+// BanUser handles POST /api/v1/admin/users/:id/ban
+func (h *AdminHandler) BanUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input services.BanInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.sanctionService.BanUser(userID, middleware.GetUserID(c), input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sanctionResponse(user))
+}
+
+// ReinstateUser handles POST /api/v1/admin/users/:id/reinstate
+// Lifts a suspension or ban early
+func (h *AdminHandler) ReinstateUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	// The body is optional, it only carries a note for the history
+	var input services.ReinstateInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	user, err := h.sanctionService.ReinstateUser(userID, middleware.GetUserID(c), input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sanctionResponse(user))
+}
+
+// ListSanctions handles GET /api/v1/admin/users/:id/sanctions
+func (h *AdminHandler) ListSanctions(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	sanctions, err := h.sanctionService.ListSanctions(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sanctions": sanctions})
+}
+
+// QuerySecurityEvents handles GET /api/v1/admin/security-events
+// Filters: user_id, event_type, ip_address, request_id, from, to (RFC 3339)
+func (h *AdminHandler) QuerySecurityEvents(c *gin.Context) {
+	var filter services.SecurityEventFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, total, err := h.securityEventService.QueryEvents(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"total":  total,
+	})
+}
+
+// sanctionResponse is a user's current standing, as returned by the sanction endpoints
+func sanctionResponse(user *models.User) gin.H {
+	return gin.H{
+		"id":              user.ID,
+		"username":        user.Username,
+		"status":          user.Status,
+		"status_reason":   user.StatusReason,
+		"suspended_until": user.SuspendedUntil,
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/middleware"
+	"filmfolk/internal/services"
+	"filmfolk/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sessionCookiePath limits the refresh token cookie to the auth endpoints
+const sessionCookiePath = "/api/v1/auth"
+
+// sessionCookies writes auth responses for both session modes
+// Token mode (default): access and refresh token in the body, as always
+// Cookie mode (AUTH_COOKIE_MODE, asked for with "X-Auth-Mode: cookie"): the refresh token
+// goes in an httpOnly cookie and the body carries the access token and a CSRF token
+type sessionCookies struct {
+	enabled  bool
+	domain   string
+	secure   bool
+	sameSite http.SameSite
+	maxAge   int // seconds, matches the refresh token lifetime
+}
+
+func newSessionCookies(cfg *config.Config) *sessionCookies {
+	sameSite := http.SameSiteStrictMode
+	switch cfg.Auth.CookieSameSite {
+	case "lax":
+		sameSite = http.SameSiteLaxMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+
+	return &sessionCookies{
+		enabled:  cfg.Auth.CookieMode,
+		domain:   cfg.Auth.CookieDomain,
+		secure:   cfg.Auth.CookieSecure,
+		sameSite: sameSite,
+		maxAge:   int((time.Duration(cfg.Jwt.RefreshTokenTTL) * 24 * time.Hour).Seconds()),
+	}
+}
+
+// wantsCookie checks if the client asked for cookie mode
+func (s *sessionCookies) wantsCookie(c *gin.Context) bool {
+	return s.enabled && c.GetHeader(middleware.AuthModeHeader) == "cookie"
+}
+
+// respond writes tokens in the mode the client asked for
+func (s *sessionCookies) respond(c *gin.Context, status int, response *services.AuthResponse) {
+	if !s.wantsCookie(c) {
+		c.JSON(status, response)
+		return
+	}
+	s.respondWithCookie(c, status, response)
+}
+
+// respondWithCookie moves the refresh token into the session cookie
+// The CSRF token stays the same for the life of the browser session, so other tabs
+// holding it keep working after a refresh
+func (s *sessionCookies) respondWithCookie(c *gin.Context, status int, response *services.AuthResponse) {
+	csrfToken, err := c.Cookie(middleware.CSRFCookieName)
+	if err != nil || csrfToken == "" {
+		csrfToken, err = utils.GenerateSecureToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
+			return
+		}
+	}
+
+	s.setCookie(c, middleware.SessionCookieName, response.RefreshToken, sessionCookiePath, true, s.maxAge)
+	s.setCookie(c, middleware.CSRFCookieName, csrfToken, "/", false, s.maxAge)
+
+	body := *response
+	body.RefreshToken = ""
+	body.CSRFToken = csrfToken
+	c.JSON(status, body)
+}
+
+// refreshToken returns the refresh token from the body, or else from the session cookie
+func (s *sessionCookies) refreshToken(c *gin.Context, fromBody string) (token string, fromCookie bool) {
+	if fromBody != "" || !s.enabled {
+		return fromBody, false
+	}
+
+	token, err := c.Cookie(middleware.SessionCookieName)
+	if err != nil {
+		return "", false
+	}
+	return token, true
+}
+
+// clear removes the session and CSRF cookies
+func (s *sessionCookies) clear(c *gin.Context) {
+	s.setCookie(c, middleware.SessionCookieName, "", sessionCookiePath, true, -1)
+	s.setCookie(c, middleware.CSRFCookieName, "", "/", false, -1)
+}
+
+func (s *sessionCookies) setCookie(c *gin.Context, name, value, path string, httpOnly bool, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   s.domain,
+		MaxAge:   maxAge,
+		Secure:   s.secure,
+		HttpOnly: httpOnly,
+		SameSite: s.sameSite,
+	})
+}
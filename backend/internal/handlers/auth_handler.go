@@ -1,23 +1,45 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"filmfolk/internal/config"
+	"filmfolk/internal/middleware"
+	"filmfolk/internal/passwordpolicy"
 	"filmfolk/internal/services"
+	"filmfolk/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 // AuthHandler handles authentication HTTP requests
 type AuthHandler struct {
-	authService *services.AuthService
+	authService         *services.AuthService
+	sessionService      *services.SessionService
+	verificationService *services.VerificationService
+	passwordService     *services.PasswordService
+	lockoutService      *services.LockoutService
+	magicLinkService    *services.MagicLinkService
+	knownDeviceService  *services.KnownDeviceService
+	cookies             *sessionCookies
+	magicLinkMaxAge     int // seconds, matches the magic link lifetime
 }
 
 // NewAuthHandler creates a new auth handler
 func NewAuthHandler(cfg *config.Config) *AuthHandler {
 	return &AuthHandler{
-		authService: services.NewAuthService(cfg),
+		authService:         services.NewAuthService(cfg),
+		sessionService:      services.NewSessionService(),
+		verificationService: services.NewVerificationService(cfg),
+		passwordService:     services.NewPasswordService(cfg),
+		lockoutService:      services.NewLockoutService(cfg),
+		magicLinkService:    services.NewMagicLinkService(cfg),
+		knownDeviceService:  services.NewKnownDeviceService(cfg),
+		cookies:             newSessionCookies(cfg),
+		magicLinkMaxAge:     cfg.Auth.MagicLinkTTL * 60,
 	}
 }
 
@@ -29,7 +51,7 @@ func NewAuthHandler(cfg *config.Config) *AuthHandler {
 // @Produce json
 // @Param input body services.RegisterInput true "Registration data"
 // @Success 201 {object} services.AuthResponse
-// @Failure 400 {object} gin.H
+// @Failure 400 {object} gin.H "password_feedback lists the policy violations"
 // @Router /auth/register [post]
 func (h *AuthHandler) Register(c *gin.Context) {
 	var input services.RegisterInput
@@ -41,13 +63,13 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// Call service to register user
-	response, err := h.authService.Register(input)
+	response, err := h.authService.Register(input, deviceInfo(c, ""))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondPasswordError(c, http.StatusBadRequest, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, response)
+	h.cookies.respond(c, http.StatusCreated, response)
 }
 
 // Login handles POST /auth/login
@@ -57,8 +79,8 @@ func (h *AuthHandler) Register(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param input body services.LoginInput true "Login credentials"
-// @Success 200 {object} services.AuthResponse
-// @Failure 400,401 {object} gin.H
+// @Success 200 {object} services.AuthResponse "or services.MFAChallenge when 2FA is enabled"
+// @Failure 400,401,403,429 {object} gin.H
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
 	var input services.LoginInput
@@ -68,71 +90,429 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	response, err := h.authService.Login(input)
+	response, challenge, err := h.authService.Login(input, deviceInfo(c, input.DeviceLabel))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		respondLoginError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	// 2FA enabled - client must continue with POST /auth/2fa/verify
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	h.cookies.respond(c, http.StatusOK, response)
 }
 
 // RefreshToken handles POST /auth/refresh
 // @Summary Refresh access token
-// @Description Get a new access token using a refresh token
+// @Description Get a new access token using a refresh token. In cookie mode leave the body empty; the session cookie is used and X-CSRF-Token is required.
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param input body object{refresh_token=string} true "Refresh token"
+// @Param input body object{refresh_token=string} false "Refresh token (token mode)"
 // @Success 200 {object} services.AuthResponse
-// @Failure 400,401 {object} gin.H
+// @Failure 400,401,403 {object} gin.H
 // @Router /auth/refresh [post]
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	var input struct {
-		RefreshToken string `json:"refresh_token" binding:"required"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	refreshToken, fromCookie := h.cookies.refreshToken(c, input.RefreshToken)
+	if refreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required"})
 		return
 	}
 
-	response, err := h.authService.RefreshAccessToken(input.RefreshToken)
+	response, err := h.authService.RefreshAccessToken(refreshToken, deviceInfo(c, ""))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		if fromCookie {
+			h.cookies.clear(c)
+		}
+		respondLoginError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	// A session that lives in the cookie stays there
+	if fromCookie {
+		h.cookies.respondWithCookie(c, http.StatusOK, response)
+		return
+	}
+	h.cookies.respond(c, http.StatusOK, response)
 }
 
 // Logout handles POST /auth/logout
 // @Summary Logout user
-// @Description Revoke refresh token
+// @Description Revoke refresh token. In cookie mode leave the body empty; the session cookie is revoked and cleared. An access token sent in the Authorization header is revoked too.
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param input body object{refresh_token=string} true "Refresh token to revoke"
+// @Param input body object{refresh_token=string} false "Refresh token to revoke (token mode)"
 // @Success 200 {object} gin.H
-// @Failure 400 {object} gin.H
+// @Failure 400,403 {object} gin.H
 // @Router /auth/logout [post]
 func (h *AuthHandler) Logout(c *gin.Context) {
 	var input struct {
-		RefreshToken string `json:"refresh_token" binding:"required"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	refreshToken, fromCookie := h.cookies.refreshToken(c, input.RefreshToken)
+	if refreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required"})
+		return
+	}
+	if fromCookie {
+		h.cookies.clear(c)
+	}
+
+	tokenID, tokenExpiresAt := middleware.GetTokenID(c)
+	err := h.authService.Logout(refreshToken, tokenID, tokenExpiresAt, deviceInfo(c, ""))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// CSRFToken handles GET /auth/csrf
+// @Summary Get the CSRF token
+// @Description Cookie mode: the CSRF token of the current browser session, for frontends that can't read the CSRF cookie (other domain). Only allowed origins can read the response.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /auth/csrf [get]
+func (h *AuthHandler) CSRFToken(c *gin.Context) {
+	token, err := c.Cookie(middleware.CSRFCookieName)
+	if err != nil || token == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No cookie session"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"csrf_token": token})
+}
+
+// VerifyEmail handles POST /auth/verify-email
+// @Summary Verify email address
+// @Description Confirm an email address with the token from the verification email
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body object{token=string} true "Verification token"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Router /auth/verify-email [post]
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.verificationService.VerifyEmail(input.Token); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerification handles POST /auth/resend-verification
+// @Summary Resend verification email
+// @Description Send a new verification link. Always succeeds to avoid revealing which emails are registered.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body object{email=string} true "Account email"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Router /auth/resend-verification [post]
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.verificationService.ResendVerification(input.Email); err != nil {
+		utils.GetLogger().Error().Err(err).Msg("Failed to resend verification email")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the address needs verification, a new link has been sent"})
+}
+
+// ForgotPassword handles POST /auth/forgot-password
+// @Summary Request a password reset
+// @Description Email a password reset link. Always succeeds to avoid revealing which emails are registered.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body object{email=string} true "Account email"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Router /auth/forgot-password [post]
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.passwordService.ForgotPassword(input.Email); err != nil {
+		utils.GetLogger().Error().Err(err).Msg("Failed to send password reset email")
 	}
 
+	c.JSON(http.StatusOK, gin.H{"message": "If an account exists for that email, a reset link has been sent"})
+}
+
+// ResetPassword handles POST /auth/reset-password
+// @Summary Reset password
+// @Description Set a new password with the token from the reset email. Logs out all sessions and revokes personal access tokens.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body services.ResetPasswordInput true "Reset token and new password"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H "password_feedback lists the policy violations"
+// @Router /auth/reset-password [post]
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var input services.ResetPasswordInput
+
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	err := h.authService.Logout(input.RefreshToken)
+	revoked, err := h.passwordService.ResetPassword(input, deviceInfo(c, ""))
 	if err != nil {
+		respondPasswordError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":               "Password reset successfully. Please log in again.",
+		"revoked":               revoked.Sessions,
+		"access_tokens_revoked": revoked.AccessTokens,
+	})
+}
+
+// ChangePassword handles POST /auth/password
+// @Summary Change password
+// @Description Replace the password after confirming the current one. Logs out every other session and revokes personal access tokens.
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body services.ChangePasswordInput true "Current and new password"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H "password_feedback lists the policy violations"
+// @Failure 429 {object} gin.H
+// @Router /auth/password [post]
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var input services.ChangePasswordInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+	revoked, err := h.passwordService.ChangePassword(middleware.GetUserID(c), middleware.GetSessionID(c), input, deviceInfo(c, ""))
+	if err != nil {
+		var throttled *services.LoginThrottledError
+		if errors.As(err, &throttled) {
+			respondLoginError(c, err)
+			return
+		}
+		respondPasswordError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":               "Password changed",
+		"revoked":               revoked.Sessions,
+		"access_tokens_revoked": revoked.AccessTokens,
+	})
+}
+
+// UnlockAccount handles POST /auth/unlock
+// @Summary Unlock account
+// @Description Lift a failed-login lockout early with the token from the unlock email
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body object{token=string} true "Unlock token"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Router /auth/unlock [post]
+func (h *AuthHandler) UnlockAccount(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.lockoutService.Unlock(input.Token); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked"})
+}
+
+// RequestUnlock handles POST /auth/unlock/request
+// @Summary Request an unlock link
+// @Description Email a new unlock link if the account is locked or throttled. Always succeeds to avoid revealing which emails are registered.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body object{email=string} true "Account email"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Router /auth/unlock/request [post]
+func (h *AuthHandler) RequestUnlock(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.lockoutService.RequestUnlock(input.Email); err != nil {
+		utils.GetLogger().Error().Err(err).Msg("Failed to send unlock email")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the account is locked, an unlock link has been sent"})
+}
+
+// magicLinkCookieName holds the device token binding a magic link to the browser that asked for it
+const magicLinkCookieName = "filmfolk_magic_link"
+
+// RequestMagicLink handles POST /auth/magic-link
+// @Summary Request a sign-in link
+// @Description Email a single-use sign-in link. Creates the account on first use if AUTH_MAGIC_LINK_SIGNUP allows it. Always succeeds (apart from throttling) to avoid revealing which emails are registered. The link is bound to this browser with a cookie; device_token is returned as well for clients without cookies.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body services.RequestMagicLinkInput true "Email"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 429 {object} gin.H
+// @Router /auth/magic-link [post]
+func (h *AuthHandler) RequestMagicLink(c *gin.Context) {
+	var input services.RequestMagicLinkInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deviceToken, err := h.magicLinkService.RequestLink(input.Email, deviceInfo(c, ""))
+	if err != nil {
+		var throttled *services.MagicLinkThrottledError
+		if errors.As(err, &throttled) {
+			retryAfter := int(math.Ceil(throttled.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       err.Error(),
+				"retry_after": retryAfter,
+			})
+			return
+		}
+		utils.GetLogger().Error().Err(err).Msg("Failed to create magic link")
+	}
+
+	response := gin.H{"message": "If sign-in by link is possible for that email, a link has been sent"}
+	if deviceToken != "" {
+		h.cookies.setCookie(c, magicLinkCookieName, deviceToken, sessionCookiePath+"/magic-link", true, h.magicLinkMaxAge)
+		response["device_token"] = deviceToken
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ConsumeMagicLink handles POST /auth/magic-link/consume
+// @Summary Sign in with a link
+// @Description Exchange the token from a sign-in link for tokens. Opened in another browser than the one that asked for it, the link needs confirm=true (409 otherwise, the link stays valid). If 2FA is enabled, returns an MFA challenge instead, as login does.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body services.ConsumeMagicLinkInput true "Link token"
+// @Success 200 {object} services.AuthResponse
+// @Failure 400,401,403 {object} gin.H
+// @Failure 409 {object} gin.H "confirmation_required, requested_from describes the browser that asked for the link"
+// @Router /auth/magic-link/consume [post]
+func (h *AuthHandler) ConsumeMagicLink(c *gin.Context) {
+	var input services.ConsumeMagicLinkInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.DeviceToken == "" {
+		input.DeviceToken, _ = c.Cookie(magicLinkCookieName)
+	}
+
+	response, challenge, err := h.magicLinkService.ConsumeLink(input, deviceInfo(c, input.DeviceLabel))
+	if err != nil {
+		var deviceErr *services.MagicLinkDeviceError
+		if errors.As(err, &deviceErr) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":                 err.Error(),
+				"confirmation_required": true,
+				"requested_from": gin.H{
+					"ip_address":   deviceErr.IPAddress,
+					"user_agent":   deviceErr.UserAgent,
+					"requested_at": deviceErr.RequestedAt,
+				},
+			})
+			return
+		}
+		respondLoginError(c, err)
+		return
+	}
+
+	h.cookies.setCookie(c, magicLinkCookieName, "", sessionCookiePath+"/magic-link", true, -1)
+
+	// 2FA enabled - client must continue with POST /auth/2fa/verify
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	h.cookies.respond(c, http.StatusOK, response)
 }
 
 // GetCurrentUser handles GET /auth/me
@@ -157,5 +537,243 @@ func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
 		"id":       userID,
 		"username": c.GetString("username"),
 		"email":    c.GetString("email"),
+		"role":     middleware.GetUserRole(c),
 	})
 }
+
+// ListSessions handles GET /auth/sessions
+// @Summary List active sessions
+// @Description List the devices the current user is logged in from
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Router /auth/sessions [get]
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	sessions, err := h.sessionService.ListSessions(middleware.GetUserID(c), middleware.GetSessionID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RenameSession handles PATCH /auth/sessions/:id
+// @Summary Rename a session
+// @Description Set a label for one of the current user's sessions
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Session ID"
+// @Param input body services.RenameSessionInput true "New label"
+// @Success 200 {object} gin.H
+// @Failure 400,404 {object} gin.H
+// @Router /auth/sessions/{id} [patch]
+func (h *AuthHandler) RenameSession(c *gin.Context) {
+	var input services.RenameSessionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.sessionService.RenameSession(middleware.GetUserID(c), c.Param("id"), input.Label); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session renamed"})
+}
+
+// RevokeSession handles DELETE /auth/sessions/:id
+// @Summary Revoke a session
+// @Description Log out one of the current user's sessions
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /auth/sessions/{id} [delete]
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	if err := h.sessionService.RevokeSession(middleware.GetUserID(c), c.Param("id"), deviceInfo(c, "")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeAllSessions handles POST /auth/sessions/revoke-all
+// @Summary Revoke all sessions
+// @Description Log out everywhere and revoke personal access tokens, optionally keeping the current session
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body object{keep_current=bool} false "Keep the current session"
+// @Success 200 {object} gin.H
+// @Router /auth/sessions/revoke-all [post]
+func (h *AuthHandler) RevokeAllSessions(c *gin.Context) {
+	var input struct {
+		KeepCurrent bool `json:"keep_current"`
+	}
+
+	// Body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	keepSessionID := ""
+	if input.KeepCurrent {
+		keepSessionID = middleware.GetSessionID(c)
+	}
+
+	revoked, err := h.sessionService.RevokeAllSessions(middleware.GetUserID(c), keepSessionID, deviceInfo(c, ""))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":               "Sessions revoked",
+		"revoked":               revoked.Sessions,
+		"access_tokens_revoked": revoked.AccessTokens,
+	})
+}
+
+// ListDevices handles GET /auth/devices
+// @Summary List known devices
+// @Description List the devices (user agent and IP address) the current user has signed in from. Signing in from a new one emails an alert.
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Router /auth/devices [get]
+func (h *AuthHandler) ListDevices(c *gin.Context) {
+	devices, err := h.knownDeviceService.ListDevices(middleware.GetUserID(c), deviceInfo(c, ""))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": devices})
+}
+
+// ForgetDevice handles DELETE /auth/devices/:id
+// @Summary Forget a known device
+// @Description Remove a device from the known devices. The next sign-in from it emails an alert again. Sessions are not affected.
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Device ID"
+// @Success 200 {object} gin.H
+// @Failure 400,404 {object} gin.H
+// @Router /auth/devices/{id} [delete]
+func (h *AuthHandler) ForgetDevice(c *gin.Context) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+
+	if err := h.knownDeviceService.ForgetDevice(middleware.GetUserID(c), deviceID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device forgotten"})
+}
+
+// ReportDevice handles POST /auth/devices/report
+// @Summary Report a sign-in that wasn't you
+// @Description Use the token from a new-device alert email to log out all sessions, revoke personal access tokens and forget the device
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body object{token=string} true "Token from the alert email"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Router /auth/devices/report [post]
+func (h *AuthHandler) ReportDevice(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	revoked, err := h.knownDeviceService.ReportDevice(input.Token, deviceInfo(c, ""))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":               "All sessions logged out and access tokens revoked. Change your password to keep the account safe.",
+		"revoked":               revoked.Sessions,
+		"access_tokens_revoked": revoked.AccessTokens,
+	})
+}
+
+// respondLoginError writes a failed login response
+// Throttled attempts get 429 with Retry-After, suspended or banned accounts 403 with
+// the reason, everything else 401
+func respondLoginError(c *gin.Context, err error) {
+	var statusErr *services.AccountStatusError
+	if errors.As(err, &statusErr) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":          err.Error(),
+			"account_status": statusErr.Status,
+			"reason":         statusErr.Reason,
+			"until":          statusErr.Until,
+		})
+		return
+	}
+
+	var throttled *services.LoginThrottledError
+	if errors.As(err, &throttled) {
+		retryAfter := int(math.Ceil(throttled.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       err.Error(),
+			"retry_after": retryAfter,
+		})
+		return
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+}
+
+// respondPasswordError writes an error response
+// Password policy violations are included as structured feedback for the client
+func respondPasswordError(c *gin.Context, status int, err error) {
+	var policyErr *passwordpolicy.PolicyError
+	if errors.As(err, &policyErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             err.Error(),
+			"password_feedback": policyErr.Violations,
+		})
+		return
+	}
+
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+// deviceInfo captures the client details stored with a new session
+func deviceInfo(c *gin.Context, label string) services.DeviceInfo {
+	return services.DeviceInfo{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+		Label:     label,
+		RequestID: c.GetString("requestID"),
+	}
+}
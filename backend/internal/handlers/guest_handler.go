@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/middleware"
+	"filmfolk/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GuestHandler handles guest account requests
+type GuestHandler struct {
+	guestService *services.GuestService
+	cookies      *sessionCookies
+}
+
+// NewGuestHandler creates a new guest handler
+func NewGuestHandler(cfg *config.Config) *GuestHandler {
+	return &GuestHandler{
+		guestService: services.NewGuestService(cfg),
+		cookies:      newSessionCookies(cfg),
+	}
+}
+
+// Create handles POST /auth/guest
+// @Summary Start a guest session
+// @Description Create a guest account. Guest tokens can keep a watchlist and rate movies, but not comment or follow.
+// @Tags auth
+// @Produce json
+// @Success 201 {object} services.AuthResponse
+// @Failure 500 {object} gin.H
+// @Router /auth/guest [post]
+func (h *GuestHandler) Create(c *gin.Context) {
+	response, err := h.guestService.CreateGuest(deviceInfo(c, ""))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.cookies.respond(c, http.StatusCreated, response)
+}
+
+// Upgrade handles POST /auth/guest/upgrade
+// @Summary Upgrade a guest account
+// @Description Turn the guest into a full account with email/password, or with a provider (code and state from GET /auth/link/{provider}). Watchlist and ratings are kept; guest sessions are ended and new tokens returned.
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body services.GuestUpgradeInput true "Credentials"
+// @Success 200 {object} services.AuthResponse
+// @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Router /auth/guest/upgrade [post]
+func (h *GuestHandler) Upgrade(c *gin.Context) {
+	var input services.GuestUpgradeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.guestService.Upgrade(middleware.GetUserID(c), input, deviceInfo(c, ""))
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case err.Error() == "account is not a guest account":
+			status = http.StatusForbidden
+		case strings.Contains(err.Error(), "already"):
+			status = http.StatusConflict
+		}
+		respondPasswordError(c, status, err)
+		return
+	}
+
+	h.cookies.respond(c, http.StatusOK, response)
+}
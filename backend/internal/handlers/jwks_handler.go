@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"filmfolk/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSHandler struct{}
+
+func NewJWKSHandler() *JWKSHandler {
+	return &JWKSHandler{}
+}
+
+// JWKS publishes the public keys that verify our tokens
+// @Summary JSON Web Key Set
+// @Description Public keys (by kid) for verifying access tokens, including pending and retired keys
+// @Tags auth
+// @Produce json
+// @Success 200 {object} utils.JWKSet
+// @Router /.well-known/jwks.json [get]
+func (h *JWKSHandler) JWKS(c *gin.Context) {
+	// Short cache - verifiers should refetch when they see an unknown kid anyway
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.GetKeyRing().JWKS())
+}
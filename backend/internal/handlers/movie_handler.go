@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"filmfolk/internal/middleware"
 	"filmfolk/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -81,4 +82,71 @@ func (h *MovieHandler) UpdateMovie(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, movie)
-}
\ No newline at end of file
+}
+
+// ListPendingMovies handles GET /api/v1/moderator/movies/pending
+func (h *MovieHandler) ListPendingMovies(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	movies, total, err := h.movieService.ListPendingMovies(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"movies": movies,
+		"total":  total,
+		"page":   page,
+	})
+}
+
+// ApproveMovie handles POST /api/v1/moderator/movies/:id/approve
+func (h *MovieHandler) ApproveMovie(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid movie ID"})
+		return
+	}
+
+	movie, err := h.movieService.ApproveMovie(id, middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, movie)
+}
+
+// RejectMovie handles POST /api/v1/moderator/movies/:id/reject
+func (h *MovieHandler) RejectMovie(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid movie ID"})
+		return
+	}
+
+	if err := h.movieService.RejectMovie(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Movie rejected"})
+}
+
+// DeleteMovie handles DELETE /api/v1/admin/movies/:id
+func (h *MovieHandler) DeleteMovie(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid movie ID"})
+		return
+	}
+
+	if err := h.movieService.DeleteMovie(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Movie deleted successfully"})
+}
@@ -1,12 +1,14 @@
 package handlers
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"filmfolk/internal/config"
+	"filmfolk/internal/middleware"
+	"filmfolk/internal/oauth"
 	"filmfolk/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -14,8 +16,21 @@ import (
 
 // OAuthHandler handles OAuth HTTP requests
 type OAuthHandler struct {
-	oauthService *services.OAuthService
-	frontendURL  string
+	oauthService    *services.OAuthService
+	identityService *services.IdentityService
+	frontendURL     string
+	cookies         *sessionCookies
+}
+
+// LinkInput represents the code and state the frontend link page received from the provider
+type LinkInput struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// ExchangeInput represents the one-time code from the OAuth callback redirect
+type ExchangeInput struct {
+	Code string `json:"code" binding:"required"`
 }
 
 // NewOAuthHandler creates a new OAuth handler
@@ -27,26 +42,47 @@ func NewOAuthHandler(cfg *config.Config) *OAuthHandler {
 	}
 
 	return &OAuthHandler{
-		oauthService: services.NewOAuthService(cfg),
-		frontendURL:  frontendURL,
+		oauthService:    services.NewOAuthService(cfg),
+		identityService: services.NewIdentityService(),
+		frontendURL:     frontendURL,
+		cookies:         newSessionCookies(cfg),
 	}
 }
 
-// GoogleLogin initiates Google OAuth flow
-// @Summary Start Google OAuth login
-// @Description Redirects to Google for authentication
+// ListProviders handles GET /auth/providers
+// @Summary List login providers
+// @Description Names of the configured OAuth/OIDC providers, for rendering login buttons
 // @Tags auth
-// @Success 302 {string} string "Redirect to Google"
-// @Router /auth/google [get]
-func (h *OAuthHandler) GoogleLogin(c *gin.Context) {
-	// Generate random state for CSRF protection
-	state, err := generateRandomState()
+// @Produce json
+// @Success 200 {object} gin.H
+// @Router /auth/providers [get]
+func (h *OAuthHandler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": oauth.Names()})
+}
+
+// Login initiates the OAuth flow for a provider
+// @Summary Start OAuth login
+// @Description Redirects to the provider (google, facebook or a configured OIDC provider) for authentication
+// @Tags auth
+// @Param provider path string true "Provider name"
+// @Success 302 {string} string "Redirect to provider"
+// @Failure 404 {object} gin.H
+// @Router /auth/{provider} [get]
+func (h *OAuthHandler) Login(c *gin.Context) {
+	provider := c.Param("provider")
+	if _, err := oauth.Get(provider); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Start the flow: state, PKCE verifier and nonce are stored server-side
+	authURL, state, err := h.oauthService.StartLogin(provider)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate state"})
+		h.redirectToFrontendWithError(c, "provider_unavailable", "Login provider unavailable")
 		return
 	}
 
-	// Store state in session cookie (httpOnly, secure in production)
+	// Bind the state to this browser (httpOnly, secure in production)
 	c.SetCookie(
 		"oauth_state",
 		state,
@@ -57,21 +93,21 @@ func (h *OAuthHandler) GoogleLogin(c *gin.Context) {
 		true, // httpOnly
 	)
 
-	// Redirect to Google OAuth consent screen
-	authURL := h.oauthService.GetGoogleAuthURL(state)
+	// Redirect to the provider's consent screen
 	c.Redirect(http.StatusTemporaryRedirect, authURL)
 }
 
-// GoogleCallback handles Google OAuth callback
-// @Summary Handle Google OAuth callback
-// @Description Processes Google OAuth response and creates/logs in user
+// Callback handles the provider's OAuth callback
+// @Summary Handle OAuth callback
+// @Description Processes the provider's response and creates/links/logs in the user
 // @Tags auth
-// @Param code query string true "Authorization code from Google"
+// @Param provider path string true "Provider name"
+// @Param code query string true "Authorization code from the provider"
 // @Param state query string true "State for CSRF protection"
-// @Success 302 {string} string "Redirect to frontend with token"
+// @Success 302 {string} string "Redirect to frontend with a one-time exchange code"
 // @Failure 400 {object} gin.H
-// @Router /auth/google/callback [get]
-func (h *OAuthHandler) GoogleCallback(c *gin.Context) {
+// @Router /auth/{provider}/callback [get]
+func (h *OAuthHandler) Callback(c *gin.Context) {
 	// 1. Verify state for CSRF protection
 	stateFromQuery := c.Query("state")
 	stateFromCookie, err := c.Cookie("oauth_state")
@@ -101,22 +137,169 @@ func (h *OAuthHandler) GoogleCallback(c *gin.Context) {
 	}
 
 	// 4. Exchange code for user info and create/login user
-	authResponse, err := h.oauthService.HandleGoogleCallback(code)
+	exchangeCode, err := h.oauthService.HandleCallback(c.Param("provider"), code, stateFromQuery)
 	if err != nil {
 		h.redirectToFrontendWithError(c, "auth_failed", err.Error())
 		return
 	}
 
-	// 5. Redirect to frontend with tokens
-	redirectURL := fmt.Sprintf("%s/auth/callback?access_token=%s&refresh_token=%s",
+	// 5. Redirect to frontend with a one-time code; it trades it via POST /auth/exchange
+	redirectURL := fmt.Sprintf("%s/auth/callback?code=%s",
 		h.frontendURL,
-		authResponse.AccessToken,
-		authResponse.RefreshToken,
+		url.QueryEscape(exchangeCode),
 	)
 
 	c.Redirect(http.StatusTemporaryRedirect, redirectURL)
 }
 
+// Exchange handles POST /auth/exchange
+// @Summary Exchange OAuth login code
+// @Description Trade the one-time code from the OAuth callback redirect for tokens. Codes expire after a minute. If 2FA is enabled, returns an MFA challenge instead, as login does.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body ExchangeInput true "Code from the callback redirect"
+// @Success 200 {object} services.AuthResponse "or services.MFAChallenge when 2FA is enabled"
+// @Failure 400 {object} gin.H
+// @Failure 401,403 {object} gin.H
+// @Router /auth/exchange [post]
+func (h *OAuthHandler) Exchange(c *gin.Context) {
+	var input ExchangeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, challenge, err := h.oauthService.ExchangeCode(input.Code, deviceInfo(c, ""))
+	if err != nil {
+		respondLoginError(c, err)
+		return
+	}
+
+	// 2FA enabled - client must continue with POST /auth/2fa/verify
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	h.cookies.respond(c, http.StatusOK, response)
+}
+
+// LinkURL handles GET /auth/link/:provider
+// @Summary Start linking a provider account
+// @Description Returns the consent URL. The provider redirects to the frontend link page, which posts code and state to POST /auth/link/{provider}.
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /auth/link/{provider} [get]
+func (h *OAuthHandler) LinkURL(c *gin.Context) {
+	provider := c.Param("provider")
+	if _, err := oauth.Get(provider); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	authURL, state, err := h.oauthService.GetLinkURL(provider, middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start linking"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"auth_url": authURL,
+		"state":    state,
+	})
+}
+
+// Link handles POST /auth/link/:provider
+// @Summary Link a provider account
+// @Description Attach the provider account that issued the code to the current user
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param input body LinkInput true "Code and state from the provider"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Router /auth/link/{provider} [post]
+func (h *OAuthHandler) Link(c *gin.Context) {
+	provider := c.Param("provider")
+	if _, err := oauth.Get(provider); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var input LinkInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	identity, err := h.oauthService.Link(provider, middleware.GetUserID(c), input.Code, input.State, deviceInfo(c, ""))
+	if err != nil {
+		status := http.StatusBadRequest
+		if strings.Contains(err.Error(), "already linked") {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Account linked",
+		"identity": identity,
+	})
+}
+
+// ListIdentities handles GET /auth/identities
+// @Summary List login methods
+// @Description Whether a password is set and which external accounts are linked
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} services.LoginMethods
+// @Router /auth/identities [get]
+func (h *OAuthHandler) ListIdentities(c *gin.Context) {
+	methods, err := h.identityService.ListLoginMethods(middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, methods)
+}
+
+// Unlink handles DELETE /auth/link/:provider
+// @Summary Unlink an external account
+// @Description Remove a linked provider. Refused if it's the only way left to log in.
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Param provider path string true "Provider name, e.g. google"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /auth/link/{provider} [delete]
+func (h *OAuthHandler) Unlink(c *gin.Context) {
+	err := h.identityService.UnlinkIdentity(middleware.GetUserID(c), c.Param("provider"), deviceInfo(c, ""))
+	if err != nil {
+		status := http.StatusBadRequest
+		if err.Error() == "identity not found" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlinked"})
+}
+
 // redirectToFrontendWithError redirects to frontend error page
 func (h *OAuthHandler) redirectToFrontendWithError(c *gin.Context, errorCode, errorMessage string) {
 	redirectURL := fmt.Sprintf("%s/auth/error?code=%s&message=%s",
@@ -126,12 +309,3 @@ func (h *OAuthHandler) redirectToFrontendWithError(c *gin.Context, errorCode, er
 	)
 	c.Redirect(http.StatusTemporaryRedirect, redirectURL)
 }
-
-// generateRandomState generates a random state string for CSRF protection
-func generateRandomState() (string, error) {
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
-	}
-	return base64.URLEncoding.EncodeToString(b), nil
-}
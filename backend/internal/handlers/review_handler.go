@@ -38,6 +38,31 @@ func (h *ReviewHandler) CreateReview(c *gin.Context) {
 	c.JSON(http.StatusCreated, review)
 }
 
+// RateMovie handles PUT /api/v1/movies/:id/rating
+// Rating without a written review - the only way guests can rate
+func (h *ReviewHandler) RateMovie(c *gin.Context) {
+	movieID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid movie ID"})
+		return
+	}
+
+	var input services.RateMovieInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	review, err := h.reviewService.RateMovie(movieID, userID, input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, review)
+}
+
 // GetReview handles GET /api/v1/reviews/:id
 func (h *ReviewHandler) GetReview(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
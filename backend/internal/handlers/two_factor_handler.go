@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"net/http"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/middleware"
+	"filmfolk/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TwoFactorHandler handles TOTP two-factor authentication requests
+type TwoFactorHandler struct {
+	twoFactorService *services.TwoFactorService
+	cookies          *sessionCookies
+}
+
+// NewTwoFactorHandler creates a new two-factor handler
+func NewTwoFactorHandler(cfg *config.Config) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactorService: services.NewTwoFactorService(cfg),
+		cookies:          newSessionCookies(cfg),
+	}
+}
+
+// Setup handles POST /auth/2fa/setup
+// @Summary Start 2FA enrollment
+// @Description Generate a TOTP secret and otpauth URI for an authenticator app
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} services.TwoFactorSetup
+// @Failure 400 {object} gin.H
+// @Router /auth/2fa/setup [post]
+func (h *TwoFactorHandler) Setup(c *gin.Context) {
+	setup, err := h.twoFactorService.Setup(middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+// Confirm handles POST /auth/2fa/confirm
+// @Summary Confirm 2FA enrollment
+// @Description Enable 2FA with a code from the authenticator app. Returns recovery codes once.
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body services.ConfirmTwoFactorInput true "Authenticator code"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Router /auth/2fa/confirm [post]
+func (h *TwoFactorHandler) Confirm(c *gin.Context) {
+	var input services.ConfirmTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.twoFactorService.Confirm(middleware.GetUserID(c), input.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// Disable handles POST /auth/2fa/disable
+// @Summary Disable 2FA
+// @Description Remove the authenticator app. Requires the password and a current or recovery code. Passkeys remain a second factor.
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body services.DisableTwoFactorInput true "Password and code"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Router /auth/2fa/disable [post]
+func (h *TwoFactorHandler) Disable(c *gin.Context) {
+	var input services.DisableTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	passkeysRemain, err := h.twoFactorService.Disable(middleware.GetUserID(c), input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if passkeysRemain {
+		c.JSON(http.StatusOK, gin.H{
+			"message":            "Authenticator app removed. Your passkeys still act as a second factor",
+			"two_factor_enabled": true,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled", "two_factor_enabled": false})
+}
+
+// Verify handles POST /auth/2fa/verify
+// @Summary Complete 2FA login
+// @Description Exchange the MFA challenge token and a TOTP or recovery code for tokens
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body services.VerifyMFAInput true "Challenge token and code"
+// @Success 200 {object} services.AuthResponse
+// @Failure 400,401,403,429 {object} gin.H
+// @Router /auth/2fa/verify [post]
+func (h *TwoFactorHandler) Verify(c *gin.Context) {
+	var input services.VerifyMFAInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.twoFactorService.VerifyLogin(input, deviceInfo(c, ""))
+	if err != nil {
+		respondLoginError(c, err)
+		return
+	}
+
+	h.cookies.respond(c, http.StatusOK, response)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"filmfolk/internal/middleware"
+	"filmfolk/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WatchlistHandler struct {
+	watchlistService *services.WatchlistService
+}
+
+func NewWatchlistHandler() *WatchlistHandler {
+	return &WatchlistHandler{
+		watchlistService: services.NewWatchlistService(),
+	}
+}
+
+// GetWatchlist handles GET /api/v1/me/watchlist
+func (h *WatchlistHandler) GetWatchlist(c *gin.Context) {
+	items, err := h.watchlistService.GetWatchlist(middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"watchlist": items})
+}
+
+// AddToWatchlist handles POST /api/v1/me/watchlist/:movieId
+func (h *WatchlistHandler) AddToWatchlist(c *gin.Context) {
+	movieID, err := strconv.ParseUint(c.Param("movieId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid movie ID"})
+		return
+	}
+
+	if err := h.watchlistService.AddToWatchlist(middleware.GetUserID(c), movieID); err != nil {
+		status := http.StatusBadRequest
+		if err.Error() == "movie not found" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Added to watchlist"})
+}
+
+// RemoveFromWatchlist handles DELETE /api/v1/me/watchlist/:movieId
+func (h *WatchlistHandler) RemoveFromWatchlist(c *gin.Context) {
+	movieID, err := strconv.ParseUint(c.Param("movieId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid movie ID"})
+		return
+	}
+
+	if err := h.watchlistService.RemoveFromWatchlist(middleware.GetUserID(c), movieID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Removed from watchlist"})
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/middleware"
+	"filmfolk/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebAuthnHandler handles passkey registration and sign-in
+type WebAuthnHandler struct {
+	webAuthnService *services.WebAuthnService
+	cookies         *sessionCookies
+}
+
+// NewWebAuthnHandler creates a new WebAuthn handler
+func NewWebAuthnHandler(cfg *config.Config) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		webAuthnService: services.NewWebAuthnService(cfg),
+		cookies:         newSessionCookies(cfg),
+	}
+}
+
+// RegisterBegin handles POST /auth/webauthn/register/begin
+// @Summary Start passkey registration
+// @Description Returns the options for navigator.credentials.create
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} protocol.CredentialCreation
+// @Failure 400 {object} gin.H
+// @Router /auth/webauthn/register/begin [post]
+func (h *WebAuthnHandler) RegisterBegin(c *gin.Context) {
+	options, err := h.webAuthnService.BeginRegistration(middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// RegisterFinish handles POST /auth/webauthn/register/finish
+// @Summary Finish passkey registration
+// @Description Verify the new credential from navigator.credentials.create and store it
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body services.RegisterPasskeyInput true "Credential and optional name"
+// @Success 201 {object} models.WebAuthnCredential
+// @Failure 400 {object} gin.H
+// @Router /auth/webauthn/register/finish [post]
+func (h *WebAuthnHandler) RegisterFinish(c *gin.Context) {
+	var input services.RegisterPasskeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	credential, err := h.webAuthnService.FinishRegistration(middleware.GetUserID(c), input, deviceInfo(c, ""))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, credential)
+}
+
+// LoginBegin handles POST /auth/webauthn/login/begin
+// @Summary Start passkey login
+// @Description Returns the options for navigator.credentials.get. Without a body any passkey can sign in;
+// @Description with the mfa_token from a password login, one of that user's passkeys answers the 2FA challenge.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body services.BeginPasskeyLoginInput false "Optional MFA challenge token"
+// @Success 200 {object} protocol.CredentialAssertion
+// @Failure 400 {object} gin.H
+// @Router /auth/webauthn/login/begin [post]
+func (h *WebAuthnHandler) LoginBegin(c *gin.Context) {
+	var input services.BeginPasskeyLoginInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	options, err := h.webAuthnService.BeginLogin(input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// LoginFinish handles POST /auth/webauthn/login/finish
+// @Summary Finish passkey login
+// @Description Verify the assertion from navigator.credentials.get and issue tokens
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body services.FinishPasskeyLoginInput true "Credential, plus the mfa_token when answering a 2FA challenge"
+// @Success 200 {object} services.AuthResponse
+// @Failure 400,401,403,429 {object} gin.H
+// @Router /auth/webauthn/login/finish [post]
+func (h *WebAuthnHandler) LoginFinish(c *gin.Context) {
+	var input services.FinishPasskeyLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.webAuthnService.FinishLogin(input, deviceInfo(c, ""))
+	if err != nil {
+		respondLoginError(c, err)
+		return
+	}
+
+	h.cookies.respond(c, http.StatusOK, response)
+}
+
+// ListCredentials handles GET /auth/webauthn/credentials
+// @Summary List passkeys
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} gin.H
+// @Router /auth/webauthn/credentials [get]
+func (h *WebAuthnHandler) ListCredentials(c *gin.Context) {
+	credentials, err := h.webAuthnService.ListCredentials(middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"passkeys": credentials})
+}
+
+// DeleteCredential handles DELETE /auth/webauthn/credentials/:id
+// @Summary Remove a passkey
+// @Description Refused if it is the account's only login method
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Passkey ID"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Router /auth/webauthn/credentials/{id} [delete]
+func (h *WebAuthnHandler) DeleteCredential(c *gin.Context) {
+	credentialID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey ID"})
+		return
+	}
+
+	if err := h.webAuthnService.DeleteCredential(middleware.GetUserID(c), credentialID, deviceInfo(c, "")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey removed"})
+}
@@ -0,0 +1,75 @@
+package mailer
+
+import (
+	"fmt"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/utils"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails
+// Implementations: SMTPMailer for real delivery, OutboxMailer for development and tests
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// current is the mailer used by the application
+// Package-level like db.DB so services can send mail without wiring
+var current Mailer
+
+// InitMailer creates the mailer selected by configuration
+// Call this once at app startup
+func InitMailer(cfg *config.Config) error {
+	switch cfg.Mail.Driver {
+	case "smtp":
+		current = NewSMTPMailer(
+			cfg.Mail.SMTPHost,
+			cfg.Mail.SMTPPort,
+			cfg.Mail.SMTPUsername,
+			cfg.Mail.SMTPPassword,
+			cfg.Mail.From,
+		)
+	case "outbox":
+		current = NewOutboxMailer(cfg.Mail.OutboxDir)
+	default:
+		return fmt.Errorf("unknown mail driver: %s", cfg.Mail.Driver)
+	}
+	return nil
+}
+
+// SetMailer replaces the application mailer (e.g. with an outbox in tests)
+func SetMailer(m Mailer) {
+	current = m
+}
+
+// Send delivers a message through the application mailer
+func Send(msg Message) error {
+	if current == nil {
+		return fmt.Errorf("mailer not initialized")
+	}
+	return current.Send(msg)
+}
+
+// SendAsync delivers a message in the background and logs a failed delivery
+// For mail whose outcome must not show in the response, e.g. whether an account exists
+func SendAsync(msg Message) {
+	m := current
+	go func() {
+		var err error
+		if m == nil {
+			err = fmt.Errorf("mailer not initialized")
+		} else {
+			err = m.Send(msg)
+		}
+		if err != nil {
+			utils.GetLogger().Error().Err(err).Str("subject", msg.Subject).Msg("Failed to send email")
+		}
+	}()
+}
@@ -1,9 +1,15 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
+	"filmfolk/internal/models"
+	"filmfolk/internal/revocation"
+	"filmfolk/internal/services"
 	"filmfolk/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -11,8 +17,19 @@ import (
 
 // AuthMiddleware validates JWT tokens and adds user info to context
 // This is the gatekeeper for protected routes
-func AuthMiddleware() gin.HandlerFunc {
+// Personal access tokens are accepted only if scopes are given and the token holds all
+// of them; without scopes the route needs a login session
+// Sessions in either mode send the access token as a bearer token. In cookie mode the
+// browser adds the session cookie on /auth routes, and then state-changing requests
+// must carry the CSRF token as well
+func AuthMiddleware(scopes ...models.TokenScope) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if !checkCSRF(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid CSRF token"})
+			c.Abort()
+			return
+		}
+
 		// 1. Extract token from Authorization header
 		// Format: "Bearer <token>"
 		authHeader := c.GetHeader("Authorization")
@@ -32,7 +49,18 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		tokenString := parts[1]
 
-		// 3. Validate and parse token
+		// 3. Personal access tokens - only where the route group allows them
+		if strings.HasPrefix(tokenString, models.AccessTokenPrefix) {
+			if status, err := authenticateAccessToken(c, tokenString, scopes); err != nil {
+				c.JSON(status, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		// 4. Validate and parse token
 		claims, err := utils.ValidateToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
@@ -40,13 +68,29 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 4. Add user info to context for handlers to use
+		// 5. Reject revoked tokens (logout, revoked session, ban, sign-out everywhere)
+		// A validly signed token that was revoked may have been stolen, so it goes in the audit log
+		if isTokenRevoked(claims) {
+			userID := claims.UserID
+			services.RecordSecurityEvent(models.SecurityEvent{
+				UserID:    &userID,
+				EventType: models.EventRevokedTokenUsed,
+				Details:   map[string]string{"session_id": claims.SessionID, "path": c.FullPath()},
+			}, services.DeviceInfo{
+				UserAgent: c.Request.UserAgent(),
+				IPAddress: c.ClientIP(),
+				RequestID: c.GetString("requestID"),
+			})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+
+		// 6. Add user info to context for handlers to use
 		// Handlers can now access: c.Get("userID"), c.Get("userRole"), etc.
-		c.Set("userID", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("email", claims.Email)
+		setClaimsContext(c, claims)
 
-		// 5. Continue to next handler
+		// 7. Continue to next handler
 		c.Next()
 	}
 }
@@ -54,7 +98,8 @@ func AuthMiddleware() gin.HandlerFunc {
 // OptionalAuthMiddleware tries to authenticate but doesn't block if token is missing
 // Useful for routes that change behavior based on whether user is logged in
 // Example: Guest users can view reviews, but can't like them
-func OptionalAuthMiddleware() gin.HandlerFunc {
+// Personal access tokens without the given scopes are ignored like invalid tokens
+func OptionalAuthMiddleware(scopes ...models.TokenScope) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -71,24 +116,150 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString := parts[1]
+		if strings.HasPrefix(tokenString, models.AccessTokenPrefix) {
+			// Sets the context only on success; otherwise continue as guest
+			authenticateAccessToken(c, tokenString, scopes)
+			c.Next()
+			return
+		}
+
 		claims, err := utils.ValidateToken(tokenString)
-		if err != nil {
+		if err != nil || isTokenRevoked(claims) {
 			// Invalid token, but don't block - continue as guest
 			c.Next()
 			return
 		}
 
 		// Valid token - add user info to context
-		c.Set("userID", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("email", claims.Email)
+		setClaimsContext(c, claims)
 
+		c.Next()
+	}
+}
+
+// setClaimsContext puts the user info from an access token into context
+func setClaimsContext(c *gin.Context, claims *utils.JWTClaims) {
+	c.Set("userID", claims.UserID)
+	c.Set("username", claims.Username)
+	c.Set("email", claims.Email)
+	c.Set("userRole", models.UserRole(claims.Role))
+	c.Set("sessionID", claims.SessionID)
+	c.Set("emailVerified", claims.EmailVerified)
+	c.Set("guest", claims.Guest)
+	c.Set("tokenID", claims.ID)
+	if claims.ExpiresAt != nil {
+		c.Set("tokenExpiresAt", claims.ExpiresAt.Time)
+	}
+}
+
+// authenticateAccessToken checks a personal access token against the route's scopes
+// On success the user info goes into context; otherwise returns the status to respond with
+func authenticateAccessToken(c *gin.Context, tokenString string, scopes []models.TokenScope) (int, error) {
+	if len(scopes) == 0 {
+		return http.StatusForbidden, errors.New("Personal access tokens can't be used here")
+	}
+
+	user, token, err := services.NewAccessTokenService().Authenticate(tokenString, c.ClientIP())
+	var statusErr *services.AccountStatusError
+	if errors.As(err, &statusErr) {
+		return http.StatusForbidden, err
+	}
+	if err != nil {
+		return http.StatusUnauthorized, errors.New("Invalid or expired token")
+	}
+
+	for _, scope := range scopes {
+		if !token.HasScope(scope) {
+			return http.StatusForbidden, fmt.Errorf("Token is missing the %s scope", scope)
+		}
+	}
+
+	c.Set("userID", user.ID)
+	c.Set("username", user.Username)
+	c.Set("email", user.Email)
+	c.Set("userRole", user.Role)
+	c.Set("emailVerified", user.IsEmailVerified())
+	c.Set("guest", user.IsGuest())
+	c.Set("accessTokenID", token.ID)
+	return 0, nil
+}
+
+// isTokenRevoked checks an access token against the revocation store
+// Fails closed: if revocation state can't be loaded the token is not trusted
+func isTokenRevoked(claims *utils.JWTClaims) bool {
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+
+	revoked, err := revocation.IsRevoked(claims.UserID, claims.ID, claims.SessionID, issuedAt)
+	if err != nil {
+		utils.GetLogger().Error().Err(err).Uint64("user_id", claims.UserID).Msg("Failed to check token revocation")
+		return true
+	}
+	return revoked
+}
+
+// RequireRole restricts a route to users holding one of the given roles
+// Must run after AuthMiddleware, which puts the role from the token into context
+// The role is only as fresh as the access token - changes apply on next refresh
+func RequireRole(roles ...models.UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := GetUserRole(c)
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		c.Abort()
+	}
+}
+
+// RequireFullAccount blocks guest accounts
+// Guests may keep a watchlist and rate movies; commenting and following need a real account
+// Must run after AuthMiddleware
+func RequireFullAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if IsGuest(c) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Guest accounts can't do this",
+				"message": "Create an account to continue - everything you did as a guest is kept.",
+			})
+			c.Abort()
+			return
+		}
 
 		c.Next()
 	}
 }
 
+// RequireVerifiedEmail applies the configured policy for unverified accounts
+// Policies: "full" (no restriction), "read_only" (safe methods only), "none" (blocked)
+// Must run after AuthMiddleware. Not applied to /auth routes so users can still verify and log out.
+func RequireVerifiedEmail(policy string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Guests have no email to verify; RequireFullAccount limits them instead
+		if policy == "full" || c.GetBool("emailVerified") || IsGuest(c) {
+			c.Next()
+			return
+		}
+
+		readOnly := c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead
+		if policy == "read_only" && readOnly {
+			c.Next()
+			return
+		}
 
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Email verification required",
+			"message": "Please confirm your email address to continue.",
+		})
+		c.Abort()
+	}
+}
 
 // GetUserID is a helper to extract user ID from context
 // Returns 0 if not authenticated
@@ -101,6 +272,33 @@ func GetUserID(c *gin.Context) uint64 {
 	return 0
 }
 
+// GetUserRole is a helper to extract the user's role from context
+// Returns an empty role if not authenticated
+func GetUserRole(c *gin.Context) models.UserRole {
+	if role, exists := c.Get("userRole"); exists {
+		if r, ok := role.(models.UserRole); ok {
+			return r
+		}
+	}
+	return ""
+}
+
+// GetSessionID is a helper to extract the current session (refresh token family) ID
+// Returns an empty string if not authenticated
+func GetSessionID(c *gin.Context) string {
+	return c.GetString("sessionID")
+}
+
+// GetTokenID is a helper to extract the ID (jti) and expiry of the request's access token
+// Returns an empty ID for personal access tokens and unauthenticated requests
+func GetTokenID(c *gin.Context) (string, time.Time) {
+	return c.GetString("tokenID"), c.GetTime("tokenExpiresAt")
+}
+
+// IsGuest checks if the request was made with a guest account's token
+func IsGuest(c *gin.Context) bool {
+	return c.GetBool("guest")
+}
 
 // IsAuthenticated checks if the current request is authenticated
 func IsAuthenticated(c *gin.Context) bool {
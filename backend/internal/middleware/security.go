@@ -38,28 +38,31 @@ func CORSMiddleware(allowedOrigins []string, env string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		origin := c.Request.Header.Get("Origin")
 
-		// In development, allow all origins for easier testing
-		if env == "development" {
-			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		} else {
-			// In production, only allow specific origins
-			allowed := false
-			for _, allowedOrigin := range allowedOrigins {
-				if origin == allowedOrigin {
-					allowed = true
-					c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
-					break
-				}
+		// Only allowed origins may send cookies - echoing any origin back with
+		// credentials would let every site act as the signed-in user
+		allowed := false
+		for _, allowedOrigin := range allowedOrigins {
+			if origin == allowedOrigin {
+				allowed = true
+				c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+				c.Writer.Header().Add("Vary", "Origin")
+				c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+				break
 			}
+		}
 
-			if !allowed && len(allowedOrigins) > 0 {
+		if !allowed {
+			if env == "development" {
+				// In development, allow all origins for easier testing, without credentials
+				// (browsers refuse "*" for requests with cookies anyway)
+				c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+			} else if len(allowedOrigins) > 0 {
 				// If origin not allowed, don't set CORS headers
 				c.Writer.Header().Set("Access-Control-Allow-Origin", allowedOrigins[0])
 			}
 		}
 
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, X-Auth-Mode, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Request-ID")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
 		c.Writer.Header().Set("Access-Control-Max-Age", "86400") // 24 hours
 
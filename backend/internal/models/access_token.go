@@ -0,0 +1,72 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// TokenScope limits what a personal access token can do
+type TokenScope string
+
+const (
+	ScopeReviewsRead  TokenScope = "reviews:read"
+	ScopeReviewsWrite TokenScope = "reviews:write"
+	ScopeListsRead    TokenScope = "lists:read"
+	ScopeListsWrite   TokenScope = "lists:write"
+)
+
+// AccessTokenPrefix marks personal access tokens so they're never mistaken for JWTs
+// (and are easy to spot by secret scanners)
+const AccessTokenPrefix = "ffpat_"
+
+// IsValid reports whether s is one of the known scopes
+func (s TokenScope) IsValid() bool {
+	switch s {
+	case ScopeReviewsRead, ScopeReviewsWrite, ScopeListsRead, ScopeListsWrite:
+		return true
+	}
+	return false
+}
+
+// PersonalAccessToken is a long-lived token a user creates for scripts and integrations
+// Only the SHA-256 digest is stored; the token is shown once on creation
+type PersonalAccessToken struct {
+	ID          uint64       `gorm:"primarykey" json:"id"`
+	UserID      uint64       `gorm:"not null" json:"-"`
+	Name        string       `gorm:"type:varchar(100);not null" json:"name"`
+	TokenPrefix string       `gorm:"type:varchar(16);not null" json:"token_prefix"` // first characters, to recognize the token
+	TokenHash   string       `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	Scopes      []TokenScope `gorm:"type:jsonb;serializer:json;not null" json:"scopes"`
+	ExpiresAt   *time.Time   `json:"expires_at,omitempty"` // NULL = never expires
+	LastUsedAt  *time.Time   `json:"last_used_at,omitempty"`
+	LastUsedIP  *string      `gorm:"type:varchar(45)" json:"last_used_ip,omitempty"`
+	RevokedAt   *time.Time   `json:"-"`
+	CreatedAt   time.Time    `json:"created_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (PersonalAccessToken) TableName() string {
+	return "personal_access_tokens"
+}
+
+// IsValid checks if the token is still usable
+func (t *PersonalAccessToken) IsValid() bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt))
+}
+
+// HasScope checks if the token grants scope
+// A write scope includes the read scope of the same resource
+func (t *PersonalAccessToken) HasScope(scope TokenScope) bool {
+	for _, granted := range t.Scopes {
+		if granted == scope {
+			return true
+		}
+		resource, action, _ := strings.Cut(string(scope), ":")
+		if action == "read" && granted == TokenScope(resource+":write") {
+			return true
+		}
+	}
+	return false
+}
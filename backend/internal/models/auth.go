@@ -2,17 +2,31 @@ package models
 
 import "time"
 
-// RefreshToken stores JWT refresh tokens
+// RefreshToken tracks issued JWT refresh tokens (by digest only)
 // Why separate table? To allow token revocation and rotation
 // Access tokens are stateless (stored in memory), refresh tokens need persistence
 type RefreshToken struct {
-	ID        uint64    `gorm:"primarykey" json:"id"`
-	UserID    uint64    `gorm:"not null" json:"user_id"`
-	Token     string    `gorm:"type:text;uniqueIndex;not null" json:"-"` // Never expose in API
-	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        uint64     `gorm:"primarykey" json:"id"`
+	UserID    uint64     `gorm:"not null" json:"user_id"`
+	TokenHash string     `gorm:"type:char(64);uniqueIndex;not null" json:"-"` // SHA-256 of the token, never the token itself
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
 	RevokedAt *time.Time `json:"revoked_at,omitempty"` // NULL = still valid
 
+	// Rotation lineage
+	// All tokens descended from one login share a FamilyID
+	FamilyID     string  `gorm:"type:uuid;not null;index" json:"-"`
+	ParentID     *uint64 `json:"-"`
+	ReplacedByID *uint64 `json:"-"` // Set once rotated; presenting it again means reuse
+
+	// Device metadata for the session list
+	// Label and SessionStartedAt are carried over on rotation
+	UserAgent        string    `gorm:"type:text" json:"user_agent"`
+	IPAddress        string    `gorm:"type:varchar(45)" json:"ip_address"`
+	Label            *string   `gorm:"type:varchar(100)" json:"label,omitempty"`
+	SessionStartedAt time.Time `gorm:"not null" json:"session_started_at"`
+	LastUsedAt       time.Time `gorm:"not null" json:"last_used_at"`
+
 	// Relationships
 	User User `gorm:"foreignKey:UserID" json:"-"`
 }
@@ -28,3 +42,9 @@ func (rt *RefreshToken) IsValid() bool {
 	// 2. Not expired (ExpiresAt is in the future)
 	return rt.RevokedAt == nil && time.Now().Before(rt.ExpiresAt)
 }
+
+// IsRotated checks if the token was already exchanged for a newer one
+// A rotated token showing up again means it was copied - treat as theft
+func (rt *RefreshToken) IsRotated() bool {
+	return rt.ReplacedByID != nil
+}
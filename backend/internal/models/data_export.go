@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+type ExportStatus string
+
+const (
+	ExportPending    ExportStatus = "pending"
+	ExportProcessing ExportStatus = "processing"
+	ExportReady      ExportStatus = "ready"
+	ExportDownloaded ExportStatus = "downloaded"
+	ExportFailed     ExportStatus = "failed"
+	ExportExpired    ExportStatus = "expired"
+)
+
+// DataExport is an archive of a user's personal data
+// Built in the background; the file is deleted after the first download or when it expires
+type DataExport struct {
+	ID        uint64       `gorm:"primarykey" json:"id"`
+	UserID    uint64       `gorm:"not null;index" json:"-"`
+	Status    ExportStatus `gorm:"type:varchar(20);not null;default:pending" json:"status"`
+	FilePath  *string      `gorm:"type:text" json:"-"`
+	SizeBytes *int64       `json:"size_bytes,omitempty"`
+
+	CreatedAt    time.Time  `json:"created_at"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"` // download deadline once ready
+	DownloadedAt *time.Time `json:"downloaded_at,omitempty"`
+}
+
+func (DataExport) TableName() string {
+	return "data_exports"
+}
+
+// IsDownloadable checks if the archive is ready and hasn't expired
+func (e *DataExport) IsDownloadable() bool {
+	return e.Status == ExportReady && e.ExpiresAt != nil && time.Now().Before(*e.ExpiresAt)
+}
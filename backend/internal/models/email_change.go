@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// EmailChange is a requested change of a user's email address
+// The new address is only set once the link sent to it is used
+type EmailChange struct {
+	ID               uint64     `gorm:"primarykey" json:"id"`
+	UserID           uint64     `gorm:"not null" json:"-"`
+	OldEmail         string     `gorm:"type:varchar(255);not null" json:"old_email"`
+	NewEmail         string     `gorm:"type:varchar(255);not null" json:"new_email"`
+	ConfirmTokenHash string     `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	CancelTokenHash  string     `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	ExpiresAt        time.Time  `gorm:"not null" json:"expires_at"`
+	ConfirmedAt      *time.Time `json:"confirmed_at,omitempty"`
+	CancelledAt      *time.Time `json:"cancelled_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (EmailChange) TableName() string {
+	return "email_changes"
+}
+
+// IsPending checks if the change still waits for confirmation
+func (c *EmailChange) IsPending() bool {
+	return c.ConfirmedAt == nil && c.CancelledAt == nil && time.Now().Before(c.ExpiresAt)
+}
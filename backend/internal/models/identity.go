@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// UserIdentity links an external login (e.g. a Google account) to a user
+// A user can have one identity per provider, next to or instead of a password
+type UserIdentity struct {
+	ID             uint64     `gorm:"primarykey" json:"-"`
+	UserID         uint64     `gorm:"not null;index" json:"-"`
+	Provider       string     `gorm:"type:varchar(50);not null" json:"provider"`
+	ProviderUserID string     `gorm:"type:varchar(255);not null" json:"-"`
+	Email          *string    `gorm:"type:varchar(255)" json:"email,omitempty"`
+	CreatedAt      time.Time  `json:"linked_at"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+
+	User *User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// KnownDevice is a user agent + IP combination a user has signed in from
+// A sign-in from a combination not seen before sends a new-device alert
+type KnownDevice struct {
+	ID              uint64     `gorm:"primarykey" json:"id"`
+	UserID          uint64     `gorm:"not null;uniqueIndex:known_devices_user_device" json:"-"`
+	DeviceHash      string     `gorm:"type:char(64);not null;uniqueIndex:known_devices_user_device" json:"-"`
+	UserAgent       string     `gorm:"type:text" json:"user_agent"`
+	IPAddress       string     `gorm:"type:varchar(45)" json:"ip_address"`
+	ReportTokenHash *string    `gorm:"type:char(64);uniqueIndex" json:"-"` // "this wasn't me" link from the alert
+	ReportExpiresAt *time.Time `json:"-"`
+	FirstSeenAt     time.Time  `gorm:"not null" json:"first_seen_at"`
+	LastSeenAt      time.Time  `gorm:"not null" json:"last_seen_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (KnownDevice) TableName() string {
+	return "known_devices"
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// MagicLink is an emailed single-use sign-in link
+// Only the SHA-256 digests of the link token and the device token are stored
+type MagicLink struct {
+	ID         uint64     `gorm:"primarykey" json:"id"`
+	Email      string     `gorm:"type:varchar(255);not null" json:"email"`
+	UserID     *uint64    `json:"user_id,omitempty"` // NULL if no account existed when the link was sent
+	TokenHash  string     `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	DeviceHash string     `gorm:"type:char(64);not null" json:"-"`
+	IPAddress  string     `gorm:"type:varchar(45)" json:"ip_address,omitempty"`
+	UserAgent  string     `gorm:"type:text" json:"user_agent,omitempty"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt     *time.Time `json:"used_at,omitempty"` // NULL = not used yet
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (MagicLink) TableName() string {
+	return "magic_links"
+}
+
+// IsValid checks if the link can still be used
+func (l *MagicLink) IsValid() bool {
+	return l.UsedAt == nil && time.Now().Before(l.ExpiresAt)
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// OAuthFlowPurpose says what a started OAuth flow is for
+type OAuthFlowPurpose string
+
+const (
+	OAuthFlowLogin OAuthFlowPurpose = "login"
+	OAuthFlowLink  OAuthFlowPurpose = "link"
+)
+
+// OAuthFlow is an authorization request waiting for the provider callback
+// Keeps the PKCE verifier and nonce server-side; looked up by state digest and used once
+type OAuthFlow struct {
+	ID           uint64           `gorm:"primarykey" json:"id"`
+	StateHash    string           `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	Provider     string           `gorm:"type:varchar(50);not null" json:"provider"`
+	Purpose      OAuthFlowPurpose `gorm:"type:varchar(10);not null" json:"purpose"`
+	UserID       *uint64          `json:"user_id,omitempty"` // set for link flows: the user who started it
+	CodeVerifier string           `gorm:"type:varchar(128);not null" json:"-"`
+	Nonce        string           `gorm:"type:varchar(64);not null" json:"-"`
+	ExpiresAt    time.Time        `gorm:"not null" json:"expires_at"`
+	CreatedAt    time.Time        `json:"created_at"`
+}
+
+func (OAuthFlow) TableName() string {
+	return "oauth_flows"
+}
+
+// IsExpired checks if the user took too long at the provider
+func (f *OAuthFlow) IsExpired() bool {
+	return !time.Now().Before(f.ExpiresAt)
+}
@@ -47,6 +47,11 @@ func (Review) TableName() string {
 	return "reviews"
 }
 
+// IsRatingOnly reports whether the user only rated the movie without writing a review
+func (r *Review) IsRatingOnly() bool {
+	return r.ReviewText == ""
+}
+
 type ReviewComment struct {
 	ID              uint64  `gorm:"primarykey" json:"id"`
 	ReviewID        uint64  `gorm:"not null" json:"review_id"`
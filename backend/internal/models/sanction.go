@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+type SanctionAction string
+
+const (
+	SanctionSuspend   SanctionAction = "suspend"
+	SanctionBan       SanctionAction = "ban"
+	SanctionReinstate SanctionAction = "reinstate" // lifted early by an admin
+	SanctionExpire    SanctionAction = "expire"    // suspension ran out
+)
+
+// AccountSanction is one entry in a user's sanctions history
+type AccountSanction struct {
+	ID      uint64         `gorm:"primarykey" json:"id"`
+	UserID  uint64         `gorm:"not null;index" json:"user_id"`
+	Action  SanctionAction `gorm:"type:varchar(20);not null" json:"action"`
+	Reason  *string        `gorm:"type:text" json:"reason,omitempty"`
+	EndsAt  *time.Time     `json:"ends_at,omitempty"`
+	ActorID *uint64        `json:"actor_id,omitempty"` // NULL when the system acted
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (AccountSanction) TableName() string {
+	return "account_sanctions"
+}
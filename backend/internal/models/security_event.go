@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+type SecurityEventType string
+
+const (
+	EventRegister          SecurityEventType = "register"
+	EventLogin             SecurityEventType = "login"
+	EventLoginFailed       SecurityEventType = "login_failed"
+	EventTokenRefresh      SecurityEventType = "token_refresh"
+	EventRefreshTokenReuse SecurityEventType = "refresh_token_reuse"
+	EventRevokedTokenUsed  SecurityEventType = "revoked_token_used"
+	EventLogout            SecurityEventType = "logout"
+	EventSessionRevoked    SecurityEventType = "session_revoked"
+	EventSessionsRevoked   SecurityEventType = "all_sessions_revoked"
+	EventOAuthLinked       SecurityEventType = "oauth_linked"
+	EventOAuthUnlinked     SecurityEventType = "oauth_unlinked"
+	EventPasswordChanged   SecurityEventType = "password_changed"
+	EventPasswordReset     SecurityEventType = "password_reset"
+	EventRoleChanged       SecurityEventType = "role_changed"
+	EventPasskeyRegistered SecurityEventType = "passkey_registered"
+	EventPasskeyRemoved    SecurityEventType = "passkey_removed"
+
+	EventEmailChangeRequested SecurityEventType = "email_change_requested"
+	EventEmailChanged         SecurityEventType = "email_changed"
+	EventEmailChangeCancelled SecurityEventType = "email_change_cancelled"
+)
+
+// SecurityEvent is one entry in the security audit log
+// Entries are written once and never changed (enforced by a DB trigger)
+type SecurityEvent struct {
+	ID        uint64            `gorm:"primarykey" json:"id"`
+	UserID    *uint64           `gorm:"index" json:"user_id,omitempty"` // NULL for failed logins with an unknown email
+	ActorID   *uint64           `json:"actor_id,omitempty"`             // set when someone else acted on the user
+	EventType SecurityEventType `gorm:"type:varchar(50);not null" json:"event_type"`
+	IPAddress string            `gorm:"type:varchar(45)" json:"ip_address,omitempty"`
+	UserAgent string            `gorm:"type:text" json:"user_agent,omitempty"`
+	RequestID string            `gorm:"type:varchar(100)" json:"request_id,omitempty"`
+	Details   map[string]string `gorm:"type:jsonb;serializer:json;not null" json:"details,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (SecurityEvent) TableName() string {
+	return "security_events"
+}
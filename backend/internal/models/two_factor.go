@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// RecoveryCode is a one-time backup code for logging in without the authenticator app
+// Only the SHA-256 digest is stored; codes are shown to the user once
+type RecoveryCode struct {
+	ID        uint64     `gorm:"primarykey" json:"id"`
+	UserID    uint64     `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"type:char(64);not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"` // NULL = still usable
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -8,6 +9,7 @@ import (
 
 type AuthProvider string
 type AccountStatus string
+type UserRole string
 
 const (
 	AuthEmail     AuthProvider = "email"
@@ -16,22 +18,54 @@ const (
 	AuthInstagram AuthProvider = "instagram"
 	AuthTwitter   AuthProvider = "twitter"
 	AuthGuest     AuthProvider = "guest"
+	AuthMagicLink AuthProvider = "magic_link" // created by signing in with an emailed link
+	AuthSystem    AuthProvider = "system"     // accounts nobody logs into, like the deleted user
 )
 
+// DeletedUserUsername is the account content of hard-deleted users is reattributed to
+// On databases where a user already had the name, the placeholder got a suffix
+const DeletedUserUsername = "deleted_user"
+
+// DeletedUserEmail identifies the deleted user placeholder, together with AuthSystem
+const DeletedUserEmail = "deleted-user@filmfolk.invalid"
+
+// IsReservedUsername checks if a username is kept for system accounts
+// Covers the deleted user placeholder and anonymized accounts (deleted_...), in any case
+func IsReservedUsername(username string) bool {
+	return strings.HasPrefix(strings.ToLower(username), "deleted_")
+}
+
 const (
 	StatusActive    AccountStatus = "active"
 	StatusSuspended AccountStatus = "suspended"
 	StatusBanned    AccountStatus = "banned"
+	StatusDeleted   AccountStatus = "deleted" // anonymized after a deletion request
 )
 
+const (
+	RoleUser      UserRole = "user"
+	RoleModerator UserRole = "moderator"
+	RoleAdmin     UserRole = "admin"
+)
+
+// IsValid reports whether r is one of the known roles
+func (r UserRole) IsValid() bool {
+	switch r {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
 type User struct {
 	ID           uint64        `gorm:"primarykey" json:"id"`
 	Username     string        `gorm:"uniqueIndex;not null" json:"username"`
 	Email        string        `gorm:"uniqueIndex;not null" json:"email"`
 	PasswordHash *string       `gorm:"type:text" json:"-"`
-	AuthProvider AuthProvider  `gorm:"type:auth_provider;not null;default:email" json:"auth_provider"`
+	AuthProvider AuthProvider  `gorm:"type:varchar(50);not null;default:email" json:"auth_provider"`
 	ProviderID   *string       `gorm:"type:varchar(255)" json:"-"`
 	Status       AccountStatus `gorm:"type:account_status;not null;default:active" json:"status"`
+	Role         UserRole      `gorm:"type:user_role;not null;default:user" json:"role"`
 	AvatarURL    *string       `gorm:"type:text" json:"avatar_url,omitempty"`
 	Bio          *string       `gorm:"type:text" json:"bio,omitempty"`
 
@@ -42,6 +76,35 @@ type User struct {
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+
+	// NULL until the user clicks the link in the verification email
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+
+	// Two-factor authentication (TOTP)
+	// The secret is stored at setup and only enforced once confirmed (TwoFactorEnabledAt set)
+	TOTPSecret         *string    `gorm:"type:varchar(64)" json:"-"`
+	TOTPLastStep       int64      `gorm:"not null;default:0" json:"-"` // Last accepted time step, blocks code replay
+	TwoFactorEnabledAt *time.Time `json:"two_factor_enabled_at,omitempty"`
+
+	// WebAuthn user.id stored on the user's passkeys, random so it identifies nothing
+	// Set when the first passkey is registered
+	WebAuthnUserHandle []byte `gorm:"type:bytea;uniqueIndex" json:"-"`
+
+	// Brute-force protection
+	FailedLoginCount  int        `gorm:"not null;default:0" json:"-"`
+	LastFailedLoginAt *time.Time `json:"-"`
+	LockedUntil       *time.Time `json:"-"` // NULL or past = not locked
+
+	// Access tokens issued before this time are rejected
+	// Bumped on status change (DB trigger) and when all sessions are revoked
+	TokensValidAfter *time.Time `json:"-"`
+
+	// Set when the user asks to delete the account; cleared if they cancel in time
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+
+	// Current sanction, set by an admin (history is in account_sanctions)
+	StatusReason   *string    `gorm:"type:text" json:"status_reason,omitempty"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"` // NULL for bans
 }
 
 func (User) TableName() string {
@@ -57,6 +120,37 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// IsEmailVerified checks if the user has confirmed their email address
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// IsGuest checks if this is a guest account that hasn't been upgraded yet
+func (u *User) IsGuest() bool {
+	return u.AuthProvider == AuthGuest
+}
+
+// IsDeletionScheduled checks if the account is waiting out the deletion grace period
+func (u *User) IsDeletionScheduled() bool {
+	return u.DeletionScheduledAt != nil
+}
+
+// IsSuspensionOver checks if a suspension has run out and just hasn't been lifted yet
+func (u *User) IsSuspensionOver() bool {
+	return u.Status == StatusSuspended && u.SuspendedUntil != nil && !time.Now().Before(*u.SuspendedUntil)
+}
+
+// IsTwoFactorEnabled checks if the authenticator app (TOTP) is set up as a second factor
+func (u *User) IsTwoFactorEnabled() bool {
+	return u.TwoFactorEnabledAt != nil && u.TOTPSecret != nil
+}
+
+// IsMFAEnabled checks if login requires a second factor
+// Registered passkeys count as one, next to the authenticator app
+func (u *User) IsMFAEnabled(passkeys int64) bool {
+	return u.IsTwoFactorEnabled() || passkeys > 0
+}
+
 // UserPublic represents public user info for API responses
 type UserPublic struct {
 	ID             uint64    `json:"id"`
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+type TokenPurpose string
+
+const (
+	PurposeEmailVerification TokenPurpose = "email_verification"
+	PurposePasswordReset     TokenPurpose = "password_reset"
+	PurposeAccountUnlock     TokenPurpose = "account_unlock"
+	PurposeOAuthExchange     TokenPurpose = "oauth_exchange" // one-time code handed to the frontend after OAuth login
+)
+
+// VerificationToken is a single-use secret sent to a user by email
+// Only the SHA-256 digest is stored, like refresh tokens
+type VerificationToken struct {
+	ID        uint64       `gorm:"primarykey" json:"id"`
+	UserID    uint64       `gorm:"not null" json:"user_id"`
+	Purpose   TokenPurpose `gorm:"type:varchar(50);not null" json:"purpose"`
+	TokenHash string       `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time    `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time   `json:"used_at,omitempty"` // NULL = not used yet
+	CreatedAt time.Time    `json:"created_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (VerificationToken) TableName() string {
+	return "verification_tokens"
+}
+
+// IsValid checks if the token can still be used
+func (vt *VerificationToken) IsValid() bool {
+	return vt.UsedAt == nil && time.Now().Before(vt.ExpiresAt)
+}
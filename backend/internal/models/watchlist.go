@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// WatchlistItem is a movie a user wants to watch
+type WatchlistItem struct {
+	ID        uint64    `gorm:"primarykey" json:"id"`
+	UserID    uint64    `gorm:"not null;uniqueIndex:idx_watchlist_user_movie" json:"user_id"`
+	MovieID   uint64    `gorm:"not null;uniqueIndex:idx_watchlist_user_movie" json:"movie_id"`
+	CreatedAt time.Time `json:"added_at"`
+
+	// Relationships
+	Movie Movie `gorm:"foreignKey:MovieID" json:"movie,omitempty"`
+}
+
+func (WatchlistItem) TableName() string {
+	return "watchlist_items"
+}
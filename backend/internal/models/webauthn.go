@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// WebAuthnCredential is a passkey registered by a user
+// Only the public key is stored; the private key never leaves the authenticator
+type WebAuthnCredential struct {
+	ID              uint64     `gorm:"primarykey" json:"id"`
+	UserID          uint64     `gorm:"not null;index" json:"-"`
+	CredentialID    []byte     `gorm:"type:bytea;uniqueIndex;not null" json:"-"`
+	PublicKey       []byte     `gorm:"type:bytea;not null" json:"-"`
+	AttestationType string     `gorm:"type:varchar(50);not null" json:"-"`
+	Transports      []string   `gorm:"type:jsonb;serializer:json;not null" json:"transports"`
+	AAGUID          []byte     `gorm:"type:bytea" json:"-"`
+	SignCount       uint32     `gorm:"not null;default:0" json:"-"`                   // last signature counter, see migration 019
+	BackupEligible  bool       `gorm:"not null;default:false" json:"backup_eligible"` // synced passkey (e.g. iCloud Keychain)
+	BackupState     bool       `gorm:"not null;default:false" json:"backup_state"`
+	Name            string     `gorm:"type:varchar(100);not null" json:"name"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastUsedAt      *time.Time `json:"last_used_at,omitempty"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+// WebAuthnCeremonyPurpose says what a started WebAuthn ceremony is for
+type WebAuthnCeremonyPurpose string
+
+const (
+	CeremonyRegister     WebAuthnCeremonyPurpose = "register"
+	CeremonyLogin        WebAuthnCeremonyPurpose = "login"         // passwordless, user unknown until the answer
+	CeremonySecondFactor WebAuthnCeremonyPurpose = "second_factor" // answers a 2FA challenge
+)
+
+// WebAuthnCeremony is a challenge waiting for the browser's answer
+// Looked up by challenge digest and used once
+type WebAuthnCeremony struct {
+	ID            uint64                  `gorm:"primarykey" json:"id"`
+	ChallengeHash string                  `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	Purpose       WebAuthnCeremonyPurpose `gorm:"type:varchar(20);not null" json:"purpose"`
+	UserID        *uint64                 `json:"user_id,omitempty"` // NULL for passwordless login
+	SessionData   []byte                  `gorm:"type:jsonb;not null" json:"-"`
+	ExpiresAt     time.Time               `gorm:"not null" json:"expires_at"`
+	CreatedAt     time.Time               `json:"created_at"`
+}
+
+func (WebAuthnCeremony) TableName() string {
+	return "webauthn_ceremonies"
+}
+
+// IsExpired checks if the user took too long to answer
+func (c *WebAuthnCeremony) IsExpired() bool {
+	return !time.Now().Before(c.ExpiresAt)
+}
@@ -0,0 +1,22 @@
+package oauth
+
+import "filmfolk/internal/config"
+
+// googleIssuer is Google's OpenID Connect issuer, its discovery document lives below it
+const googleIssuer = "https://accounts.google.com"
+
+// NewGoogleProvider creates the Google provider (GOOGLE_* settings)
+// Google is an OpenID Connect provider, so it signs in like any other: the ID token is
+// validated against Google's keys, including issuer, audience and nonce.
+// Its subject is the same account ID the userinfo endpoint returns, so linked accounts keep matching
+func NewGoogleProvider(cfg *config.Config) *OIDCProvider {
+	return NewOIDCProvider(config.OIDCProviderConfig{
+		Name:            "google",
+		Issuer:          googleIssuer,
+		ClientID:        cfg.OAuth.GoogleClientID,
+		ClientSecret:    cfg.OAuth.GoogleClientSecret,
+		RedirectURL:     cfg.OAuth.GoogleRedirectURL,
+		LinkRedirectURL: cfg.OAuth.GoogleLinkRedirectURL,
+		Scopes:          []string{"openid", "email", "profile"},
+	})
+}
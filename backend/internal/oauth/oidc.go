@@ -0,0 +1,292 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"filmfolk/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider is any OpenID Connect provider, configured by issuer URL alone
+// Endpoints come from the discovery document, the profile from the validated ID token
+type OIDCProvider struct {
+	cfg       config.OIDCProviderConfig
+	redirects redirects
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery // nil until first successful discovery
+	keys      *keySet
+}
+
+// oidcDiscovery is the part of /.well-known/openid-configuration we use
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// idTokenClaims are the standard claims we read from an ID token
+type idTokenClaims struct {
+	Email           string   `json:"email"`
+	EmailVerified   flexBool `json:"email_verified"`
+	Name            string   `json:"name"`
+	GivenName       string   `json:"given_name"`
+	Picture         string   `json:"picture"`
+	Nonce           string   `json:"nonce"`
+	AuthorizedParty string   `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// flexBool accepts true and "true" - some providers send email_verified as a string
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	value, err := strconv.ParseBool(strings.Trim(string(data), `"`))
+	if err != nil {
+		return fmt.Errorf("invalid boolean: %s", data)
+	}
+	*b = flexBool(value)
+	return nil
+}
+
+// idTokenLeeway tolerates clock skew between us and the provider
+const idTokenLeeway = time.Minute
+
+// NewOIDCProvider creates a provider from its config
+// Discovery happens lazily so an unreachable provider doesn't block startup
+func NewOIDCProvider(cfg config.OIDCProviderConfig) *OIDCProvider {
+	return &OIDCProvider{
+		cfg: cfg,
+		redirects: redirects{
+			login: cfg.RedirectURL,
+			link:  cfg.LinkRedirectURL,
+		},
+	}
+}
+
+// Name returns the configured provider name
+func (p *OIDCProvider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthCodeURL returns the provider's consent page URL
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, flow Flow, params AuthParams) (string, error) {
+	oauthConfig, err := p.oauthConfig(ctx, flow)
+	if err != nil {
+		return "", err
+	}
+	return oauthConfig.AuthCodeURL(params.State, authCodeOptions(params)...), nil
+}
+
+// Exchange trades the code for tokens and returns the profile from the ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, flow Flow, code string, params AuthParams) (*UserInfo, error) {
+	ctx = withHTTPClient(ctx)
+
+	oauthConfig, err := p.oauthConfig(ctx, flow)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Exchange authorization code for tokens
+	token, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(params.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code for token: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("provider did not return an ID token")
+	}
+
+	// 2. Validate the ID token - signature, issuer, audience, expiry
+	claims, err := p.verifyIDToken(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. The ID token must answer this authorization request, not a replayed one
+	if params.Nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(params.Nonce)) != 1 {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+
+	info := &UserInfo{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+		GivenName:     claims.GivenName,
+		Picture:       claims.Picture,
+	}
+
+	// 4. Some providers keep the ID token minimal - fill in from userinfo
+	if info.Email == "" {
+		if err := p.fillFromUserInfo(ctx, oauthConfig, token, info); err != nil {
+			return nil, err
+		}
+	}
+
+	return info, nil
+}
+
+// verifyIDToken validates an ID token against the provider's published keys
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, rawIDToken string) (*idTokenClaims, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &idTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.keys.get(ctx, kid)
+		},
+		jwt.WithValidMethods(supportedIDTokenAlgs),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(idTokenLeeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	// With several audiences the token must have been issued to us (OIDC Core 3.1.3.7)
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return nil, errors.New("invalid ID token: issued to another client")
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("invalid ID token: missing subject")
+	}
+
+	return claims, nil
+}
+
+// fillFromUserInfo loads email and profile from the userinfo endpoint
+func (p *OIDCProvider) fillFromUserInfo(ctx context.Context, oauthConfig *oauth2.Config, token *oauth2.Token, info *UserInfo) error {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return err
+	}
+	if discovery.UserInfoEndpoint == "" {
+		return nil
+	}
+
+	resp, err := oauthConfig.Client(ctx, token).Get(discovery.UserInfoEndpoint)
+	if err != nil {
+		return fmt.Errorf("failed to get user info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get user info: status %d", resp.StatusCode)
+	}
+
+	var userInfo idTokenClaims
+	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
+		return fmt.Errorf("failed to decode user info: %w", err)
+	}
+
+	// The userinfo response must describe the same account as the ID token
+	if userInfo.Subject != info.Subject {
+		return errors.New("user info does not match ID token subject")
+	}
+
+	info.Email = userInfo.Email
+	info.EmailVerified = bool(userInfo.EmailVerified)
+	if info.Name == "" {
+		info.Name = userInfo.Name
+	}
+	if info.GivenName == "" {
+		info.GivenName = userInfo.GivenName
+	}
+	if info.Picture == "" {
+		info.Picture = userInfo.Picture
+	}
+
+	return nil
+}
+
+// oauthConfig builds the oauth2 config from the discovery document
+func (p *OIDCProvider) oauthConfig(ctx context.Context, flow Flow) (*oauth2.Config, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.redirects.url(flow),
+		Scopes:       p.cfg.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  discovery.AuthorizationEndpoint,
+			TokenURL: discovery.TokenEndpoint,
+		},
+	}, nil
+}
+
+// discover fetches and caches the provider's discovery document
+// Failures aren't cached, the next login retries
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	issuer := strings.TrimSuffix(p.cfg.Issuer, "/")
+	var discovery oidcDiscovery
+	if err := getJSON(ctx, issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed for %s: %w", p.cfg.Name, err)
+	}
+
+	// The document must be about the issuer we were configured with
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("OIDC discovery failed for %s: issuer mismatch (%s)", p.cfg.Name, discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery failed for %s: incomplete document", p.cfg.Name)
+	}
+
+	p.discovery = &discovery
+	p.keys = newKeySet(discovery.JWKSURI)
+	return p.discovery, nil
+}
+
+// getJSON fetches url and decodes the JSON response into v
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,134 @@
+package oauth_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"filmfolk/internal/oauth"
+	"filmfolk/internal/oauth/oidctest"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const redirectURL = "http://localhost/callback"
+
+// exchange runs a login against the fake provider, as the callback would
+func exchange(t *testing.T, srv *oidctest.Server, provider *oauth.OIDCProvider, nonce string) (*oauth.UserInfo, error) {
+	t.Helper()
+
+	params := oauth.AuthParams{State: "state", CodeVerifier: "verifier-" + strings.Repeat("x", 40), Nonce: nonce}
+	challenge := sha256.Sum256([]byte(params.CodeVerifier))
+	code := srv.IssueCode(redirectURL, "nonce", base64.RawURLEncoding.EncodeToString(challenge[:]))
+
+	return provider.Exchange(context.Background(), oauth.FlowLogin, code, params)
+}
+
+func TestOIDCExchange(t *testing.T) {
+	srv := oidctest.NewServer()
+	defer srv.Close()
+	srv.SetUser(oidctest.User{Subject: "42", Email: "jane@example.com", EmailVerified: true, Name: "Jane Doe"})
+
+	provider := oauth.NewOIDCProvider(srv.ProviderConfig("fake", redirectURL))
+
+	info, err := exchange(t, srv, provider, "nonce")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if info.Subject != "42" || info.Email != "jane@example.com" || !info.EmailVerified || info.Name != "Jane Doe" {
+		t.Errorf("Exchange() = %+v, want the fake provider's user", info)
+	}
+}
+
+func TestOIDCExchangeRejectsInvalidIDTokens(t *testing.T) {
+	srv := oidctest.NewServer()
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		nonce  string
+		tamper func(claims jwt.MapClaims)
+		want   string
+	}{
+		{
+			name:   "issuer",
+			nonce:  "nonce",
+			tamper: func(claims jwt.MapClaims) { claims["iss"] = "https://attacker.example.com" },
+			want:   "issuer",
+		},
+		{
+			name:   "audience",
+			nonce:  "nonce",
+			tamper: func(claims jwt.MapClaims) { claims["aud"] = "another-client" },
+			want:   "audience",
+		},
+		{
+			name:  "nonce",
+			nonce: "another-nonce",
+			want:  "nonce mismatch",
+		},
+		{
+			name:   "missing nonce",
+			nonce:  "nonce",
+			tamper: func(claims jwt.MapClaims) { delete(claims, "nonce") },
+			want:   "nonce mismatch",
+		},
+		{
+			name:  "authorized party",
+			nonce: "nonce",
+			tamper: func(claims jwt.MapClaims) {
+				claims["aud"] = []string{srv.ClientID, "another-client"}
+				claims["azp"] = "another-client"
+			},
+			want: "issued to another client",
+		},
+		{
+			name:  "expired",
+			nonce: "nonce",
+			tamper: func(claims jwt.MapClaims) {
+				claims["iat"] = time.Now().Add(-2 * time.Hour).Unix()
+				claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			},
+			want: "expired",
+		},
+		{
+			name:   "no expiry",
+			nonce:  "nonce",
+			tamper: func(claims jwt.MapClaims) { delete(claims, "exp") },
+			want:   "exp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv.TamperIDToken(tt.tamper)
+			defer srv.TamperIDToken(nil)
+
+			provider := oauth.NewOIDCProvider(srv.ProviderConfig("fake", redirectURL))
+			info, err := exchange(t, srv, provider, tt.nonce)
+			if err == nil {
+				t.Fatalf("Exchange() = %+v, want an error", info)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Exchange() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeAcceptsSeveralAudiencesWithOwnAuthorizedParty(t *testing.T) {
+	srv := oidctest.NewServer()
+	defer srv.Close()
+	srv.TamperIDToken(func(claims jwt.MapClaims) {
+		claims["aud"] = []string{srv.ClientID, "another-client"}
+		claims["azp"] = srv.ClientID
+	})
+
+	provider := oauth.NewOIDCProvider(srv.ProviderConfig("fake", redirectURL))
+	if _, err := exchange(t, srv, provider, "nonce"); err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+}
@@ -0,0 +1,327 @@
+// Package oidctest runs a fake OpenID Connect provider for tests and local development
+//
+//	srv := oidctest.NewServer()
+//	defer srv.Close()
+//	srv.SetUser(oidctest.User{Subject: "42", Email: "jane@example.com", EmailVerified: true})
+//	provider := oauth.NewOIDCProvider(srv.ProviderConfig("fake", redirectURL))
+//
+// The authorize endpoint approves every request immediately and redirects back with a code.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"filmfolk/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// User is the account the fake provider signs in
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	GivenName     string
+	Picture       string
+}
+
+// authRequest is what an issued code remembers
+type authRequest struct {
+	redirectURI   string
+	nonce         string
+	codeChallenge string // S256 PKCE challenge, empty if the client didn't send one
+	user          User
+	expiresAt     time.Time
+}
+
+// Server is a fake OIDC provider backed by httptest
+type Server struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+
+	key *rsa.PrivateKey
+	kid string
+
+	mu     sync.Mutex
+	user   User
+	codes  map[string]authRequest
+	tamper func(claims jwt.MapClaims)
+}
+
+// NewServer starts a fake provider with a default user
+func NewServer() *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic("oidctest: " + err.Error())
+	}
+
+	s := &Server{
+		ClientID:     "oidctest-client",
+		ClientSecret: "oidctest-secret",
+		key:          key,
+		kid:          "oidctest-key",
+		user: User{
+			Subject:       "oidctest-user",
+			Email:         "oidctest@example.com",
+			EmailVerified: true,
+			Name:          "Test User",
+			GivenName:     "Test",
+		},
+		codes: make(map[string]authRequest),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.handleDiscovery)
+	mux.HandleFunc("/authorize", s.handleAuthorize)
+	mux.HandleFunc("/token", s.handleToken)
+	mux.HandleFunc("/userinfo", s.handleUserInfo)
+	mux.HandleFunc("/jwks", s.handleJWKS)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Issuer is the issuer URL to configure the provider with
+func (s *Server) Issuer() string {
+	return s.URL
+}
+
+// ProviderConfig returns a provider config pointing at this server
+func (s *Server) ProviderConfig(name, redirectURL string) config.OIDCProviderConfig {
+	return config.OIDCProviderConfig{
+		Name:            name,
+		Issuer:          s.Issuer(),
+		ClientID:        s.ClientID,
+		ClientSecret:    s.ClientSecret,
+		RedirectURL:     redirectURL,
+		LinkRedirectURL: redirectURL,
+		Scopes:          []string{"openid", "email", "profile"},
+	}
+}
+
+// SetUser changes the account signed in by the next authorization
+func (s *Server) SetUser(user User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user = user
+}
+
+// TamperIDToken changes the claims of every ID token issued from now on before it is signed
+// Lets tests check that the client rejects tokens with a wrong issuer, audience, expiry...
+// Pass nil to issue valid tokens again
+func (s *Server) TamperIDToken(tamper func(claims jwt.MapClaims)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tamper = tamper
+}
+
+// IssueCode creates an authorization code directly, without going through /authorize
+// codeChallenge is the S256 PKCE challenge, or empty for a code without PKCE
+func (s *Server) IssueCode(redirectURI, nonce, codeChallenge string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code := randomString()
+	s.codes[code] = authRequest{
+		redirectURI:   redirectURI,
+		nonce:         nonce,
+		codeChallenge: codeChallenge,
+		user:          s.user,
+		expiresAt:     time.Now().Add(time.Minute),
+	}
+	return code
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.Issuer(),
+		"authorization_endpoint":                s.URL + "/authorize",
+		"token_endpoint":                        s.URL + "/token",
+		"userinfo_endpoint":                     s.URL + "/userinfo",
+		"jwks_uri":                              s.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// handleAuthorize approves immediately and redirects back with a code
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != s.ClientID || query.Get("response_type") != "code" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI := query.Get("redirect_uri")
+	target, err := url.Parse(redirectURI)
+	if err != nil || redirectURI == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	// Only S256 is supported, like real providers that disable "plain"
+	challenge := query.Get("code_challenge")
+	if challenge != "" && query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "unsupported code_challenge_method", http.StatusBadRequest)
+		return
+	}
+
+	code := s.IssueCode(redirectURI, query.Get("nonce"), challenge)
+
+	params := target.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	target.RawQuery = params.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// handleToken exchanges a code for an access token and a signed ID token
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	// Client authentication: HTTP Basic or form fields
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != s.ClientID || clientSecret != s.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	// Codes are single use
+	s.mu.Lock()
+	code := r.PostForm.Get("code")
+	req, found := s.codes[code]
+	delete(s.codes, code)
+	s.mu.Unlock()
+
+	if !found || time.Now().After(req.expiresAt) || req.redirectURI != r.PostForm.Get("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	// PKCE: the verifier must hash to the challenge sent to /authorize
+	if req.codeChallenge != "" && s256(r.PostForm.Get("code_verifier")) != req.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := s.signIDToken(req)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "oidctest-access:" + req.user.Subject,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (s *Server) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	user := s.user
+	s.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer oidctest-access:"+user.Subject {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, userClaims(user))
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	public := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": s.kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+// signIDToken creates the ID token for an authorization
+func (s *Server) signIDToken(req authRequest) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": s.Issuer(),
+		"aud": s.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for k, v := range userClaims(req.user) {
+		claims[k] = v
+	}
+	if req.nonce != "" {
+		claims["nonce"] = req.nonce
+	}
+
+	s.mu.Lock()
+	tamper := s.tamper
+	s.mu.Unlock()
+	if tamper != nil {
+		tamper(claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+	return token.SignedString(s.key)
+}
+
+func userClaims(user User) map[string]interface{} {
+	return map[string]interface{}{
+		"sub":            user.Subject,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"name":           user.Name,
+		"given_name":     user.GivenName,
+		"picture":        user.Picture,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("oidctest: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
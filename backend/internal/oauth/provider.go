@@ -0,0 +1,176 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"filmfolk/internal/config"
+
+	"golang.org/x/oauth2"
+)
+
+// Flow says where the provider sends the user back to
+type Flow int
+
+const (
+	// FlowLogin returns to our /auth/:provider/callback
+	FlowLogin Flow = iota
+	// FlowLink returns to the frontend link page, which posts the code to /auth/link/:provider
+	FlowLink
+)
+
+// UserInfo is the provider profile, normalized across providers
+type UserInfo struct {
+	Subject       string // stable account ID at the provider
+	Email         string
+	EmailVerified bool // only trust Email for account matching if true
+	Name          string
+	GivenName     string
+	Picture       string
+}
+
+// AuthParams are the secrets of one authorization request
+// Generated when the flow starts and needed again to exchange the code
+type AuthParams struct {
+	State        string
+	CodeVerifier string // PKCE - only its S256 challenge goes into the auth URL
+	Nonce        string // OIDC only - echoed back in the ID token, checked on exchange
+}
+
+// Provider is an external login provider (OAuth 2.0 / OpenID Connect)
+type Provider interface {
+	// Name is the route name: /auth/<name>
+	Name() string
+	// AuthCodeURL returns the consent page URL
+	AuthCodeURL(ctx context.Context, flow Flow, params AuthParams) (string, error)
+	// Exchange trades an authorization code for the user's profile
+	Exchange(ctx context.Context, flow Flow, code string, params AuthParams) (*UserInfo, error)
+}
+
+// httpClient is used for every call to a provider
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+var (
+	mu        sync.RWMutex
+	providers = make(map[string]Provider)
+)
+
+// InitProviders registers every provider configured in cfg
+// Call this once at app startup
+func InitProviders(cfg *config.Config) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	providers = make(map[string]Provider)
+
+	if cfg.OAuth.GoogleClientID != "" {
+		providers["google"] = NewGoogleProvider(cfg)
+	}
+	if cfg.OAuth.FacebookClientID != "" {
+		providers["facebook"] = NewFacebookProvider(cfg)
+	}
+	for _, providerCfg := range cfg.OAuth.Providers {
+		providers[providerCfg.Name] = NewOIDCProvider(providerCfg)
+	}
+}
+
+// Register adds or replaces a provider (e.g. a fake provider in tests)
+func Register(provider Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[provider.Name()] = provider
+}
+
+// Get returns a registered provider
+func Get(name string) (Provider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	provider, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown login provider: %s", name)
+	}
+	return provider, nil
+}
+
+// Names lists the registered providers
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// redirects holds the two callback URLs of a provider
+type redirects struct {
+	login string
+	link  string
+}
+
+func (r redirects) url(flow Flow) string {
+	if flow == FlowLink {
+		return r.link
+	}
+	return r.login
+}
+
+// NewAuthParams generates state, PKCE verifier and nonce for a new authorization request
+func NewAuthParams() (AuthParams, error) {
+	state, err := randomToken()
+	if err != nil {
+		return AuthParams{}, err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return AuthParams{}, err
+	}
+
+	return AuthParams{
+		State:        state,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		Nonce:        nonce,
+	}, nil
+}
+
+// authCodeOptions adds PKCE (S256) and nonce to an OpenID Connect authorization request
+func authCodeOptions(params AuthParams) []oauth2.AuthCodeOption {
+	return append(pkceOptions(params), oauth2.SetAuthURLParam("nonce", params.Nonce))
+}
+
+// pkceOptions adds PKCE (S256) to the authorization request
+// Plain OAuth 2.0 providers get no nonce: without an ID token it couldn't be checked
+func pkceOptions(params AuthParams) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(params.CodeVerifier)}
+}
+
+// randomToken returns 32 random bytes, base64url encoded
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// withHTTPClient makes the oauth2 package use our client (timeouts)
+func withHTTPClient(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+}
+
+// configFor returns a copy of base with the redirect URL of the flow
+func configFor(base *oauth2.Config, r redirects, flow Flow) *oauth2.Config {
+	flowConfig := *base
+	flowConfig.RedirectURL = r.url(flow)
+	return &flowConfig
+}
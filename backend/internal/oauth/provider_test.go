@@ -0,0 +1,63 @@
+package oauth_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/oauth"
+	"filmfolk/internal/oauth/oidctest"
+)
+
+// authCodeQuery returns the query of a provider's consent page URL
+func authCodeQuery(t *testing.T, provider oauth.Provider) url.Values {
+	t.Helper()
+
+	params, err := oauth.NewAuthParams()
+	if err != nil {
+		t.Fatalf("NewAuthParams() error = %v", err)
+	}
+	authURL, err := provider.AuthCodeURL(context.Background(), oauth.FlowLogin, params)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() = %q, not a URL: %v", authURL, err)
+	}
+	return parsed.Query()
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	srv := oidctest.NewServer()
+	defer srv.Close()
+
+	cfg := &config.Config{}
+	cfg.OAuth.FacebookClientID = "facebook-client"
+	cfg.OAuth.FacebookRedirectURL = redirectURL
+
+	tests := []struct {
+		name      string
+		provider  oauth.Provider
+		wantNonce bool
+	}{
+		// The ID token has to echo the nonce back
+		{name: "OpenID Connect", provider: oauth.NewOIDCProvider(srv.ProviderConfig("fake", redirectURL)), wantNonce: true},
+		// No ID token to check a nonce against
+		{name: "Facebook", provider: oauth.NewFacebookProvider(cfg), wantNonce: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := authCodeQuery(t, tt.provider)
+
+			if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+				t.Errorf("AuthCodeURL() query = %v, want an S256 PKCE challenge", query)
+			}
+			if got := query.Has("nonce"); got != tt.wantNonce {
+				t.Errorf("AuthCodeURL() has nonce = %v, want %v", got, tt.wantNonce)
+			}
+		})
+	}
+}
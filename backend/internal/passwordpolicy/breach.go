@@ -0,0 +1,150 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachChecker looks passwords up in a local copy of a breached-password corpus
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// NewBreachChecker opens the Pwned Passwords data at path (SHA-1 format)
+//   - a directory of k-anonymity range files, <first 5 hex chars>.txt with SUFFIX:COUNT lines
+//     (the layout the range API and its downloaders produce)
+//   - a single file of HASH:COUNT lines sorted by hash
+func NewBreachChecker(path string) (BreachChecker, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("password breach data: %w", err)
+	}
+	if info.IsDir() {
+		return &rangeDirChecker{dir: path}, nil
+	}
+	return &sortedFileChecker{path: path}, nil
+}
+
+// rangePrefixLen is how many hash characters select a range file
+const rangePrefixLen = 5
+
+// sha1Hex returns the uppercase SHA-1 of the password, as used by Pwned Passwords
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// rangeDirChecker reads one small range file per lookup - only the 5-character
+// prefix selects the file, like the remote k-anonymity API
+type rangeDirChecker struct {
+	dir string
+}
+
+func (c *rangeDirChecker) IsBreached(password string) (bool, error) {
+	hash := sha1Hex(password)
+	prefix, suffix := hash[:rangePrefixLen], hash[rangePrefixLen:]
+
+	file, err := os.Open(filepath.Join(c.dir, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineSuffix, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(lineSuffix, suffix) {
+			return count != "0", nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// sortedFileChecker binary searches a hash-sorted file by byte offset
+// The full corpus is tens of gigabytes, so it's never loaded into memory
+type sortedFileChecker struct {
+	path string
+}
+
+func (c *sortedFileChecker) IsBreached(password string) (bool, error) {
+	hash := sha1Hex(password)
+
+	file, err := os.Open(c.path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	// Find the smallest offset whose following line sorts at or after our hash
+	lo, hi := int64(0), info.Size()
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		line, err := lineAfter(file, mid)
+		if err != nil {
+			return false, err
+		}
+		if line == "" || lineHash(line) >= hash {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	line, err := lineAfter(file, lo)
+	if err != nil {
+		return false, err
+	}
+	return lineHash(line) == hash, nil
+}
+
+// lineAfter returns the first complete line starting after offset (offset 0 means the first line)
+func lineAfter(file *os.File, offset int64) (string, error) {
+	if offset == 0 {
+		return lineAt(file, 0)
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(file, offset-1, 1<<20))
+	// Skip the rest of the line offset-1 is in (a newline there means offset starts a line)
+	if _, err := reader.ReadString('\n'); err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", nil
+		}
+		return "", err
+	}
+	return readLine(reader)
+}
+
+// lineAt reads the line starting exactly at offset
+func lineAt(file *os.File, offset int64) (string, error) {
+	return readLine(bufio.NewReader(io.NewSectionReader(file, offset, 1<<20)))
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return string(bytes.TrimSpace([]byte(line))), nil
+}
+
+// lineHash extracts the uppercase hash from a HASH:COUNT line
+func lineHash(line string) string {
+	hash, _, _ := strings.Cut(line, ":")
+	return strings.ToUpper(hash)
+}
@@ -0,0 +1,143 @@
+package passwordpolicy_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"filmfolk/internal/passwordpolicy"
+)
+
+// pwnedHash returns the uppercase SHA-1 of a password, as Pwned Passwords lists it
+func pwnedHash(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// writeRangeDir writes range files, <prefix>.txt with SUFFIX:COUNT lines
+func writeRangeDir(t *testing.T, counts map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	files := map[string][]string{}
+	for password, count := range counts {
+		hash := pwnedHash(password)
+		files[hash[:5]] = append(files[hash[:5]], hash[5:]+":"+count)
+	}
+	for prefix, lines := range files {
+		path := filepath.Join(dir, prefix+".txt")
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	return dir
+}
+
+// writeSortedFile writes one HASH:COUNT file sorted by hash, with filler lines around the entries
+func writeSortedFile(t *testing.T, passwords []string) string {
+	t.Helper()
+
+	var lines []string
+	for _, password := range passwords {
+		lines = append(lines, pwnedHash(password)+":42")
+	}
+	for i := 0; i < 200; i++ {
+		lines = append(lines, pwnedHash("filler-"+strings.Repeat("x", i))+":1")
+	}
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned-passwords-sha1-ordered-by-hash.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestBreachChecker(t *testing.T) {
+	breached := []string{"hunter2hunter2", "zebra-crossing-7", "the last one"}
+
+	rangeDir := writeRangeDir(t, map[string]string{
+		"hunter2hunter2":   "1337",
+		"zebra-crossing-7": "3",
+		"the last one":     "1",
+		"removed from set": "0",
+	})
+	sortedFile := writeSortedFile(t, breached)
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{password: "hunter2hunter2", want: true},
+		{password: "zebra-crossing-7", want: true},
+		{password: "the last one", want: true},
+		{password: "plot twist at midnight", want: false},
+		{password: "", want: false},
+	}
+
+	for name, path := range map[string]string{"range directory": rangeDir, "sorted file": sortedFile} {
+		t.Run(name, func(t *testing.T) {
+			checker, err := passwordpolicy.NewBreachChecker(path)
+			if err != nil {
+				t.Fatalf("NewBreachChecker() error = %v", err)
+			}
+
+			for _, tt := range tests {
+				got, err := checker.IsBreached(tt.password)
+				if err != nil {
+					t.Fatalf("IsBreached(%q) error = %v", tt.password, err)
+				}
+				if got != tt.want {
+					t.Errorf("IsBreached(%q) = %v, want %v", tt.password, got, tt.want)
+				}
+			}
+		})
+	}
+
+	t.Run("count zero", func(t *testing.T) {
+		checker, err := passwordpolicy.NewBreachChecker(rangeDir)
+		if err != nil {
+			t.Fatalf("NewBreachChecker() error = %v", err)
+		}
+		if got, err := checker.IsBreached("removed from set"); err != nil || got {
+			t.Errorf("IsBreached() = %v, %v, want false for a count of 0", got, err)
+		}
+	})
+}
+
+func TestCheckBreached(t *testing.T) {
+	usePolicy(t, "argon2id", writeRangeDir(t, map[string]string{
+		"hunter2hunter2": "1337",
+		"qx-zebra":       "1337",
+	}))
+
+	tests := []struct {
+		password string
+		want     []string
+	}{
+		{password: "hunter2hunter2", want: []string{passwordpolicy.CodeBreached}},
+		{password: "plot twist at midnight"},
+		// Only checked once the rest passed
+		{password: "qx-zebra", want: []string{passwordpolicy.CodeTooShort}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			got := violationCodes(t, passwordpolicy.Check(tt.password))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check(%q) violations = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBreachCheckerMissingPath(t *testing.T) {
+	if _, err := passwordpolicy.NewBreachChecker(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("NewBreachChecker() accepted a path that doesn't exist")
+	}
+}
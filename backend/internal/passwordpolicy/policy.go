@@ -0,0 +1,232 @@
+// Package passwordpolicy decides whether a new password is acceptable
+// Used wherever a password is chosen: register, reset, change and guest upgrade
+package passwordpolicy
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/utils"
+)
+
+const (
+	// bcryptMaxBytes is the longest password bcrypt can hash
+	bcryptMaxBytes = 72
+	// defaultMaxBytes bounds the work of hashing with argon2id, which takes any length
+	defaultMaxBytes = 256
+)
+
+// Violation codes, stable for clients to map to their own messages
+const (
+	CodeTooShort    = "too_short"
+	CodeTooLong     = "too_long"
+	CodeCommon      = "common"
+	CodeTooSimilar  = "too_similar"
+	CodeBreached    = "breached"
+	CodeSameAsOld   = "same_as_current"
+	CodeRepetitive  = "repetitive"
+	minSimilarInput = 3 // shorter usernames/email parts aren't compared
+)
+
+// Violation is one reason a password was refused
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PolicyError lists every rule a password broke
+// Handlers return Violations to the client as structured feedback
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password rejected: " + strings.Join(messages, "; ")
+}
+
+// Policy holds the configured rules
+type Policy struct {
+	minLength int
+	maxBytes  int
+	breaches  BreachChecker // nil if no breach data is configured
+}
+
+//go:embed common_passwords.txt
+var commonPasswordsFile []byte
+
+var (
+	commonOnce      sync.Once
+	commonPasswords map[string]bool
+
+	current = &Policy{minLength: 8, maxBytes: bcryptMaxBytes}
+)
+
+// InitPolicy configures the policy used by the application
+// Call this once at app startup
+func InitPolicy(cfg *config.Config) error {
+	policy := &Policy{minLength: cfg.Auth.PasswordMinLength, maxBytes: defaultMaxBytes}
+	if cfg.Auth.PasswordHash == "bcrypt" {
+		policy.maxBytes = bcryptMaxBytes
+	}
+
+	if cfg.Auth.PasswordBreachPath != "" {
+		breaches, err := NewBreachChecker(cfg.Auth.PasswordBreachPath)
+		if err != nil {
+			return err
+		}
+		policy.breaches = breaches
+	}
+
+	current = policy
+	return nil
+}
+
+// Check validates a new password against the application policy
+// userInputs are the username, email and other personal strings the password must not resemble
+func Check(password string, userInputs ...string) error {
+	return current.Check(password, userInputs...)
+}
+
+// Check validates a new password
+// Returns a *PolicyError listing every violation, or nil
+func (p *Policy) Check(password string, userInputs ...string) error {
+	var violations []Violation
+
+	// 1. Length
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooShort,
+			Message: fmt.Sprintf("must be at least %d characters", p.minLength),
+		})
+	}
+	if len(password) > p.maxBytes {
+		violations = append(violations, Violation{
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("must be at most %d bytes", p.maxBytes),
+		})
+	}
+
+	lower := strings.ToLower(password)
+
+	// 2. A single repeated character ("aaaaaaaa")
+	if length > 0 && strings.Count(lower, string([]rune(lower)[0])) == length {
+		violations = append(violations, Violation{
+			Code:    CodeRepetitive,
+			Message: "must not be one repeated character",
+		})
+	}
+
+	// 3. Well-known passwords, also with digits or symbols tacked on ("Password123!")
+	if isCommon(lower) {
+		violations = append(violations, Violation{
+			Code:    CodeCommon,
+			Message: "is too common",
+		})
+	}
+
+	// 4. Personal information
+	if isSimilar(lower, userInputs) {
+		violations = append(violations, Violation{
+			Code:    CodeTooSimilar,
+			Message: "must not contain your username or email",
+		})
+	}
+
+	// 5. Known breaches - only if the rest passed, no need to hit the disk otherwise
+	if len(violations) == 0 && p.breaches != nil {
+		breached, err := p.breaches.IsBreached(password)
+		if err != nil {
+			// Don't lock users out over a broken data file; the other checks still apply
+			utils.GetLogger().Error().Err(err).Msg("Failed to check password against breach data")
+			return nil
+		}
+		if breached {
+			violations = append(violations, Violation{
+				Code:    CodeBreached,
+				Message: "appeared in a data breach, choose another",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// SameAsCurrent is the error for reusing the current password on change
+func SameAsCurrent() error {
+	return &PolicyError{Violations: []Violation{{
+		Code:    CodeSameAsOld,
+		Message: "must be different from your current password",
+	}}}
+}
+
+// isCommon checks the bundled list, with and without trailing digits/symbols
+func isCommon(lower string) bool {
+	commonOnce.Do(loadCommonPasswords)
+
+	if commonPasswords[lower] {
+		return true
+	}
+
+	// "123456789!" - all-digit passwords are on the list too, so keep the digits first
+	trimmed := strings.TrimRightFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(trimmed) >= 4 && commonPasswords[trimmed] {
+		return true
+	}
+
+	// "password123!"
+	base := strings.TrimRightFunc(trimmed, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	return len(base) >= 4 && commonPasswords[base]
+}
+
+func loadCommonPasswords() {
+	commonPasswords = make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(commonPasswordsFile))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		commonPasswords[strings.ToLower(line)] = true
+	}
+}
+
+// isSimilar checks if the password contains, or is contained in, personal information
+// Emails are compared by local part and by the whole address
+func isSimilar(lower string, userInputs []string) bool {
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		candidates := []string{input}
+		if local, _, found := strings.Cut(input, "@"); found {
+			candidates = append(candidates, local)
+		}
+
+		for _, candidate := range candidates {
+			if utf8.RuneCountInString(candidate) < minSimilarInput {
+				continue
+			}
+			if strings.Contains(lower, candidate) || strings.Contains(candidate, lower) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package passwordpolicy_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/passwordpolicy"
+)
+
+// usePolicy configures the policy for one test, then puts the default back
+func usePolicy(t *testing.T, hash, breachPath string) {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Auth.PasswordMinLength = 10
+	cfg.Auth.PasswordHash = hash
+	cfg.Auth.PasswordBreachPath = breachPath
+	if err := passwordpolicy.InitPolicy(cfg); err != nil {
+		t.Fatalf("InitPolicy() error = %v", err)
+	}
+	t.Cleanup(func() {
+		defaults := &config.Config{}
+		defaults.Auth.PasswordMinLength = 8
+		defaults.Auth.PasswordHash = "bcrypt"
+		passwordpolicy.InitPolicy(defaults)
+	})
+}
+
+// violationCodes returns the codes of a policy error, nil if the password passed
+func violationCodes(t *testing.T, err error) []string {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+	var policyErr *passwordpolicy.PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("error = %v, want a *PolicyError", err)
+	}
+
+	codes := make([]string, len(policyErr.Violations))
+	for i, v := range policyErr.Violations {
+		codes[i] = v.Code
+	}
+	return codes
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		hash       string
+		password   string
+		userInputs []string
+		want       []string
+	}{
+		{name: "acceptable", hash: "argon2id", password: "plot twist at midnight"},
+		{name: "too short", hash: "argon2id", password: "k7#mQ2x", want: []string{passwordpolicy.CodeTooShort}},
+		{name: "length counts characters", hash: "argon2id", password: "ünïcödé-wörd"},
+		{name: "too long for argon2id", hash: "argon2id", password: strings.Repeat("ab", 129), want: []string{passwordpolicy.CodeTooLong}},
+		{name: "too long for bcrypt", hash: "bcrypt", password: strings.Repeat("ab", 37), want: []string{passwordpolicy.CodeTooLong}},
+		{name: "bcrypt limit", hash: "bcrypt", password: strings.Repeat("ab", 36)},
+		{name: "one repeated character", hash: "argon2id", password: "ZZZZZZzzzzzz", want: []string{passwordpolicy.CodeRepetitive}},
+		{name: "common", hash: "argon2id", password: "sunshine12", want: []string{passwordpolicy.CodeCommon}},
+		{name: "common, any case", hash: "argon2id", password: "SunShine!!", want: []string{passwordpolicy.CodeCommon}},
+		{name: "common digits with a symbol", hash: "argon2id", password: "123456789!", want: []string{passwordpolicy.CodeCommon}},
+		{name: "common word in a phrase", hash: "argon2id", password: "horse-racing-rules"},
+		{name: "contains the username", hash: "argon2id", password: "moviefan-2024", userInputs: []string{"MovieFan"}, want: []string{passwordpolicy.CodeTooSimilar}},
+		{name: "contains the email name", hash: "argon2id", password: "jane.doe.rocks", userInputs: []string{"jane.doe@example.com"}, want: []string{passwordpolicy.CodeTooSimilar}},
+		{name: "part of the email", hash: "argon2id", password: "e.doe@example", userInputs: []string{"jane.doe@example.com"}, want: []string{passwordpolicy.CodeTooSimilar}},
+		{name: "short username ignored", hash: "argon2id", password: "jo-plays-chess", userInputs: []string{"jo"}},
+		{name: "several rules", hash: "argon2id", password: "pass", want: []string{passwordpolicy.CodeTooShort, passwordpolicy.CodeCommon}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usePolicy(t, tt.hash, "")
+
+			got := violationCodes(t, passwordpolicy.Check(tt.password, tt.userInputs...))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check(%q) violations = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyErrorMessage(t *testing.T) {
+	usePolicy(t, "argon2id", "")
+
+	err := passwordpolicy.Check("pass")
+	want := "password rejected: must be at least 10 characters; is too common"
+	if err == nil || err.Error() != want {
+		t.Errorf("Check() error = %v, want %q", err, want)
+	}
+}
+
+func TestSameAsCurrent(t *testing.T) {
+	got := violationCodes(t, passwordpolicy.SameAsCurrent())
+	if !reflect.DeepEqual(got, []string{passwordpolicy.CodeSameAsOld}) {
+		t.Errorf("SameAsCurrent() violations = %v, want [%s]", got, passwordpolicy.CodeSameAsOld)
+	}
+}
@@ -0,0 +1,136 @@
+package revocation
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"filmfolk/internal/db"
+	"filmfolk/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Access tokens are stateless, so revoking one means remembering it until it expires.
+// Three mechanisms, checked by AuthMiddleware on every request:
+//   - token ID (jti) denylist: a single access token
+//   - session ID denylist: every access token issued for one refresh token family
+//   - per-user cutoff (users.tokens_valid_after): every token issued before that time
+
+var (
+	store     Store = NewMemoryStore()
+	accessTTL       = 15 * time.Minute
+)
+
+// cutoffCacheTTL bounds how long a cutoff set by another instance
+// (or by the status-change trigger) can go unnoticed
+const cutoffCacheTTL = 30 * time.Second
+
+type cachedCutoff struct {
+	validAfter time.Time // zero = no cutoff
+	loadedAt   time.Time
+}
+
+var (
+	cutoffMu    sync.RWMutex
+	cutoffCache = make(map[uint64]cachedCutoff)
+)
+
+// ErrUserNotFound means the token belongs to a user that no longer exists
+var ErrUserNotFound = errors.New("user not found")
+
+// Init configures the revocation store and access token lifetime
+// Call this once at app startup
+func Init(s Store, accessTokenTTL time.Duration) {
+	store = s
+	accessTTL = accessTokenTTL
+}
+
+// SetStore replaces the revocation store (e.g. with a shared store)
+func SetStore(s Store) {
+	store = s
+}
+
+// RevokeToken denies a single access token until it expires
+func RevokeToken(tokenID string, expiresAt time.Time) error {
+	if tokenID == "" {
+		return nil
+	}
+	return store.Add("jti:"+tokenID, expiresAt)
+}
+
+// RevokeSession denies every access token issued for a session
+// Access tokens live at most accessTTL, so the entry can expire after that
+func RevokeSession(sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	return store.Add("sid:"+sessionID, time.Now().Add(accessTTL))
+}
+
+// InvalidateUser drops the cached cutoff so the next request reloads it from the database
+// Call after updating users.tokens_valid_after
+func InvalidateUser(userID uint64) {
+	cutoffMu.Lock()
+	delete(cutoffCache, userID)
+	cutoffMu.Unlock()
+}
+
+// IsRevoked checks an access token against all three mechanisms
+func IsRevoked(userID uint64, tokenID, sessionID string, issuedAt time.Time) (bool, error) {
+	if tokenID != "" {
+		if denied, err := store.Contains("jti:" + tokenID); err != nil || denied {
+			return denied, err
+		}
+	}
+
+	if sessionID != "" {
+		if denied, err := store.Contains("sid:" + sessionID); err != nil || denied {
+			return denied, err
+		}
+	}
+
+	validAfter, err := userCutoff(userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	// iat has second precision: a token issued in the same second as the cutoff
+	// (e.g. logging in right after a password reset) must stay valid
+	return issuedAt.Before(validAfter.Truncate(time.Second)), nil
+}
+
+// userCutoff returns users.tokens_valid_after, cached for cutoffCacheTTL
+func userCutoff(userID uint64) (time.Time, error) {
+	cutoffMu.RLock()
+	cached, ok := cutoffCache[userID]
+	cutoffMu.RUnlock()
+
+	if ok && time.Since(cached.loadedAt) < cutoffCacheTTL {
+		return cached.validAfter, nil
+	}
+
+	var user models.User
+	err := db.DB.Select("id", "tokens_valid_after").First(&user, userID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, ErrUserNotFound
+		}
+		return time.Time{}, fmt.Errorf("failed to load token cutoff: %w", err)
+	}
+
+	var validAfter time.Time
+	if user.TokensValidAfter != nil {
+		validAfter = *user.TokensValidAfter
+	}
+
+	cutoffMu.Lock()
+	cutoffCache[userID] = cachedCutoff{validAfter: validAfter, loadedAt: time.Now()}
+	cutoffMu.Unlock()
+
+	return validAfter, nil
+}
@@ -0,0 +1,66 @@
+package revocation
+
+import (
+	"sync"
+	"time"
+)
+
+// Store keeps revoked keys (token IDs, session IDs) until they would have expired anyway
+// The in-memory store is per process; plug in a shared implementation (e.g. Redis)
+// with SetStore when running several API instances
+type Store interface {
+	// Add marks key as revoked until the given time
+	Add(key string, until time.Time) error
+	// Contains reports whether key is currently revoked
+	Contains(key string) (bool, error)
+}
+
+// MemoryStore is an in-process Store with expiring entries
+type MemoryStore struct {
+	mu        sync.RWMutex
+	entries   map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries:   make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// sweepInterval is how often expired entries are dropped
+const sweepInterval = time.Minute
+
+// Add marks key as revoked until the given time
+func (s *MemoryStore) Add(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.entries[key]; !ok || until.After(existing) {
+		s.entries[key] = until
+	}
+
+	// Opportunistic cleanup instead of a background goroutine
+	now := time.Now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		for k, exp := range s.entries {
+			if now.After(exp) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	return nil
+}
+
+// Contains reports whether key is currently revoked
+func (s *MemoryStore) Contains(key string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	until, ok := s.entries[key]
+	return ok && time.Now().Before(until), nil
+}
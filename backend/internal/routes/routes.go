@@ -4,6 +4,7 @@ import (
 	"filmfolk/internal/config"
 	"filmfolk/internal/handlers"
 	"filmfolk/internal/middleware"
+	"filmfolk/internal/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -13,10 +14,24 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(cfg)
 	oauthHandler := handlers.NewOAuthHandler(cfg)
+	twoFactorHandler := handlers.NewTwoFactorHandler(cfg)
+	webAuthnHandler := handlers.NewWebAuthnHandler(cfg)
+	guestHandler := handlers.NewGuestHandler(cfg)
+	accountHandler := handlers.NewAccountHandler(cfg)
+	accessTokenHandler := handlers.NewAccessTokenHandler()
 	movieHandler := handlers.NewMovieHandler()
 	reviewHandler := handlers.NewReviewHandler()
 	followerHandler := handlers.NewFollowerHandler()
+	watchlistHandler := handlers.NewWatchlistHandler()
+	adminHandler := handlers.NewAdminHandler()
 	healthHandler := handlers.NewHealthHandler()
+	jwksHandler := handlers.NewJWKSHandler()
+
+	// Limits what unverified accounts can do (see AUTH_UNVERIFIED_ACCESS)
+	requireVerified := middleware.RequireVerifiedEmail(cfg.Auth.UnverifiedAccess)
+
+	// Keeps guest accounts to the watchlist and ratings
+	requireFullAccount := middleware.RequireFullAccount()
 
 	// API v1 group
 	v1 := router.Group("/api/v1")
@@ -27,17 +42,43 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 		{
 			auth.POST("/register", authHandler.Register)
 			auth.POST("/login", authHandler.Login)
-			auth.POST("/refresh", authHandler.RefreshToken)
-			auth.POST("/logout", authHandler.Logout)
+			auth.POST("/refresh", middleware.RequireCSRF(), authHandler.RefreshToken) // Cookie mode needs X-CSRF-Token
+			auth.POST("/logout", middleware.RequireCSRF(), middleware.OptionalAuthMiddleware(), authHandler.Logout)
+			auth.GET("/csrf", authHandler.CSRFToken) // Cookie mode CSRF token for cross-origin frontends
+			auth.POST("/verify-email", authHandler.VerifyEmail)
+			auth.POST("/resend-verification", authHandler.ResendVerification)
+			auth.POST("/forgot-password", authHandler.ForgotPassword)
+			auth.POST("/reset-password", authHandler.ResetPassword)
+			auth.POST("/2fa/verify", twoFactorHandler.Verify) // Second login step
+			auth.POST("/unlock", authHandler.UnlockAccount)
+			auth.POST("/unlock/request", authHandler.RequestUnlock) // Mail a new unlock link
+			auth.POST("/guest", guestHandler.Create) // Start a guest session
+
+			// OAuth / OpenID Connect login (google, facebook, OAUTH_PROVIDERS)
+			auth.GET("/providers", oauthHandler.ListProviders)
+			auth.GET("/:provider", oauthHandler.Login)
+			auth.GET("/:provider/callback", oauthHandler.Callback)
+			auth.POST("/exchange", oauthHandler.Exchange) // Trade the callback code for tokens
+
+			// Passkey login, or a passkey answering the 2FA challenge (with mfa_token)
+			auth.POST("/webauthn/login/begin", webAuthnHandler.LoginBegin)
+			auth.POST("/webauthn/login/finish", webAuthnHandler.LoginFinish)
+
+			// Emailed sign-in links, bound to the requesting browser
+			auth.POST("/magic-link", authHandler.RequestMagicLink)
+			auth.POST("/magic-link/consume", authHandler.ConsumeMagicLink)
+
+			// "This wasn't me" link from a new-device alert - logs out everywhere
+			auth.POST("/devices/report", authHandler.ReportDevice)
 
-			// Google OAuth routes
-			auth.GET("/google", oauthHandler.GoogleLogin)
-			auth.GET("/google/callback", oauthHandler.GoogleCallback)
+			// Links from the email change mails (POST /me/email)
+			auth.POST("/email-change/confirm", accountHandler.ConfirmEmailChange)
+			auth.POST("/email-change/cancel", accountHandler.CancelEmailChange)
 		}
 
 		// Public movie browsing (optional auth for personalization)
 		movies := v1.Group("/movies")
-		movies.Use(middleware.OptionalAuthMiddleware())
+		movies.Use(middleware.OptionalAuthMiddleware(models.ScopeReviewsRead))
 		{
 			movies.GET("", movieHandler.ListMovies)                       // List/search movies
 			movies.GET("/:id", movieHandler.GetMovie)                     // Get movie details
@@ -46,7 +87,7 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 
 		// Public review viewing
 		reviews := v1.Group("/reviews")
-		reviews.Use(middleware.OptionalAuthMiddleware())
+		reviews.Use(middleware.OptionalAuthMiddleware(models.ScopeReviewsRead))
 		{
 			reviews.GET("/:id", reviewHandler.GetReview) // Get single review with comments
 		}
@@ -58,41 +99,157 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 			users.GET("/:id/following", followerHandler.GetFollowing)  // Get users that user follows
 		}
 
-		// Protected routes - authentication required
+		// Review management - session or personal access token with reviews:write
+		authReviews := v1.Group("/reviews")
+		authReviews.Use(middleware.AuthMiddleware(models.ScopeReviewsWrite), requireVerified)
+		{
+			authReviews.POST("", requireFullAccount, reviewHandler.CreateReview)                 // Create review
+			authReviews.PUT("/:id", requireFullAccount, reviewHandler.UpdateReview)              // Update own review
+			authReviews.DELETE("/:id", reviewHandler.DeleteReview)                               // Delete own review or rating
+			authReviews.POST("/:id/lock", requireFullAccount, reviewHandler.LockThread)          // Lock review thread
+			authReviews.POST("/:id/unlock", requireFullAccount, reviewHandler.UnlockThread)      // Unlock review thread
+			authReviews.POST("/comments", requireFullAccount, reviewHandler.CreateComment)       // Add comment
+			authReviews.DELETE("/comments/:id", requireFullAccount, reviewHandler.DeleteComment) // Delete comment
+		}
+
+		// Ratings without a review - the part of reviewing guests can do
+		ratings := v1.Group("/movies")
+		ratings.Use(middleware.AuthMiddleware(models.ScopeReviewsWrite), requireVerified)
+		{
+			ratings.PUT("/:id/rating", reviewHandler.RateMovie) // Rate movie
+		}
+
+		// Watchlist - session or personal access token with lists:read / lists:write
+		watchlist := v1.Group("/me/watchlist")
+		watchlist.Use(middleware.AuthMiddleware(models.ScopeListsRead), requireVerified)
+		{
+			watchlist.GET("", watchlistHandler.GetWatchlist) // List watchlist
+		}
+		editWatchlist := v1.Group("/me/watchlist")
+		editWatchlist.Use(middleware.AuthMiddleware(models.ScopeListsWrite), requireVerified)
+		{
+			editWatchlist.POST("/:movieId", watchlistHandler.AddToWatchlist)       // Add movie
+			editWatchlist.DELETE("/:movieId", watchlistHandler.RemoveFromWatchlist) // Remove movie
+		}
+
+		// Protected routes - login session required (personal access tokens are refused)
 		authenticated := v1.Group("")
 		authenticated.Use(middleware.AuthMiddleware())
 		{
 			// Current user info
 			authenticated.GET("/auth/me", authHandler.GetCurrentUser)
 
-			// Authenticated movie operations
-			authMovies := authenticated.Group("/movies")
+			// Guest upgrade - keeps watchlist and ratings
+			authenticated.POST("/auth/guest/upgrade", guestHandler.Upgrade)
+
+			// Password change - logs out every other session
+			authenticated.POST("/auth/password", requireFullAccount, authHandler.ChangePassword)
+
+			// Session management
+			sessions := authenticated.Group("/auth/sessions")
 			{
-				authMovies.PUT("/:id", movieHandler.UpdateMovie) // Update movie
+				sessions.GET("", authHandler.ListSessions)                   // List active sessions
+				sessions.PATCH("/:id", authHandler.RenameSession)            // Label a session
+				sessions.DELETE("/:id", authHandler.RevokeSession)           // Log out one session
+				sessions.POST("/revoke-all", authHandler.RevokeAllSessions)  // Log out everywhere
+			}
+
+			// Known devices - a sign-in from a new one emails an alert
+			devices := authenticated.Group("/auth/devices")
+			{
+				devices.GET("", authHandler.ListDevices)         // List known devices
+				devices.DELETE("/:id", authHandler.ForgetDevice) // Forget a device
+			}
+
+			// Two-factor authentication enrollment
+			twoFactor := authenticated.Group("/auth/2fa")
+			{
+				twoFactor.POST("/setup", twoFactorHandler.Setup)     // Generate TOTP secret
+				twoFactor.POST("/confirm", twoFactorHandler.Confirm) // Enable with first code
+				twoFactor.POST("/disable", twoFactorHandler.Disable) // Turn off 2FA
+			}
+
+			// Passkeys
+			passkeys := authenticated.Group("/auth/webauthn")
+			passkeys.Use(requireFullAccount)
+			{
+				passkeys.POST("/register/begin", webAuthnHandler.RegisterBegin)       // Options for navigator.credentials.create
+				passkeys.POST("/register/finish", webAuthnHandler.RegisterFinish)     // Store the new passkey
+				passkeys.GET("/credentials", webAuthnHandler.ListCredentials)         // List passkeys
+				passkeys.DELETE("/credentials/:id", webAuthnHandler.DeleteCredential) // Remove a passkey
+			}
+
+			// Personal access tokens for scripts
+			tokens := authenticated.Group("/auth/tokens")
+			tokens.Use(requireFullAccount)
+			{
+				tokens.GET("", accessTokenHandler.ListTokens)          // List tokens
+				tokens.POST("", accessTokenHandler.CreateToken)        // Create token (shown once)
+				tokens.DELETE("/:id", accessTokenHandler.RevokeToken)  // Revoke token
 			}
 
-			// Review management
-			authReviews := authenticated.Group("/reviews")
+			// Personal data export and account deletion
+			account := authenticated.Group("/me")
+			account.Use(requireFullAccount)
 			{
-				authReviews.POST("", reviewHandler.CreateReview)                     // Create review
-				authReviews.PUT("/:id", reviewHandler.UpdateReview)                  // Update own review
-				authReviews.DELETE("/:id", reviewHandler.DeleteReview)               // Delete own review
-				authReviews.POST("/:id/lock", reviewHandler.LockThread)              // Lock review thread
-				authReviews.POST("/:id/unlock", reviewHandler.UnlockThread)          // Unlock review thread
-				authReviews.POST("/comments", reviewHandler.CreateComment)           // Add comment
-				authReviews.DELETE("/comments/:id", reviewHandler.DeleteComment)     // Delete comment
+				account.POST("/export", accountHandler.RequestExport)                // Queue a data export
+				account.GET("/export", accountHandler.GetExport)                     // Export status
+				account.GET("/export/:id/download", accountHandler.DownloadExport)   // Download once
+				account.POST("/email", accountHandler.ChangeEmail)                   // Start an email change
+				account.DELETE("", accountHandler.DeleteAccount)                     // Schedule deletion
+				account.POST("/deletion/cancel", accountHandler.CancelDeletion)      // Keep the account
+				account.GET("/security-events", accountHandler.ListSecurityEvents)   // Security audit log
+			}
+
+			// Linked login methods
+			authenticated.GET("/auth/identities", oauthHandler.ListIdentities)   // Password + linked providers
+			authenticated.GET("/auth/link/:provider", oauthHandler.LinkURL)      // Start linking a provider
+			authenticated.POST("/auth/link/:provider", requireFullAccount, oauthHandler.Link) // Finish linking a provider (guests upgrade instead)
+			authenticated.DELETE("/auth/link/:provider", oauthHandler.Unlink)    // Unlink a provider
+
+			// Catalog edits - moderators and admins only
+			authMovies := authenticated.Group("/movies")
+			authMovies.Use(requireVerified, middleware.RequireRole(models.RoleModerator, models.RoleAdmin))
+			{
+				authMovies.PUT("/:id", movieHandler.UpdateMovie) // Update movie
 			}
 
 			// Follower management
 			authUsers := authenticated.Group("/users")
+			authUsers.Use(requireVerified, requireFullAccount)
 			{
 				authUsers.POST("/:id/follow", followerHandler.FollowUser)            // Follow a user
 				authUsers.DELETE("/:id/follow", followerHandler.UnfollowUser)        // Unfollow a user
 				authUsers.GET("/:id/follow/status", followerHandler.CheckFollowStatus) // Check if following
 			}
+
+			// Moderation - moderators and admins only
+			moderator := authenticated.Group("/moderator")
+			moderator.Use(requireVerified, middleware.RequireRole(models.RoleModerator, models.RoleAdmin))
+			{
+				moderator.GET("/movies/pending", movieHandler.ListPendingMovies)      // Movies awaiting approval
+				moderator.POST("/movies/:id/approve", movieHandler.ApproveMovie)     // Approve movie
+				moderator.POST("/movies/:id/reject", movieHandler.RejectMovie)       // Reject movie
+			}
+
+			// Administration - admins only
+			admin := authenticated.Group("/admin")
+			admin.Use(requireVerified, middleware.RequireRole(models.RoleAdmin))
+			{
+				admin.DELETE("/movies/:id", movieHandler.DeleteMovie)           // Delete movie
+				admin.PUT("/users/:id/role", adminHandler.UpdateUserRole)       // Change user role
+				admin.POST("/users/:id/suspend", adminHandler.SuspendUser)      // Suspend until a date
+				admin.POST("/users/:id/ban", adminHandler.BanUser)              // Ban indefinitely
+				admin.POST("/users/:id/reinstate", adminHandler.ReinstateUser)  // Lift suspension or ban
+				admin.GET("/users/:id/sanctions", adminHandler.ListSanctions)   // Sanctions history
+				admin.GET("/security-events", adminHandler.QuerySecurityEvents) // Search the audit log
+			}
 		}
 	}
 
+	// Token verification keys for other services (no auth required)
+	router.GET("/.well-known/jwks.json", jwksHandler.JWKS)
+
 	// Health check endpoints (no auth required, no rate limiting)
 	router.GET("/health", healthHandler.HealthCheck)
 	router.GET("/health/detailed", healthHandler.DetailedHealthCheck)
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"filmfolk/internal/db"
+	"filmfolk/internal/models"
+	"filmfolk/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// AccessTokenService manages personal access tokens
+type AccessTokenService struct{}
+
+// NewAccessTokenService creates a new access token service
+func NewAccessTokenService() *AccessTokenService {
+	return &AccessTokenService{}
+}
+
+const (
+	// maxAccessTokensPerUser limits active tokens per account
+	maxAccessTokensPerUser = 25
+	// accessTokenUsageInterval throttles last-used writes to one per token per interval
+	accessTokenUsageInterval = time.Minute
+)
+
+// CreateAccessTokenInput represents data for creating a personal access token
+type CreateAccessTokenInput struct {
+	Name          string              `json:"name" binding:"required,max=100"`
+	Scopes        []models.TokenScope `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays *int                `json:"expires_in_days" binding:"omitempty,min=1,max=365"` // omit for no expiry
+}
+
+// CreatedAccessToken is returned once on creation; Token can't be retrieved again
+type CreatedAccessToken struct {
+	Token       string                      `json:"token"`
+	AccessToken *models.PersonalAccessToken `json:"access_token"`
+}
+
+// CreateToken creates a personal access token
+func (s *AccessTokenService) CreateToken(userID uint64, input CreateAccessTokenInput) (*CreatedAccessToken, error) {
+	// 1. Validate scopes
+	scopes := make([]models.TokenScope, 0, len(input.Scopes))
+	seen := make(map[models.TokenScope]bool)
+	for _, scope := range input.Scopes {
+		if !scope.IsValid() {
+			return nil, fmt.Errorf("unknown scope: %s", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	// 2. Check the limit
+	var active int64
+	err := db.DB.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+		Count(&active).Error
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if active >= maxAccessTokensPerUser {
+		return nil, fmt.Errorf("token limit reached (%d), revoke an unused token first", maxAccessTokensPerUser)
+	}
+
+	// 3. Generate token
+	secret, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+	tokenString := models.AccessTokenPrefix + secret
+
+	token := models.PersonalAccessToken{
+		UserID:      userID,
+		Name:        strings.TrimSpace(input.Name),
+		TokenPrefix: tokenString[:len(models.AccessTokenPrefix)+4],
+		TokenHash:   utils.HashToken(tokenString),
+		Scopes:      scopes,
+	}
+	if input.ExpiresInDays != nil {
+		expiresAt := time.Now().AddDate(0, 0, *input.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	// 4. Store the digest only
+	if err := db.DB.Create(&token).Error; err != nil {
+		return nil, fmt.Errorf("failed to create token: %w", err)
+	}
+
+	return &CreatedAccessToken{
+		Token:       tokenString,
+		AccessToken: &token,
+	}, nil
+}
+
+// ListTokens returns the user's tokens that haven't been revoked, newest first
+// Expired tokens are included so the user can see why a script stopped working
+func (s *AccessTokenService) ListTokens(userID uint64) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	err := db.DB.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at DESC").
+		Find(&tokens).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// RevokeToken revokes one of the user's tokens
+func (s *AccessTokenService) RevokeToken(userID, tokenID uint64) error {
+	result := db.DB.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke token: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("token not found")
+	}
+
+	return nil
+}
+
+// Authenticate resolves a personal access token to its user
+// Records when and from where the token was last used
+func (s *AccessTokenService) Authenticate(tokenString, ipAddress string) (*models.User, *models.PersonalAccessToken, error) {
+	// 1. Find token by digest
+	var token models.PersonalAccessToken
+	err := db.DB.Preload("User").
+		Where("token_hash = ?", utils.HashToken(tokenString)).
+		First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errors.New("invalid token")
+		}
+		return nil, nil, fmt.Errorf("database error: %w", err)
+	}
+
+	// 2. Check token and account
+	if !token.IsValid() {
+		return nil, nil, errors.New("invalid token")
+	}
+	if err := checkAccountStatus(&token.User); err != nil {
+		return nil, nil, err
+	}
+
+	// 3. Track usage, at most once a minute per token
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= accessTokenUsageInterval {
+		db.DB.Model(&token).Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": ipAddress,
+		})
+	}
+
+	return &token.User, &token, nil
+}
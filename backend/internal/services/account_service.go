@@ -0,0 +1,425 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/db"
+	"filmfolk/internal/mailer"
+	"filmfolk/internal/models"
+	"filmfolk/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AccountService handles self-service account deletion
+// A deletion request waits out a grace period, then ProcessDueDeletions anonymizes or
+// removes the account. Reviews and comments are reattributed or removed as configured.
+type AccountService struct {
+	cfg *config.Config
+}
+
+// NewAccountService creates a new account service
+func NewAccountService(cfg *config.Config) *AccountService {
+	return &AccountService{cfg: cfg}
+}
+
+// Deletion modes and content policies (ACCOUNT_DELETION_MODE, ACCOUNT_DELETED_CONTENT)
+const (
+	DeletionAnonymize  = "anonymize"
+	DeletionHardDelete = "hard_delete"
+
+	DeletedContentReattribute = "reattribute"
+	DeletedContentRemove      = "remove"
+)
+
+const (
+	// accountDeletionInterval is how often due deletions are looked for
+	accountDeletionInterval = time.Hour
+	// accountDeletionBatch limits how many accounts are deleted per run
+	accountDeletionBatch = 100
+	// deletedEmailDomain is reserved (RFC 2606), anonymized addresses can't receive mail
+	deletedEmailDomain = "deleted.filmfolk.invalid"
+)
+
+// userOwnedTables hold data that goes with the account in every mode
+// Reviews, comments and follows are handled separately, they affect other users
+var userOwnedTables = []string{
+	"review_likes",
+	"comment_likes",
+	"watchlist_items",
+	"refresh_tokens",
+	"personal_access_tokens",
+	"user_identities",
+	"verification_tokens",
+	"recovery_codes",
+	"webauthn_credentials",
+	"webauthn_ceremonies",
+	"magic_links",
+	"known_devices",
+	"email_changes",
+	"oauth_flows",
+	"data_exports",
+	"security_events",
+}
+
+// DeleteAccountInput confirms a deletion request
+// Accounts with a password confirm with it; accounts without one type their username
+type DeleteAccountInput struct {
+	Password string `json:"password"`
+	Confirm  string `json:"confirm"`
+}
+
+// RequestDeletion schedules the account for deletion after the grace period
+// Every other session is signed out; the current one stays so the user can still cancel
+func (s *AccountService) RequestDeletion(userID uint64, sessionID string, input DeleteAccountInput) (*time.Time, error) {
+	// 1. Find user
+	user, err := findUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsDeletionScheduled() {
+		return nil, errors.New("account deletion is already scheduled")
+	}
+
+	// 2. Re-authenticate, throttled like a login
+	if user.PasswordHash != nil {
+		lockout := NewLockoutService(s.cfg)
+		if err := lockout.CheckLoginAllowed(user); err != nil {
+			return nil, err
+		}
+		if !utils.VerifyPassword(*user.PasswordHash, input.Password) {
+			lockout.RecordFailure(user)
+			return nil, errors.New("password is incorrect")
+		}
+	} else if input.Confirm != user.Username {
+		return nil, errors.New("type your username in confirm to delete the account")
+	}
+
+	// 3. Schedule and sign out elsewhere
+	scheduledAt := time.Now().AddDate(0, 0, s.cfg.Account.DeletionGracePeriod)
+	var revoked *sessionRevocation
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("deletion_scheduled_at", scheduledAt).Error; err != nil {
+			return fmt.Errorf("failed to schedule deletion: %w", err)
+		}
+
+		var err error
+		revoked, err = revokeUserSessions(tx, userID, sessionID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := revoked.apply(); err != nil {
+		return nil, err
+	}
+
+	// 4. Tell the owner, in case it wasn't them
+	err = mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your FilmFolk account will be deleted",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nYour FilmFolk account is scheduled for deletion on %s.\n\n"+
+				"Changed your mind? Log in before then and cancel the deletion in your account settings. "+
+				"If you didn't ask for this, log in and change your password right away.\n",
+			user.Username, scheduledAt.Format("January 2, 2006"),
+		),
+	})
+	if err != nil {
+		utils.GetLogger().Error().Err(err).Uint64("user_id", userID).Msg("Failed to send deletion notice")
+	}
+
+	return &scheduledAt, nil
+}
+
+// CancelDeletion keeps an account that is scheduled for deletion
+func (s *AccountService) CancelDeletion(userID uint64) error {
+	result := db.DB.Model(&models.User{}).
+		Where("id = ? AND deletion_scheduled_at IS NOT NULL", userID).
+		Update("deletion_scheduled_at", nil)
+	if result.Error != nil {
+		return fmt.Errorf("failed to cancel deletion: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("no account deletion is scheduled")
+	}
+
+	return nil
+}
+
+// ProcessDueDeletions deletes accounts whose grace period has passed
+func (s *AccountService) ProcessDueDeletions() (int, error) {
+	var userIDs []uint64
+	err := db.DB.Model(&models.User{}).
+		Where("deletion_scheduled_at <= ? AND status <> ?", time.Now(), models.StatusDeleted).
+		Order("deletion_scheduled_at").
+		Limit(accountDeletionBatch).
+		Pluck("id", &userIDs).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find due deletions: %w", err)
+	}
+
+	deleted := 0
+	for _, userID := range userIDs {
+		if err := s.DeleteAccount(userID); err != nil {
+			utils.GetLogger().Error().Err(err).Uint64("user_id", userID).Msg("Failed to delete account")
+			continue
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// RunDeletions processes due deletions periodically
+// Blocks until ctx is cancelled
+func (s *AccountService) RunDeletions(ctx context.Context) {
+	ticker := time.NewTicker(accountDeletionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.ProcessDueDeletions()
+			if err != nil {
+				utils.GetLogger().Error().Err(err).Msg("Failed to process account deletions")
+				continue
+			}
+			if deleted > 0 {
+				utils.GetLogger().Info().Int("count", deleted).Msg("Deleted accounts")
+			}
+		}
+	}
+}
+
+// DeleteAccount deletes a scheduled account now, according to the configured policy
+// Does nothing if the deletion was cancelled in the meantime
+func (s *AccountService) DeleteAccount(userID uint64) error {
+	var (
+		movieIDs    []uint64
+		exportFiles []string
+		revoked     *sessionRevocation
+	)
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. Lock the user and make sure the deletion is still wanted
+		var user models.User
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error
+		if err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+		if !user.IsDeletionScheduled() || user.Status == models.StatusDeleted {
+			return nil
+		}
+
+		// 2. Remember what has to be cleaned up afterwards
+		err = tx.Model(&models.Review{}).Where("user_id = ?", userID).Distinct().Pluck("movie_id", &movieIDs).Error
+		if err != nil {
+			return fmt.Errorf("failed to find reviews: %w", err)
+		}
+		err = tx.Model(&models.DataExport{}).Where("user_id = ? AND file_path IS NOT NULL", userID).Pluck("file_path", &exportFiles).Error
+		if err != nil {
+			return fmt.Errorf("failed to find exports: %w", err)
+		}
+
+		// 3. Sign out everywhere
+		revoked, err = revokeUserSessions(tx, userID, "")
+		if err != nil {
+			return err
+		}
+
+		// 4. Reviews and comments
+		if err := s.handleContent(tx, userID); err != nil {
+			return err
+		}
+
+		// 5. Likes no longer count, follows end (triggers fix the follower counts)
+		if err := removeLikes(tx, userID); err != nil {
+			return err
+		}
+		if err := tx.Where("follower_id = ? OR following_id = ?", userID, userID).Delete(&models.Follower{}).Error; err != nil {
+			return fmt.Errorf("failed to remove follows: %w", err)
+		}
+
+		// 6. The account itself
+		if s.cfg.Account.DeletionMode == DeletionHardDelete {
+			if err := tx.Delete(&models.User{}, userID).Error; err != nil {
+				return fmt.Errorf("failed to delete user: %w", err)
+			}
+			return nil
+		}
+		return anonymizeUser(tx, &user)
+	})
+	if err != nil {
+		return err
+	}
+
+	// 7. Outside the transaction: access tokens, stats and files
+	if err := revoked.apply(); err != nil {
+		utils.GetLogger().Error().Err(err).Uint64("user_id", userID).Msg("Failed to revoke access tokens of deleted account")
+	}
+	movieService := NewMovieService()
+	for _, movieID := range movieIDs {
+		if err := movieService.RecalculateMovieStats(movieID); err != nil {
+			utils.GetLogger().Error().Err(err).Uint64("movie_id", movieID).Msg("Failed to recalculate movie stats")
+		}
+	}
+	for _, path := range exportFiles {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			utils.GetLogger().Error().Err(err).Str("path", path).Msg("Failed to remove data export")
+		}
+	}
+
+	return nil
+}
+
+// handleContent removes the user's reviews and comments or moves them out of the way
+func (s *AccountService) handleContent(tx *gorm.DB, userID uint64) error {
+	if s.cfg.Account.DeletedContent == DeletedContentRemove {
+		return removeContent(tx, userID)
+	}
+
+	// Anonymized accounts keep their content, the row itself becomes the deleted user
+	if s.cfg.Account.DeletionMode != DeletionHardDelete {
+		return nil
+	}
+
+	placeholderID, err := deletedUserID(tx)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Model(&models.Review{}).Where("user_id = ?", userID).Update("user_id", placeholderID).Error; err != nil {
+		return fmt.Errorf("failed to reattribute reviews: %w", err)
+	}
+	if err := tx.Model(&models.ReviewComment{}).Where("user_id = ?", userID).Update("user_id", placeholderID).Error; err != nil {
+		return fmt.Errorf("failed to reattribute comments: %w", err)
+	}
+
+	return nil
+}
+
+// removeContent deletes the user's reviews and comments
+// Replies by other users to a removed comment are kept, moved up to the top level of the thread
+func removeContent(tx *gorm.DB, userID uint64) error {
+	// 1. Keep other users' replies
+	err := tx.Exec(`UPDATE review_comments SET parent_comment_id = NULL
+		WHERE user_id <> ? AND parent_comment_id IN (SELECT id FROM review_comments WHERE user_id = ?)`,
+		userID, userID).Error
+	if err != nil {
+		return fmt.Errorf("failed to keep replies: %w", err)
+	}
+
+	// 2. Delete comments on other users' reviews, then fix their comment counts
+	var reviewIDs []uint64
+	err = tx.Model(&models.ReviewComment{}).Where("user_id = ?", userID).Distinct().Pluck("review_id", &reviewIDs).Error
+	if err != nil {
+		return fmt.Errorf("failed to find comments: %w", err)
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.ReviewComment{}).Error; err != nil {
+		return fmt.Errorf("failed to delete comments: %w", err)
+	}
+	if len(reviewIDs) > 0 {
+		err = tx.Exec(`UPDATE reviews SET comments_count =
+			(SELECT COUNT(*) FROM review_comments c WHERE c.review_id = reviews.id)
+			WHERE id IN ?`, reviewIDs).Error
+		if err != nil {
+			return fmt.Errorf("failed to update comment counts: %w", err)
+		}
+	}
+
+	// 3. Delete reviews, along with their threads
+	if err := tx.Where("user_id = ?", userID).Delete(&models.Review{}).Error; err != nil {
+		return fmt.Errorf("failed to delete reviews: %w", err)
+	}
+
+	return nil
+}
+
+// removeLikes deletes the user's likes and takes them off the like counts
+func removeLikes(tx *gorm.DB, userID uint64) error {
+	err := tx.Exec(`UPDATE reviews SET likes_count = GREATEST(likes_count - 1, 0)
+		WHERE id IN (SELECT review_id FROM review_likes WHERE user_id = ?)`, userID).Error
+	if err != nil {
+		return fmt.Errorf("failed to update like counts: %w", err)
+	}
+	err = tx.Exec(`UPDATE review_comments SET likes_count = GREATEST(likes_count - 1, 0)
+		WHERE id IN (SELECT comment_id FROM comment_likes WHERE user_id = ?)`, userID).Error
+	if err != nil {
+		return fmt.Errorf("failed to update like counts: %w", err)
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&models.ReviewLike{}).Error; err != nil {
+		return fmt.Errorf("failed to delete likes: %w", err)
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.CommentLike{}).Error; err != nil {
+		return fmt.Errorf("failed to delete likes: %w", err)
+	}
+
+	return nil
+}
+
+// anonymizeUser wipes personal data from the user row and everything hanging off it
+// The row stays so kept content has an author, shown as deleted_<random>
+func anonymizeUser(tx *gorm.DB, user *models.User) error {
+	// Random like guest names - an ID-based name could already be taken by a real user
+	suffix, err := utils.GenerateSecureToken(6)
+	if err != nil {
+		return err
+	}
+	suffix = strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(suffix))
+
+	for _, table := range userOwnedTables {
+		if err := tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", user.ID).Error; err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+	}
+
+	err = tx.Model(user).Updates(map[string]interface{}{
+		"username":              "deleted_" + suffix,
+		"email":                 fmt.Sprintf("%d@%s", user.ID, deletedEmailDomain),
+		"password_hash":         nil,
+		"auth_provider":         models.AuthSystem,
+		"provider_id":           nil,
+		"status":                models.StatusDeleted,
+		"role":                  models.RoleUser,
+		"avatar_url":            nil,
+		"bio":                   nil,
+		"last_login_at":         nil,
+		"email_verified_at":     nil,
+		"totp_secret":           nil,
+		"two_factor_enabled_at": nil,
+		"webauthn_user_handle":  nil,
+		"failed_login_count":    0,
+		"last_failed_login_at":  nil,
+		"locked_until":          nil,
+		"deletion_scheduled_at": nil,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to anonymize user: %w", err)
+	}
+
+	return nil
+}
+
+// deletedUserID returns the ID of the placeholder account created by migration 016
+func deletedUserID(tx *gorm.DB) (uint64, error) {
+	var user models.User
+	err := tx.Select("id").
+		Where("email = ? AND auth_provider = ?", models.DeletedUserEmail, models.AuthSystem).
+		First(&user).Error
+	if err != nil {
+		return 0, fmt.Errorf("deleted user placeholder missing: %w", err)
+	}
+	return user.ID, nil
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"filmfolk/internal/db"
+	"filmfolk/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// AdminService handles administrative user management
+type AdminService struct{}
+
+// NewAdminService creates a new admin service
+func NewAdminService() *AdminService {
+	return &AdminService{}
+}
+
+// UpdateRoleInput represents data for changing a user's role
+type UpdateRoleInput struct {
+	Role models.UserRole `json:"role" binding:"required,oneof=user moderator admin"`
+}
+
+// UpdateUserRole changes a user's role
+// Access tokens already issued keep the old role until they are refreshed
+func (s *AdminService) UpdateUserRole(targetUserID, adminID uint64, role models.UserRole, device DeviceInfo) (*models.User, error) {
+	if !role.IsValid() {
+		return nil, errors.New("invalid role")
+	}
+
+	// An admin demoting themselves could leave the system without any admin
+	if targetUserID == adminID {
+		return nil, errors.New("cannot change your own role")
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, targetUserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	oldRole := user.Role
+	if err := db.DB.Model(&user).Update("role", role).Error; err != nil {
+		return nil, fmt.Errorf("failed to update role: %w", err)
+	}
+
+	RecordSecurityEvent(models.SecurityEvent{
+		UserID:    &user.ID,
+		ActorID:   &adminID,
+		EventType: models.EventRoleChanged,
+		Details:   map[string]string{"old_role": string(oldRole), "new_role": string(role)},
+	}, device)
+
+	return &user, nil
+}
@@ -8,9 +8,13 @@ import (
 	"filmfolk/internal/config"
 	"filmfolk/internal/db"
 	"filmfolk/internal/models"
+	"filmfolk/internal/passwordpolicy"
+	"filmfolk/internal/revocation"
 	"filmfolk/internal/utils"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // AuthService handles all authentication logic
@@ -27,24 +31,35 @@ func NewAuthService(cfg *config.Config) *AuthService {
 type RegisterInput struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8,max=100"`
+	Password string `json:"password" binding:"required"` // checked by the password policy
 }
 
 // LoginInput represents user login data
 type LoginInput struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	Email       string `json:"email" binding:"required,email"`
+	Password    string `json:"password" binding:"required"`
+	DeviceLabel string `json:"device_label" binding:"omitempty,max=100"` // Optional name for this session
+}
+
+// DeviceInfo describes the client a session is created from
+// Captured by handlers from the request and stored alongside the refresh token
+type DeviceInfo struct {
+	UserAgent string
+	IPAddress string
+	Label     string // user-chosen, may be empty
+	RequestID string // from RequestIDMiddleware, for the security audit log
 }
 
 // AuthResponse contains tokens returned after successful auth
 type AuthResponse struct {
 	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	ExpiresIn    int    `json:"expires_in"` // seconds until access token expires
+	RefreshToken string `json:"refresh_token,omitempty"` // in the session cookie instead in cookie mode
+	ExpiresIn    int    `json:"expires_in"`              // seconds until access token expires
+	CSRFToken    string `json:"csrf_token,omitempty"`    // cookie mode only, send as X-CSRF-Token
 }
 
 // Register creates a new user account
-func (s *AuthService) Register(input RegisterInput) (*AuthResponse, error) {
+func (s *AuthService) Register(input RegisterInput, device DeviceInfo) (*AuthResponse, error) {
 	// 1. Check if email already exists
 	var existingUser models.User
 	err := db.DB.Where("email = ?", input.Email).First(&existingUser).Error
@@ -56,6 +71,9 @@ func (s *AuthService) Register(input RegisterInput) (*AuthResponse, error) {
 	}
 
 	// 2. Check if username already exists
+	if models.IsReservedUsername(input.Username) {
+		return nil, errors.New("username already taken")
+	}
 	err = db.DB.Where("username = ?", input.Username).First(&existingUser).Error
 	if err == nil {
 		return nil, errors.New("username already taken")
@@ -64,7 +82,10 @@ func (s *AuthService) Register(input RegisterInput) (*AuthResponse, error) {
 		return nil, fmt.Errorf("database error: %w", err)
 	}
 
-	// 3. Hash the password
+	// 3. Check and hash the password
+	if err := passwordpolicy.Check(input.Password, input.Username, input.Email); err != nil {
+		return nil, err
+	}
 	hashedPassword, err := utils.HashPassword(input.Password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
@@ -83,136 +104,332 @@ func (s *AuthService) Register(input RegisterInput) (*AuthResponse, error) {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
-	// 5. Generate tokens
-	return s.generateAuthResponse(&user)
+	// 5. Send verification email
+	// Don't fail registration over mail delivery - the user can ask for a resend
+	if err := NewVerificationService(s.cfg).SendVerificationEmail(&user); err != nil {
+		utils.GetLogger().Error().
+			Err(err).
+			Uint64("user_id", user.ID).
+			Msg("Failed to send verification email")
+	}
+
+	// 6. Generate tokens
+	recordUserEvent(models.EventRegister, user.ID, device, nil)
+	NewKnownDeviceService(s.cfg).noteLogin(&user, device)
+	return s.generateAuthResponse(&user, device)
 }
 
 // Login authenticates a user and returns tokens
-func (s *AuthService) Login(input LoginInput) (*AuthResponse, error) {
+// If the account has 2FA enabled, no tokens are issued yet: an MFAChallenge is returned
+// instead and the login is completed with TwoFactorService.VerifyLogin
+func (s *AuthService) Login(input LoginInput, device DeviceInfo) (*AuthResponse, *MFAChallenge, error) {
 	// 1. Find user by email
 	var user models.User
 	err := db.DB.Where("email = ?", input.Email).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("invalid email or password")
+			return nil, nil, s.failUnknownLogin(input, device)
 		}
-		return nil, fmt.Errorf("database error: %w", err)
+		return nil, nil, fmt.Errorf("database error: %w", err)
 	}
 
-	// 2. Check if account is active
-	if user.Status != models.StatusActive {
-		return nil, fmt.Errorf("account is %s", user.Status)
+	// 2. Refuse while locked out or within the delay after a failure
+	// Checked before the password so a locked account doesn't confirm guesses.
+	// Unknown emails are throttled the same way, so this doesn't reveal the account
+	lockout := NewLockoutService(s.cfg)
+	if err := lockout.CheckLoginAllowed(&user); err != nil {
+		recordLoginFailure(user.ID, device, map[string]string{"reason": "throttled"})
+		return nil, nil, err
 	}
 
 	// 3. Verify password
 	if user.PasswordHash == nil {
-		return nil, errors.New("this account uses OAuth login")
+		recordLoginFailure(user.ID, device, map[string]string{"reason": "no_password"})
+		return nil, nil, errors.New("this account uses OAuth login")
 	}
 
 	if !utils.VerifyPassword(*user.PasswordHash, input.Password) {
-		return nil, errors.New("invalid email or password")
+		lockout.RecordFailure(&user)
+		recordLoginFailure(user.ID, device, map[string]string{"reason": "wrong_password"})
+		return nil, nil, errors.New("invalid email or password")
 	}
 
-	// 4. Update last login time
+	// 4. Check if account is active
+	// Only after the password, the reason for a suspension or ban is for the owner's eyes
+	if err := checkAccountStatus(&user); err != nil {
+		recordLoginFailure(user.ID, device, map[string]string{"reason": "account_" + string(user.Status)})
+		return nil, nil, err
+	}
+
+	// Upgrade hashes made with an older algorithm or cost while the password is at hand
+	if utils.PasswordNeedsRehash(*user.PasswordHash) {
+		s.rehashPassword(&user, input.Password)
+	}
+
+	// 5. Ask for the second factor if enabled
+	// The failure counter is only reset once the whole login succeeds
+	mfaEnabled, err := isMFAEnabled(db.DB, &user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mfaEnabled {
+		challenge, err := NewTwoFactorService(s.cfg).newChallenge(&user)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, challenge, nil
+	}
+
+	// 6. Update last login time
+	lockout.RecordSuccess(&user)
 	now := time.Now()
 	user.LastLoginAt = &now
 	db.DB.Model(&user).Update("last_login_at", now)
+	recordUserEvent(models.EventLogin, user.ID, device, map[string]string{"method": "password"})
+	NewKnownDeviceService(s.cfg).noteLogin(&user, device)
+	NewVerificationService(s.cfg).remindUnverified(&user)
+
+	// 7. Generate tokens
+	response, err := s.generateAuthResponse(&user, device)
+	return response, nil, err
+}
+
+// failUnknownLogin answers a login for an email without an account like a wrong password:
+// same error, same time spent hashing, and the same delays and lockout after repeated tries
+func (s *AuthService) failUnknownLogin(input LoginInput, device DeviceInfo) error {
+	lockout := NewLockoutService(s.cfg)
+	if err := lockout.CheckUnknownLogin(input.Email); err != nil {
+		recordLoginFailure(0, device, map[string]string{"reason": "throttled"})
+		return err
+	}
+
+	utils.VerifyDummyPassword(input.Password)
+	lockout.RecordUnknownFailure(input.Email)
+	// Only a digest: people type passwords into the email field, and non-users' addresses aren't ours to keep
+	recordLoginFailure(0, device, map[string]string{"reason": "unknown_email", "email_hash": unknownLoginKey(input.Email)})
+	return errors.New("invalid email or password")
+}
+
+// rehashPassword stores the password hashed with the current settings
+// Best effort - the old hash keeps working if this fails
+func (s *AuthService) rehashPassword(user *models.User, password string) {
+	hashedPassword, err := utils.HashPassword(password)
+	if err == nil {
+		// Only replace the hash that was verified, a concurrent password change wins
+		err = db.DB.Model(&models.User{}).
+			Where("id = ? AND password_hash = ?", user.ID, *user.PasswordHash).
+			Update("password_hash", hashedPassword).Error
+	}
+	if err != nil {
+		utils.GetLogger().Error().Err(err).Uint64("user_id", user.ID).Msg("Failed to upgrade password hash")
+		return
+	}
 
-	// 5. Generate tokens
-	return s.generateAuthResponse(&user)
+	user.PasswordHash = &hashedPassword
 }
 
-// RefreshAccessToken generates a new access token from a refresh token
-func (s *AuthService) RefreshAccessToken(refreshTokenString string) (*AuthResponse, error) {
+// RefreshAccessToken rotates a refresh token and issues a new token pair
+// The presented token is revoked and replaced by a child in the same family.
+// If a token that was already rotated is presented again, the whole family is revoked.
+func (s *AuthService) RefreshAccessToken(refreshTokenString string, device DeviceInfo) (*AuthResponse, error) {
 	// 1. Validate refresh token format
 	userID, err := utils.ValidateRefreshToken(refreshTokenString)
 	if err != nil {
 		return nil, errors.New("invalid refresh token")
 	}
 
-	// 2. Check if refresh token exists in database and is valid
-	var refreshToken models.RefreshToken
-	err = db.DB.Where("token = ? AND user_id = ?", refreshTokenString, userID).First(&refreshToken).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("refresh token not found")
+	var response *AuthResponse
+	var familyID, reusedFamilyID string
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		// 2. Lock the token row so two concurrent refreshes can't both rotate it
+		var refreshToken models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND user_id = ?", utils.HashToken(refreshTokenString), userID).
+			First(&refreshToken).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("refresh token not found")
+			}
+			return fmt.Errorf("database error: %w", err)
 		}
-		return nil, fmt.Errorf("database error: %w", err)
-	}
 
-	// 3. Check if token is valid (not revoked, not expired)
-	if !refreshToken.IsValid() {
-		return nil, errors.New("refresh token expired or revoked")
-	}
+		// 3. Reuse detection - a rotated token should never come back
+		// Revoke the family and commit, the caller gets an error afterwards
+		if refreshToken.IsRotated() {
+			reusedFamilyID = refreshToken.FamilyID
+			return revokeTokenFamily(tx, refreshToken.FamilyID)
+		}
 
-	// 4. Get user
-	var user models.User
-	err = db.DB.First(&user, userID).Error
-	if err != nil {
-		return nil, fmt.Errorf("user not found: %w", err)
-	}
+		// 4. Check if token is valid (not revoked, not expired)
+		if !refreshToken.IsValid() {
+			return errors.New("refresh token expired or revoked")
+		}
 
-	// 5. Check if user is active
-	if user.Status != models.StatusActive {
-		return nil, fmt.Errorf("account is %s", user.Status)
-	}
+		// 5. Get user (fresh from DB so role and status changes apply on refresh)
+		var user models.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return fmt.Errorf("user not found: %w", err)
+		}
+
+		// 6. Check if user is active
+		if err := checkAccountStatus(&user); err != nil {
+			return err
+		}
 
-	// 6. Generate new access token (keep same refresh token)
-	accessToken, err := utils.GenerateAccessToken(&user, s.cfg.Jwt.AccessTokenTTL)
+		// 7. Issue the child token and retire the presented one
+		// The session keeps its label and start time, device info follows the latest client
+		newToken := models.RefreshToken{
+			UserID:           user.ID,
+			FamilyID:         refreshToken.FamilyID,
+			ParentID:         &refreshToken.ID,
+			UserAgent:        device.UserAgent,
+			IPAddress:        device.IPAddress,
+			Label:            refreshToken.Label,
+			SessionStartedAt: refreshToken.SessionStartedAt,
+		}
+		newTokenString, err := s.issueRefreshToken(tx, &newToken)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		err = tx.Model(&refreshToken).Updates(map[string]interface{}{
+			"revoked_at":     now,
+			"replaced_by_id": newToken.ID,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to rotate refresh token: %w", err)
+		}
+
+		// 8. Generate new access token
+		accessToken, err := utils.GenerateAccessToken(&user, refreshToken.FamilyID, s.cfg.Jwt.AccessTokenTTL)
+		if err != nil {
+			return fmt.Errorf("failed to generate access token: %w", err)
+		}
+
+		response = &AuthResponse{
+			AccessToken:  accessToken,
+			RefreshToken: newTokenString,
+			ExpiresIn:    s.cfg.Jwt.AccessTokenTTL * 60,
+		}
+		familyID = refreshToken.FamilyID
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
+		return nil, err
 	}
 
-	return &AuthResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshTokenString,
-		ExpiresIn:    s.cfg.Jwt.AccessTokenTTL * 60,
-	}, nil
+	if reusedFamilyID != "" {
+		if err := revocation.RevokeSession(reusedFamilyID); err != nil {
+			return nil, fmt.Errorf("failed to revoke session access tokens: %w", err)
+		}
+		utils.GetLogger().Warn().
+			Uint64("user_id", userID).
+			Str("family_id", reusedFamilyID).
+			Msg("Refresh token reuse detected - token family revoked")
+		recordUserEvent(models.EventRefreshTokenReuse, userID, device, map[string]string{"session_id": reusedFamilyID})
+		return nil, errors.New("refresh token reuse detected, please log in again")
+	}
+
+	recordUserEvent(models.EventTokenRefresh, userID, device, map[string]string{"session_id": familyID})
+	return response, nil
 }
 
-// Logout revokes a refresh token
-func (s *AuthService) Logout(refreshTokenString string) error {
-	now := time.Now()
-	result := db.DB.Model(&models.RefreshToken{}).
-		Where("token = ?", refreshTokenString).
-		Update("revoked_at", now)
+// Logout ends the session the refresh token belongs to
+// Access tokens issued for the session stop working immediately too, as does the
+// access token the request was made with (if any)
+func (s *AuthService) Logout(refreshTokenString, accessTokenID string, accessExpiresAt time.Time, device DeviceInfo) error {
+	// The presented access token may belong to another session, or to none
+	if err := revocation.RevokeToken(accessTokenID, accessExpiresAt); err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
 
-	if result.Error != nil {
-		return fmt.Errorf("failed to revoke token: %w", result.Error)
+	var refreshToken models.RefreshToken
+	err := db.DB.Select("id", "user_id", "family_id").
+		Where("token_hash = ?", utils.HashToken(refreshTokenString)).
+		First(&refreshToken).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Unknown token - nothing to revoke, logout is idempotent
+			return nil
+		}
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	if err := revokeTokenFamily(db.DB, refreshToken.FamilyID); err != nil {
+		return err
+	}
+	if err := revocation.RevokeSession(refreshToken.FamilyID); err != nil {
+		return fmt.Errorf("failed to revoke session access tokens: %w", err)
 	}
 
+	recordUserEvent(models.EventLogout, refreshToken.UserID, device, map[string]string{"session_id": refreshToken.FamilyID})
 	return nil
 }
 
 // generateAuthResponse creates tokens and response
-func (s *AuthService) generateAuthResponse(user *models.User) (*AuthResponse, error) {
-	// 1. Generate access token
-	accessToken, err := utils.GenerateAccessToken(user, s.cfg.Jwt.AccessTokenTTL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
+// Each call starts a new session (refresh token family) for the given device
+func (s *AuthService) generateAuthResponse(user *models.User, device DeviceInfo) (*AuthResponse, error) {
+	// 1. Generate and store refresh token, starting a new rotation family
+	refreshToken := models.RefreshToken{
+		UserID:           user.ID,
+		FamilyID:         uuid.NewString(),
+		UserAgent:        device.UserAgent,
+		IPAddress:        device.IPAddress,
+		SessionStartedAt: time.Now(),
 	}
-
-	// 2. Generate refresh token
-	refreshTokenString, expiresAt, err := utils.GenerateRefreshToken(user.ID, s.cfg.Jwt.RefreshTokenTTL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	if device.Label != "" {
+		refreshToken.Label = &device.Label
 	}
 
-	// 3. Store refresh token in database
-	refreshToken := models.RefreshToken{
-		UserID:    user.ID,
-		Token:     refreshTokenString,
-		ExpiresAt: expiresAt,
+	refreshTokenString, err := s.issueRefreshToken(db.DB, &refreshToken)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := db.DB.Create(&refreshToken).Error; err != nil {
-		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	// 2. Generate access token bound to the new session
+	accessToken, err := utils.GenerateAccessToken(user, refreshToken.FamilyID, s.cfg.Jwt.AccessTokenTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
-	// 4. Return response
+	// 3. Return response
 	return &AuthResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshTokenString,
 		ExpiresIn:    s.cfg.Jwt.AccessTokenTTL * 60, // convert minutes to seconds
 	}, nil
 }
+
+// issueRefreshToken generates a refresh token and stores it
+// refreshToken must carry the user, family and device metadata; the rest is filled in here
+func (s *AuthService) issueRefreshToken(tx *gorm.DB, refreshToken *models.RefreshToken) (string, error) {
+	refreshTokenString, expiresAt, err := utils.GenerateRefreshToken(refreshToken.UserID, s.cfg.Jwt.RefreshTokenTTL)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	refreshToken.TokenHash = utils.HashToken(refreshTokenString)
+	refreshToken.ExpiresAt = expiresAt
+	refreshToken.LastUsedAt = time.Now()
+
+	if err := tx.Create(refreshToken).Error; err != nil {
+		return "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return refreshTokenString, nil
+}
+
+// revokeTokenFamily revokes every still-active token in a rotation family
+// Only touches the database; once committed, the caller denylists the session
+// with revocation.RevokeSession so its access tokens are rejected as well
+func revokeTokenFamily(tx *gorm.DB, familyID string) error {
+	err := tx.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("failed to revoke token family: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,480 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/db"
+	"filmfolk/internal/mailer"
+	"filmfolk/internal/models"
+	"filmfolk/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// DataExportService builds personal data archives
+// Requests are queued in data_exports and built by Run in the background
+type DataExportService struct {
+	cfg *config.Config
+}
+
+// NewDataExportService creates a new data export service
+func NewDataExportService(cfg *config.Config) *DataExportService {
+	return &DataExportService{cfg: cfg}
+}
+
+const (
+	// exportRequestInterval limits how often a user can ask for a new export
+	exportRequestInterval = time.Hour
+	// exportPollInterval is how often the queue is checked without a wake-up
+	exportPollInterval = time.Minute
+	// exportStaleAfter requeues exports whose builder died (e.g. a restart mid-build)
+	exportStaleAfter = 30 * time.Minute
+)
+
+// exportWake nudges Run when a new export is requested
+var exportWake = make(chan struct{}, 1)
+
+// RequestExport queues a data export for the user
+// A finished export that wasn't downloaded yet is replaced
+func (s *DataExportService) RequestExport(userID uint64) (*models.DataExport, error) {
+	// 1. One export at a time, and not too often
+	var latest models.DataExport
+	err := db.DB.Where("user_id = ?", userID).Order("created_at DESC").First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if err == nil {
+		if latest.Status == models.ExportPending || latest.Status == models.ExportProcessing {
+			return nil, errors.New("a data export is already being prepared")
+		}
+		if time.Since(latest.CreatedAt) < exportRequestInterval && latest.Status != models.ExportFailed {
+			return nil, errors.New("a data export was requested recently, try again later")
+		}
+	}
+
+	// 2. Retire an archive that was never downloaded
+	if err := s.expireExports(db.DB.Where("user_id = ? AND status = ?", userID, models.ExportReady)); err != nil {
+		return nil, err
+	}
+
+	// 3. Queue
+	export := models.DataExport{
+		UserID: userID,
+		Status: models.ExportPending,
+	}
+	if err := db.DB.Create(&export).Error; err != nil {
+		return nil, fmt.Errorf("failed to request export: %w", err)
+	}
+
+	select {
+	case exportWake <- struct{}{}:
+	default:
+	}
+
+	return &export, nil
+}
+
+// GetLatestExport returns the user's most recent export request
+func (s *DataExportService) GetLatestExport(userID uint64) (*models.DataExport, error) {
+	var export models.DataExport
+	err := db.DB.Where("user_id = ?", userID).Order("created_at DESC").First(&export).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("no data export found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return &export, nil
+}
+
+// OpenDownload hands out a ready archive, once
+// The export is marked downloaded and the file unlinked before it's returned;
+// the open handle stays readable until the caller closes it
+func (s *DataExportService) OpenDownload(userID, exportID uint64) (*os.File, int64, error) {
+	// 1. Claim - only one request can flip ready to downloaded
+	var export models.DataExport
+	result := db.DB.Raw(`UPDATE data_exports SET status = ?, downloaded_at = ?
+		WHERE id = ? AND user_id = ? AND status = ? AND expires_at > ?
+		RETURNING *`,
+		models.ExportDownloaded, time.Now(), exportID, userID, models.ExportReady, time.Now(),
+	).Scan(&export)
+	if result.Error != nil {
+		return nil, 0, fmt.Errorf("database error: %w", result.Error)
+	}
+	if result.RowsAffected == 0 || export.FilePath == nil {
+		return nil, 0, errors.New("export not found or no longer available")
+	}
+
+	// 2. Open and unlink
+	file, err := os.Open(*export.FilePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open export: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to open export: %w", err)
+	}
+	removeExportFile(*export.FilePath)
+
+	return file, info.Size(), nil
+}
+
+// Run builds queued exports and expires old ones
+// Blocks until ctx is cancelled
+func (s *DataExportService) Run(ctx context.Context) {
+	ticker := time.NewTicker(exportPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Build everything that's queued
+		for {
+			built, err := s.buildNext()
+			if err != nil {
+				utils.GetLogger().Error().Err(err).Msg("Failed to build data export")
+			}
+			if !built || ctx.Err() != nil {
+				break
+			}
+		}
+
+		if err := s.expireExports(db.DB.Where("status = ? AND expires_at <= ?", models.ExportReady, time.Now())); err != nil {
+			utils.GetLogger().Error().Err(err).Msg("Failed to expire data exports")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-exportWake:
+		}
+	}
+}
+
+// buildNext claims one queued export and builds it
+// Returns false if the queue was empty
+func (s *DataExportService) buildNext() (bool, error) {
+	// 1. Claim - SKIP LOCKED lets several instances share the queue
+	var export models.DataExport
+	now := time.Now()
+	result := db.DB.Raw(`UPDATE data_exports SET status = ?, started_at = ?
+		WHERE id = (
+			SELECT id FROM data_exports
+			WHERE status = ? OR (status = ? AND started_at < ?)
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		models.ExportProcessing, now, models.ExportPending, models.ExportProcessing, now.Add(-exportStaleAfter),
+	).Scan(&export)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to claim export: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	// 2. Build the archive
+	path, size, err := s.writeArchive(&export)
+	if err != nil {
+		db.DB.Model(&export).Updates(map[string]interface{}{
+			"status":       models.ExportFailed,
+			"completed_at": time.Now(),
+		})
+		return true, fmt.Errorf("export %d: %w", export.ID, err)
+	}
+
+	// 3. Mark ready
+	completedAt := time.Now()
+	expiresAt := completedAt.Add(time.Duration(s.cfg.Account.ExportTTL) * time.Hour)
+	err = db.DB.Model(&export).Updates(map[string]interface{}{
+		"status":       models.ExportReady,
+		"file_path":    path,
+		"size_bytes":   size,
+		"completed_at": completedAt,
+		"expires_at":   expiresAt,
+	}).Error
+	if err != nil {
+		removeExportFile(path)
+		return true, fmt.Errorf("failed to update export: %w", err)
+	}
+
+	// 4. Let the user know
+	s.sendReadyEmail(export.UserID, expiresAt)
+
+	return true, nil
+}
+
+// writeArchive collects the user's data into a zip file in the export directory
+func (s *DataExportService) writeArchive(export *models.DataExport) (string, int64, error) {
+	files, err := collectExportData(export.UserID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := os.MkdirAll(s.cfg.Account.ExportDir, 0o700); err != nil {
+		return "", 0, fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	// Unguessable name, written under a temporary name and renamed when complete
+	suffix, err := utils.GenerateSecureToken(16)
+	if err != nil {
+		return "", 0, err
+	}
+	path := filepath.Join(s.cfg.Account.ExportDir, fmt.Sprintf("export-%d-%s.zip", export.ID, suffix))
+
+	tmp, err := os.CreateTemp(s.cfg.Account.ExportDir, "export-*.tmp")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	archive := zip.NewWriter(tmp)
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			tmp.Close()
+			return "", 0, err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			tmp.Close()
+			return "", 0, fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		tmp.Close()
+		return "", 0, err
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return "", 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, fmt.Errorf("failed to store export: %w", err)
+	}
+
+	return path, info.Size(), nil
+}
+
+// expireExports marks the matched ready exports expired and deletes their files
+func (s *DataExportService) expireExports(query *gorm.DB) error {
+	var exports []models.DataExport
+	if err := query.Find(&exports).Error; err != nil {
+		return fmt.Errorf("failed to find exports: %w", err)
+	}
+
+	for _, export := range exports {
+		result := db.DB.Model(&models.DataExport{}).
+			Where("id = ? AND status = ?", export.ID, models.ExportReady).
+			Update("status", models.ExportExpired)
+		if result.Error != nil {
+			return fmt.Errorf("failed to expire export: %w", result.Error)
+		}
+		// Lost the race to a download, which removes the file itself
+		if result.RowsAffected > 0 && export.FilePath != nil {
+			removeExportFile(*export.FilePath)
+		}
+	}
+
+	return nil
+}
+
+// sendReadyEmail tells the user their export can be downloaded
+func (s *DataExportService) sendReadyEmail(userID uint64, expiresAt time.Time) {
+	user, err := findUserByID(userID)
+	if err == nil {
+		link := fmt.Sprintf("%s/settings/export", s.cfg.App.FrontendURL)
+		err = mailer.Send(mailer.Message{
+			To:      user.Email,
+			Subject: "Your FilmFolk data export is ready",
+			Body: fmt.Sprintf(
+				"Hi %s,\n\nThe copy of your FilmFolk data you asked for is ready:\n\n%s\n\n"+
+					"It can be downloaded once, until %s.\n",
+				user.Username, link, expiresAt.Format("January 2, 2006 15:04 MST"),
+			),
+		})
+	}
+	if err != nil {
+		utils.GetLogger().Error().Err(err).Uint64("user_id", userID).Msg("Failed to send export email")
+	}
+}
+
+// removeExportFile deletes an archive, logging failures
+func removeExportFile(path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		utils.GetLogger().Error().Err(err).Str("path", path).Msg("Failed to remove data export")
+	}
+}
+
+// exportFile is one JSON document in the archive
+type exportFile struct {
+	name string
+	data interface{}
+}
+
+// Rows of the archive, with names instead of bare IDs where that helps
+type (
+	exportReview struct {
+		ID         uint64    `json:"id"`
+		MovieID    uint64    `json:"movie_id"`
+		MovieTitle string    `json:"movie_title"`
+		Rating     int       `json:"rating"`
+		ReviewText string    `json:"review_text"`
+		CreatedAt  time.Time `json:"created_at"`
+		UpdatedAt  time.Time `json:"updated_at"`
+	}
+	exportComment struct {
+		ID              uint64    `json:"id"`
+		ReviewID        uint64    `json:"review_id"`
+		ParentCommentID *uint64   `json:"parent_comment_id,omitempty"`
+		CommentText     string    `json:"comment_text"`
+		CreatedAt       time.Time `json:"created_at"`
+		UpdatedAt       time.Time `json:"updated_at"`
+	}
+	exportLike struct {
+		ID        uint64    `json:"id"` // review or comment ID
+		CreatedAt time.Time `json:"created_at"`
+	}
+	exportFollow struct {
+		UserID    uint64    `json:"user_id"`
+		Username  string    `json:"username"`
+		CreatedAt time.Time `json:"since"`
+	}
+	exportWatchlistItem struct {
+		MovieID    uint64    `json:"movie_id"`
+		MovieTitle string    `json:"movie_title"`
+		CreatedAt  time.Time `json:"added_at"`
+	}
+)
+
+// collectExportData loads everything the archive contains
+// Empty lists are written as [] rather than null
+func collectExportData(userID uint64) ([]exportFile, error) {
+	user, err := findUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identities := []models.UserIdentity{}
+	if err := db.DB.Where("user_id = ?", userID).Find(&identities).Error; err != nil {
+		return nil, fmt.Errorf("failed to load identities: %w", err)
+	}
+
+	passkeys := []models.WebAuthnCredential{}
+	if err := db.DB.Where("user_id = ?", userID).Order("created_at").Find(&passkeys).Error; err != nil {
+		return nil, fmt.Errorf("failed to load passkeys: %w", err)
+	}
+
+	reviews := []exportReview{}
+	err = db.DB.Table("reviews").
+		Select("reviews.id, reviews.movie_id, movies.title AS movie_title, reviews.rating, reviews.review_text, reviews.created_at, reviews.updated_at").
+		Joins("JOIN movies ON movies.id = reviews.movie_id").
+		Where("reviews.user_id = ?", userID).
+		Order("reviews.created_at").
+		Scan(&reviews).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load reviews: %w", err)
+	}
+
+	comments := []exportComment{}
+	err = db.DB.Table("review_comments").
+		Select("id, review_id, parent_comment_id, comment_text, created_at, updated_at").
+		Where("user_id = ?", userID).
+		Order("created_at").
+		Scan(&comments).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load comments: %w", err)
+	}
+
+	reviewLikes, commentLikes := []exportLike{}, []exportLike{}
+	err = db.DB.Table("review_likes").Select("review_id AS id, created_at").
+		Where("user_id = ?", userID).Order("created_at").Scan(&reviewLikes).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load likes: %w", err)
+	}
+	err = db.DB.Table("comment_likes").Select("comment_id AS id, created_at").
+		Where("user_id = ?", userID).Order("created_at").Scan(&commentLikes).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load likes: %w", err)
+	}
+
+	following, followers := []exportFollow{}, []exportFollow{}
+	err = db.DB.Table("followers").
+		Select("users.id AS user_id, users.username, followers.created_at").
+		Joins("JOIN users ON users.id = followers.following_id").
+		Where("followers.follower_id = ?", userID).
+		Order("followers.created_at").
+		Scan(&following).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load follows: %w", err)
+	}
+	err = db.DB.Table("followers").
+		Select("users.id AS user_id, users.username, followers.created_at").
+		Joins("JOIN users ON users.id = followers.follower_id").
+		Where("followers.following_id = ?", userID).
+		Order("followers.created_at").
+		Scan(&followers).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load follows: %w", err)
+	}
+
+	// One row per session: the newest token of each rotation family
+	sessions := []models.RefreshToken{}
+	err = db.DB.Raw(`SELECT DISTINCT ON (family_id) * FROM refresh_tokens
+		WHERE user_id = ? ORDER BY family_id, created_at DESC`, userID).
+		Scan(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sessions: %w", err)
+	}
+
+	devices := []models.KnownDevice{}
+	if err := db.DB.Where("user_id = ?", userID).Order("first_seen_at").Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+
+	watchlist := []exportWatchlistItem{}
+	err = db.DB.Table("watchlist_items").
+		Select("watchlist_items.movie_id, movies.title AS movie_title, watchlist_items.created_at").
+		Joins("JOIN movies ON movies.id = watchlist_items.movie_id").
+		Where("watchlist_items.user_id = ?", userID).
+		Order("watchlist_items.created_at").
+		Scan(&watchlist).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load watchlist: %w", err)
+	}
+
+	securityEvents := []models.SecurityEvent{}
+	err = db.DB.Where("user_id = ?", userID).Order("created_at").Find(&securityEvents).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load security events: %w", err)
+	}
+
+	return []exportFile{
+		{"profile.json", map[string]interface{}{"user": user, "linked_identities": identities, "passkeys": passkeys, "exported_at": time.Now()}},
+		{"reviews.json", reviews},
+		{"comments.json", comments},
+		{"likes.json", map[string]interface{}{"reviews": reviewLikes, "comments": commentLikes}},
+		{"follows.json", map[string]interface{}{"following": following, "followers": followers}},
+		{"sessions.json", sessions},
+		{"devices.json", devices},
+		{"watchlist.json", watchlist},
+		{"security_events.json", securityEvents},
+	}, nil
+}
@@ -0,0 +1,302 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/db"
+	"filmfolk/internal/mailer"
+	"filmfolk/internal/models"
+	"filmfolk/internal/utils"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// recentLoginWindow is how long after signing in an account without a password may
+// change its email; after that it has to sign in again
+const recentLoginWindow = 10 * time.Minute
+
+// EmailChangeService handles changing a user's email address
+// The new address is confirmed from a link sent to it; the old address gets a notice
+// with a link that cancels the change, or undoes it if it was already confirmed
+type EmailChangeService struct {
+	cfg *config.Config
+}
+
+// NewEmailChangeService creates a new email change service
+func NewEmailChangeService(cfg *config.Config) *EmailChangeService {
+	return &EmailChangeService{cfg: cfg}
+}
+
+// ChangeEmailInput represents a request to change the email address
+// Accounts with a password confirm with it; accounts without one must have signed in recently
+type ChangeEmailInput struct {
+	NewEmail string `json:"new_email" binding:"required,email,max=255"`
+	Password string `json:"password"`
+}
+
+// RequestChange mails a confirmation link to the new address and a notice to the old one
+// A pending change requested earlier is replaced
+func (s *EmailChangeService) RequestChange(userID uint64, sessionID string, input ChangeEmailInput, device DeviceInfo) (*models.EmailChange, error) {
+	newEmail := strings.TrimSpace(input.NewEmail)
+
+	// 1. Find user
+	user, err := findUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if newEmail == user.Email {
+		return nil, errors.New("that is already your email address")
+	}
+
+	// 2. Re-authenticate, throttled like a login
+	if user.PasswordHash != nil {
+		lockout := NewLockoutService(s.cfg)
+		if err := lockout.CheckLoginAllowed(user); err != nil {
+			return nil, err
+		}
+		if !utils.VerifyPassword(*user.PasswordHash, input.Password) {
+			lockout.RecordFailure(user)
+			return nil, errors.New("password is incorrect")
+		}
+	} else if err := s.checkRecentLogin(userID, sessionID); err != nil {
+		return nil, err
+	}
+
+	// 3. Check the new address is free
+	if err := checkEmailAvailable(db.DB, newEmail, userID); err != nil {
+		return nil, err
+	}
+
+	// 4. Store the change, replacing any pending one
+	confirmToken, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+	cancelToken, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := time.Duration(s.cfg.Auth.VerificationTokenTTL) * time.Hour
+	change := models.EmailChange{
+		UserID:           userID,
+		OldEmail:         user.Email,
+		NewEmail:         newEmail,
+		ConfirmTokenHash: utils.HashToken(confirmToken),
+		CancelTokenHash:  utils.HashToken(cancelToken),
+		ExpiresAt:        time.Now().Add(ttl),
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		// Concurrent requests of the same user queue up here
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.User{}, userID).Error; err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		err := tx.Model(&models.EmailChange{}).
+			Where("user_id = ? AND confirmed_at IS NULL AND cancelled_at IS NULL", userID).
+			Update("cancelled_at", time.Now()).Error
+		if err != nil {
+			return fmt.Errorf("failed to replace pending change: %w", err)
+		}
+
+		if err := tx.Create(&change).Error; err != nil {
+			return fmt.Errorf("failed to store email change: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recordUserEvent(models.EventEmailChangeRequested, userID, device, map[string]string{"new_email": newEmail})
+
+	// 5. Ask the new address to confirm
+	confirmLink := fmt.Sprintf("%s/confirm-email-change?token=%s", s.cfg.App.FrontendURL, confirmToken)
+	err = mailer.Send(mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new FilmFolk email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nTo use this address for your FilmFolk account, open this link:\n\n%s\n\n"+
+				"The link expires in %d hours. Until then your account keeps its current address. "+
+				"If you didn't ask for this, ignore this email.\n",
+			user.Username, confirmLink, s.cfg.Auth.VerificationTokenTTL,
+		),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 6. Tell the old address, in case it wasn't the owner
+	cancelLink := fmt.Sprintf("%s/cancel-email-change?token=%s", s.cfg.App.FrontendURL, cancelToken)
+	err = mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your FilmFolk email address is being changed",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone asked to change the email address of your FilmFolk account to %s.\n\n"+
+				"If this wasn't you, open this link to stop the change. If it has already been confirmed, "+
+				"the link switches back to this address and logs out every session:\n\n%s\n\n"+
+				"The link works for %d hours.\n",
+			user.Username, newEmail, cancelLink, s.cfg.Auth.VerificationTokenTTL,
+		),
+	})
+	if err != nil {
+		utils.GetLogger().Error().Err(err).Uint64("user_id", userID).Msg("Failed to send email change notice")
+	}
+
+	return &change, nil
+}
+
+// ConfirmChange switches the account to the new address with the token sent to it
+// Following the link also verifies the new address
+func (s *EmailChangeService) ConfirmChange(token string, device DeviceInfo) error {
+	var change models.EmailChange
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. Lock the change so it can't be confirmed and cancelled at once
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("confirm_token_hash = ?", utils.HashToken(token)).
+			First(&change).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("invalid or expired link")
+			}
+			return fmt.Errorf("database error: %w", err)
+		}
+		if !change.IsPending() {
+			return errors.New("invalid or expired link")
+		}
+
+		// 2. Swap the address
+		if err := swapEmail(tx, change.UserID, change.OldEmail, change.NewEmail); err != nil {
+			return err
+		}
+		err = tx.Model(&models.User{}).Where("id = ?", change.UserID).
+			Update("email_verified_at", time.Now()).Error
+		if err != nil {
+			return fmt.Errorf("failed to verify email: %w", err)
+		}
+
+		now := time.Now()
+		change.ConfirmedAt = &now
+		if err := tx.Model(&change).Update("confirmed_at", now).Error; err != nil {
+			return fmt.Errorf("failed to confirm email change: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	recordUserEvent(models.EventEmailChanged, change.UserID, device, map[string]string{
+		"old_email": change.OldEmail,
+		"new_email": change.NewEmail,
+	})
+	return nil
+}
+
+// CancelChange stops a change with the token sent to the old address
+// A change that was already confirmed is undone, every session is logged out and the
+// personal access tokens are revoked, as whoever confirmed it may have taken over the account
+// Returns whether a confirmed change was undone, and what was revoked then
+func (s *EmailChangeService) CancelChange(token string, device DeviceInfo) (bool, RevokedCounts, error) {
+	var change models.EmailChange
+	var revoked *sessionRevocation
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. Lock the change so it can't be confirmed and cancelled at once
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("cancel_token_hash = ?", utils.HashToken(token)).
+			First(&change).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("invalid or expired link")
+			}
+			return fmt.Errorf("database error: %w", err)
+		}
+		if change.CancelledAt != nil || time.Now().After(change.ExpiresAt) {
+			return errors.New("invalid or expired link")
+		}
+
+		// 2. Already confirmed - switch back and sign out everywhere
+		if change.ConfirmedAt != nil {
+			if err := swapEmail(tx, change.UserID, change.NewEmail, change.OldEmail); err != nil {
+				return err
+			}
+			revoked, err = revokeUserSessions(tx, change.UserID, "")
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&change).Update("cancelled_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("failed to cancel email change: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, RevokedCounts{}, err
+	}
+	if err := revoked.apply(); err != nil {
+		return false, RevokedCounts{}, err
+	}
+
+	reverted := revoked != nil
+	details := map[string]string{"new_email": change.NewEmail}
+	if reverted {
+		details["reverted"] = "true"
+	}
+	recordUserEvent(models.EventEmailChangeCancelled, change.UserID, device, revoked.details(details))
+	return reverted, revoked.counts(), nil
+}
+
+// checkRecentLogin refuses sessions that didn't sign in within recentLoginWindow
+// Stands in for the password on accounts that don't have one
+func (s *EmailChangeService) checkRecentLogin(userID uint64, sessionID string) error {
+	var session models.RefreshToken
+	err := db.DB.Where("user_id = ? AND family_id = ? AND revoked_at IS NULL", userID, sessionID).
+		Order("created_at DESC").
+		First(&session).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	if err != nil || time.Since(session.SessionStartedAt) > recentLoginWindow {
+		return errors.New("sign in again to confirm it's you, then change your email within 10 minutes")
+	}
+
+	return nil
+}
+
+// swapEmail replaces a user's email address if it is still from
+// Runs inside a transaction; the user row is locked so concurrent changes queue up
+func swapEmail(tx *gorm.DB, userID uint64, from, to string) error {
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if user.Email != from {
+		return errors.New("the account's email address has changed since, request a new link")
+	}
+
+	if err := checkEmailAvailable(tx, to, userID); err != nil {
+		return err
+	}
+
+	// The unique index decides if someone registered the address since the check
+	if err := tx.Model(&user).Update("email", to).Error; err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return errors.New("email already registered")
+		}
+		return fmt.Errorf("failed to change email: %w", err)
+	}
+
+	return nil
+}
@@ -32,6 +32,11 @@ func (s *FollowerService) FollowUser(followerID, followingID uint64) error {
 		return fmt.Errorf("database error: %w", err)
 	}
 
+	// Guests can't be followed, their profiles are temporary
+	if followingUser.IsGuest() {
+		return errors.New("user to follow not found")
+	}
+
 	// Check if already following
 	var existing models.Follower
 	err := db.DB.Where("follower_id = ? AND following_id = ?", followerID, followingID).First(&existing).Error
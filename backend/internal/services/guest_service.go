@@ -0,0 +1,422 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/db"
+	"filmfolk/internal/models"
+	"filmfolk/internal/oauth"
+	"filmfolk/internal/passwordpolicy"
+	"filmfolk/internal/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GuestService handles guest accounts
+// A guest is a real user row (auth_provider 'guest') with a placeholder email and no
+// password. Upgrading fills in credentials in place, so the guest's data stays put.
+type GuestService struct {
+	cfg *config.Config
+}
+
+// NewGuestService creates a new guest service
+func NewGuestService(cfg *config.Config) *GuestService {
+	return &GuestService{cfg: cfg}
+}
+
+const (
+	// guestEmailDomain is reserved (RFC 2606), placeholder addresses can't receive mail
+	guestEmailDomain = "guests.filmfolk.invalid"
+	// guestPurgeInterval is how often stale guests are looked for
+	guestPurgeInterval = time.Hour
+	// guestPurgeBatch limits how many guests are deleted per statement
+	guestPurgeBatch = 500
+)
+
+// GuestUpgradeInput represents the credentials a guest upgrades with
+// Either email and password, or provider with the code and state from GET /auth/link/:provider
+type GuestUpgradeInput struct {
+	Username string `json:"username" binding:"omitempty,min=3,max=50"` // optional, keeps the generated name otherwise
+	Email    string `json:"email" binding:"omitempty,email"`
+	Password string `json:"password"` // checked by the password policy
+	Provider string `json:"provider"`
+	Code     string `json:"code"`
+	State    string `json:"state"`
+}
+
+// CreateGuest creates a guest account and signs it in
+func (s *GuestService) CreateGuest(device DeviceInfo) (*AuthResponse, error) {
+	// 1. Generate placeholder identity
+	suffix, err := utils.GenerateSecureToken(6)
+	if err != nil {
+		return nil, err
+	}
+	suffix = strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(suffix))
+
+	user := models.User{
+		Username:     "guest_" + suffix,
+		Email:        fmt.Sprintf("%s@%s", uuid.NewString(), guestEmailDomain),
+		AuthProvider: models.AuthGuest,
+		Status:       models.StatusActive,
+	}
+
+	// 2. Create user
+	if err := db.DB.Create(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to create guest: %w", err)
+	}
+
+	// 3. Generate tokens (marked as guest tokens)
+	return NewAuthService(s.cfg).generateAuthResponse(&user, device)
+}
+
+// Upgrade turns a guest into a full account
+// The guest's sessions are ended and a full session is returned in their place
+func (s *GuestService) Upgrade(userID uint64, input GuestUpgradeInput, device DeviceInfo) (*AuthResponse, error) {
+	var (
+		user *models.User
+		err  error
+	)
+
+	switch {
+	case input.Provider != "":
+		if input.Code == "" || input.State == "" {
+			return nil, errors.New("code and state are required to upgrade with a provider")
+		}
+		user, err = s.upgradeWithProvider(userID, input)
+	case input.Email != "" && input.Password != "":
+		user, err = s.upgradeWithPassword(userID, input)
+	default:
+		return nil, errors.New("email and password, or a provider, are required")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Addresses the provider didn't vouch for are verified by us
+	if !user.IsEmailVerified() {
+		if err := NewVerificationService(s.cfg).SendVerificationEmail(user); err != nil {
+			utils.GetLogger().Error().
+				Err(err).
+				Uint64("user_id", user.ID).
+				Msg("Failed to send verification email")
+		}
+	}
+
+	return NewAuthService(s.cfg).generateAuthResponse(user, device)
+}
+
+// upgradeWithPassword sets email and password on a guest account
+func (s *GuestService) upgradeWithPassword(userID uint64, input GuestUpgradeInput) (*models.User, error) {
+	// 1. Check and hash the password before taking any locks
+	username := input.Username
+	if username == "" {
+		guest, err := findUserByID(userID)
+		if err != nil {
+			return nil, err
+		}
+		username = guest.Username
+	}
+	if err := passwordpolicy.Check(input.Password, username, input.Email); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := utils.HashPassword(input.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	var user *models.User
+	var revoked *sessionRevocation
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		// 2. Lock the guest so the purge or a second upgrade can't interfere
+		guest, err := lockGuest(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// 3. Check the credentials are free
+		if err := checkEmailAvailable(tx, input.Email, userID); err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"email":         input.Email,
+			"password_hash": hashedPassword,
+			"auth_provider": models.AuthEmail,
+		}
+		if input.Username != "" {
+			if err := checkUsernameAvailable(tx, input.Username, userID); err != nil {
+				return err
+			}
+			updates["username"] = input.Username
+		}
+
+		// 4. Upgrade in place and end the guest sessions
+		revoked, err = finishUpgrade(tx, guest, updates)
+		if err != nil {
+			return err
+		}
+		user = guest
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := revoked.apply(); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// upgradeWithProvider links a provider account to a guest and takes over its profile
+// The flow must have been started by the guest via GET /auth/link/:provider
+func (s *GuestService) upgradeWithProvider(userID uint64, input GuestUpgradeInput) (*models.User, error) {
+	provider, err := oauth.Get(input.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Consume the flow and check it belongs to this guest
+	flow, err := consumeOAuthFlow(input.Provider, models.OAuthFlowLink, input.State)
+	if err != nil || flow.UserID == nil || *flow.UserID != userID {
+		return nil, errors.New("invalid or expired link state")
+	}
+
+	// 2. Exchange authorization code for the provider profile
+	info, err := provider.Exchange(context.Background(), oauth.FlowLink, input.Code, flowAuthParams(flow, input.State))
+	if err != nil {
+		return nil, err
+	}
+	if info.Email == "" {
+		return nil, fmt.Errorf("%s did not share an email address", input.Provider)
+	}
+
+	username := input.Username
+	if username == "" {
+		username = NewOAuthService(s.cfg).generateUsername(info)
+	}
+
+	var user *models.User
+	var revoked *sessionRevocation
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		// 3. Lock the guest
+		guest, err := lockGuest(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// 4. No merging: an existing account with this email must be signed into instead
+		if err := checkEmailAvailable(tx, info.Email, userID); err != nil {
+			return fmt.Errorf("an account with this email already exists, log in with %s instead", input.Provider)
+		}
+		if err := checkUsernameAvailable(tx, username, userID); err != nil {
+			return err
+		}
+
+		// 5. Link - fails if the provider account belongs to someone else
+		if _, err := linkIdentity(tx, userID, externalIdentity(input.Provider, info)); err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{
+			"email":         info.Email,
+			"username":      username,
+			"auth_provider": input.Provider,
+			"provider_id":   info.Subject,
+		}
+		if info.EmailVerified {
+			updates["email_verified_at"] = time.Now()
+		}
+		if info.Picture != "" && guest.AvatarURL == nil {
+			updates["avatar_url"] = info.Picture
+		}
+
+		// 6. Upgrade in place and end the guest sessions
+		revoked, err = finishUpgrade(tx, guest, updates)
+		if err != nil {
+			return err
+		}
+		user = guest
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := revoked.apply(); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// PurgeStaleGuests deletes guests that haven't been used within the retention period
+// Their ratings are deleted and movie stats recalculated; the watchlist goes with the account (ON DELETE CASCADE)
+func (s *GuestService) PurgeStaleGuests() (int64, error) {
+	if s.cfg.Auth.GuestRetention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -s.cfg.Auth.GuestRetention)
+
+	var purged int64
+	for {
+		// 1. Find a batch of guests older than the cutoff without a recently used session
+		var guestIDs []uint64
+		err := db.DB.Model(&models.User{}).
+			Where("auth_provider = ? AND created_at < ?", models.AuthGuest, cutoff).
+			Where("NOT EXISTS (SELECT 1 FROM refresh_tokens rt WHERE rt.user_id = users.id AND rt.last_used_at >= ?)", cutoff).
+			Limit(guestPurgeBatch).
+			Pluck("id", &guestIDs).Error
+		if err != nil {
+			return purged, fmt.Errorf("failed to find stale guests: %w", err)
+		}
+		if len(guestIDs) == 0 {
+			return purged, nil
+		}
+
+		// 2. Remember the movies they rated
+		var movieIDs []uint64
+		err = db.DB.Model(&models.Review{}).
+			Where("user_id IN ?", guestIDs).
+			Distinct().
+			Pluck("movie_id", &movieIDs).Error
+		if err != nil {
+			return purged, fmt.Errorf("failed to find guest reviews: %w", err)
+		}
+
+		// 3. Delete ratings, then the guests
+		err = db.DB.Transaction(func(tx *gorm.DB) error {
+			// Re-checking the provider under lock skips guests upgraded in the meantime
+			var staleIDs []uint64
+			err := tx.Model(&models.User{}).
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id IN ? AND auth_provider = ?", guestIDs, models.AuthGuest).
+				Pluck("id", &staleIDs).Error
+			if err != nil || len(staleIDs) == 0 {
+				return err
+			}
+
+			// Reviews don't cascade with their author
+			if err := tx.Where("user_id IN ?", staleIDs).Delete(&models.Review{}).Error; err != nil {
+				return err
+			}
+
+			result := tx.Where("id IN ?", staleIDs).Delete(&models.User{})
+			if result.Error != nil {
+				return result.Error
+			}
+			purged += result.RowsAffected
+			return nil
+		})
+		if err != nil {
+			return purged, fmt.Errorf("failed to delete stale guests: %w", err)
+		}
+
+		// 4. Their ratings no longer count
+		movieService := NewMovieService()
+		for _, movieID := range movieIDs {
+			if err := movieService.RecalculateMovieStats(movieID); err != nil {
+				utils.GetLogger().Error().Err(err).Uint64("movie_id", movieID).Msg("Failed to recalculate movie stats")
+			}
+		}
+
+		if len(guestIDs) < guestPurgeBatch {
+			return purged, nil
+		}
+	}
+}
+
+// RunPurge deletes stale guests periodically
+// Blocks until ctx is cancelled
+func (s *GuestService) RunPurge(ctx context.Context) {
+	if s.cfg.Auth.GuestRetention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(guestPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := s.PurgeStaleGuests()
+			if err != nil {
+				utils.GetLogger().Error().Err(err).Msg("Failed to purge stale guest accounts")
+				continue
+			}
+			if purged > 0 {
+				utils.GetLogger().Info().Int64("count", purged).Msg("Purged stale guest accounts")
+			}
+		}
+	}
+}
+
+// lockGuest loads and locks a user that must still be a guest
+func lockGuest(tx *gorm.DB, userID uint64) (*models.User, error) {
+	var user models.User
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if !user.IsGuest() {
+		return nil, errors.New("account is not a guest account")
+	}
+	return &user, nil
+}
+
+// finishUpgrade applies the upgrade and signs out every guest session
+// The caller applies the returned revocation once the transaction commits
+func finishUpgrade(tx *gorm.DB, guest *models.User, updates map[string]interface{}) (*sessionRevocation, error) {
+	if err := tx.Model(guest).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to upgrade account: %w", err)
+	}
+
+	// Guest tokens carry the guest claim until they expire - revoke them
+	revoked, err := revokeUserSessions(tx, guest.ID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return revoked, tx.First(guest, guest.ID).Error
+}
+
+// checkEmailAvailable fails if another user has the email address
+func checkEmailAvailable(tx *gorm.DB, email string, userID uint64) error {
+	var count int64
+	err := tx.Model(&models.User{}).Where("email = ? AND id <> ?", email, userID).Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if count > 0 {
+		return errors.New("email already registered")
+	}
+	return nil
+}
+
+// checkUsernameAvailable fails if another user has the username, or it is reserved
+func checkUsernameAvailable(tx *gorm.DB, username string, userID uint64) error {
+	if models.IsReservedUsername(username) {
+		return errors.New("username already taken")
+	}
+
+	var count int64
+	err := tx.Model(&models.User{}).Where("username = ? AND id <> ?", username, userID).Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if count > 0 {
+		return errors.New("username already taken")
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"filmfolk/internal/db"
+	"filmfolk/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdentityService manages the login methods linked to an account
+// Login methods are the password (if set), every linked external identity and passkeys
+type IdentityService struct{}
+
+// NewIdentityService creates a new identity service
+func NewIdentityService() *IdentityService {
+	return &IdentityService{}
+}
+
+// LoginMethods is what a user can currently sign in with
+type LoginMethods struct {
+	HasPassword bool                  `json:"has_password"`
+	Identities  []models.UserIdentity `json:"identities"`
+	Passkeys    int64                 `json:"passkeys"` // managed under /auth/webauthn/credentials
+}
+
+// ExternalIdentity is a provider account as reported by the provider
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string // stable account ID at the provider
+	Email         string
+	EmailVerified bool
+}
+
+// ListLoginMethods returns the password state, linked identities and passkey count of a user
+func (s *IdentityService) ListLoginMethods(userID uint64) (*LoginMethods, error) {
+	user, err := findUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var identities []models.UserIdentity
+	if err := db.DB.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		return nil, fmt.Errorf("failed to list identities: %w", err)
+	}
+
+	var passkeys int64
+	if err := db.DB.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&passkeys).Error; err != nil {
+		return nil, fmt.Errorf("failed to count passkeys: %w", err)
+	}
+
+	return &LoginMethods{
+		HasPassword: user.PasswordHash != nil,
+		Identities:  identities,
+		Passkeys:    passkeys,
+	}, nil
+}
+
+// UnlinkIdentity removes a linked provider
+// Refuses to remove the last way to sign in
+func (s *IdentityService) UnlinkIdentity(userID uint64, provider string, device DeviceInfo) error {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. Lock the user so two concurrent unlinks can't both pass the check below
+		var user models.User
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("user not found")
+			}
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		// 2. Find the identity
+		var identity models.UserIdentity
+		err = tx.Where("user_id = ? AND provider = ?", userID, provider).First(&identity).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("identity not found")
+			}
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		// 3. Count the remaining login methods
+		remaining, err := countLoginMethods(tx, &user)
+		if err != nil {
+			return err
+		}
+
+		if remaining <= 1 {
+			return errors.New("cannot unlink your only login method, set a password first (via forgot password)")
+		}
+
+		// 4. Unlink
+		if err := tx.Delete(&identity).Error; err != nil {
+			return fmt.Errorf("failed to unlink identity: %w", err)
+		}
+
+		// The account may have been created through this identity; free the legacy
+		// provider_id too so the external account can create or join another user
+		err = tx.Model(&models.User{}).
+			Where("id = ? AND auth_provider = ? AND provider_id = ?", userID, provider, identity.ProviderUserID).
+			Update("provider_id", nil).Error
+		if err != nil {
+			return fmt.Errorf("failed to unlink identity: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	recordUserEvent(models.EventOAuthUnlinked, userID, device, map[string]string{"provider": provider})
+	return nil
+}
+
+// countLoginMethods counts the ways a user can sign in: password, linked identities and passkeys
+func countLoginMethods(tx *gorm.DB, user *models.User) (int64, error) {
+	var identities, passkeys int64
+	if err := tx.Model(&models.UserIdentity{}).Where("user_id = ?", user.ID).Count(&identities).Error; err != nil {
+		return 0, fmt.Errorf("database error: %w", err)
+	}
+	if err := tx.Model(&models.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&passkeys).Error; err != nil {
+		return 0, fmt.Errorf("database error: %w", err)
+	}
+
+	methods := identities + passkeys
+	if user.PasswordHash != nil {
+		methods++
+	}
+	return methods, nil
+}
+
+// linkIdentity attaches an external identity to a user
+func linkIdentity(tx *gorm.DB, userID uint64, ext *ExternalIdentity) (*models.UserIdentity, error) {
+	// 1. The external account may only belong to one user
+	var existing models.UserIdentity
+	err := tx.Where("provider = ? AND provider_user_id = ?", ext.Provider, ext.Subject).First(&existing).Error
+	if err == nil {
+		if existing.UserID == userID {
+			return &existing, nil
+		}
+		return nil, fmt.Errorf("this %s account is already linked to another user", ext.Provider)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	// 2. One account per provider per user
+	err = tx.Where("user_id = ? AND provider = ?", userID, ext.Provider).First(&existing).Error
+	if err == nil {
+		return nil, fmt.Errorf("a different %s account is already linked, unlink it first", ext.Provider)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	// 3. Link (unique constraints catch a concurrent link of the same account)
+	now := time.Now()
+	identity := models.UserIdentity{
+		UserID:         userID,
+		Provider:       ext.Provider,
+		ProviderUserID: ext.Subject,
+		LastUsedAt:     &now,
+	}
+	if ext.Email != "" {
+		identity.Email = &ext.Email
+	}
+
+	if err := tx.Create(&identity).Error; err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	return &identity, nil
+}
+
+// findUserByIdentity returns the user an external identity is linked to
+// Returns gorm.ErrRecordNotFound if the identity isn't linked
+func findUserByIdentity(tx *gorm.DB, ext *ExternalIdentity) (*models.User, error) {
+	var identity models.UserIdentity
+	err := tx.Preload("User").
+		Where("provider = ? AND provider_user_id = ?", ext.Provider, ext.Subject).
+		First(&identity).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if identity.User == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	tx.Model(&identity).Update("last_used_at", time.Now())
+	return identity.User, nil
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/db"
+	"filmfolk/internal/mailer"
+	"filmfolk/internal/models"
+	"filmfolk/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// newDeviceReportTTL is how long the "this wasn't me" link in a new-device alert works
+const newDeviceReportTTL = 7 * 24 * time.Hour
+
+// KnownDeviceService tracks the devices users sign in from and alerts on new ones
+// A device is a user agent + IP combination
+type KnownDeviceService struct {
+	cfg *config.Config
+}
+
+// NewKnownDeviceService creates a new known device service
+func NewKnownDeviceService(cfg *config.Config) *KnownDeviceService {
+	return &KnownDeviceService{cfg: cfg}
+}
+
+// KnownDevice is a device as shown to its owner
+type KnownDevice struct {
+	models.KnownDevice
+	Current bool `json:"current"` // the device the request was made from
+}
+
+// ListDevices returns the devices the user has signed in from, most recently seen first
+func (s *KnownDeviceService) ListDevices(userID uint64, device DeviceInfo) ([]KnownDevice, error) {
+	var rows []models.KnownDevice
+	err := db.DB.Where("user_id = ?", userID).Order("last_seen_at DESC").Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch devices: %w", err)
+	}
+
+	current := deviceHash(device)
+	devices := make([]KnownDevice, 0, len(rows))
+	for _, row := range rows {
+		devices = append(devices, KnownDevice{KnownDevice: row, Current: row.DeviceHash == current})
+	}
+
+	return devices, nil
+}
+
+// ForgetDevice removes a device from the user's known devices
+// The next sign-in from it sends an alert again
+func (s *KnownDeviceService) ForgetDevice(userID, deviceID uint64) error {
+	result := db.DB.Where("id = ? AND user_id = ?", deviceID, userID).Delete(&models.KnownDevice{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to forget device: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("device not found")
+	}
+
+	return nil
+}
+
+// ReportDevice handles the "this wasn't me" link from a new-device alert
+// Signs the account out everywhere, revokes its personal access tokens and forgets the device
+func (s *KnownDeviceService) ReportDevice(token string, device DeviceInfo) (RevokedCounts, error) {
+	var userID uint64
+	var revoked *sessionRevocation
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. Lock the device so the link can't be used twice
+		var known models.KnownDevice
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("report_token_hash = ?", utils.HashToken(token)).
+			First(&known).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("invalid or expired link")
+			}
+			return fmt.Errorf("database error: %w", err)
+		}
+		if known.ReportExpiresAt == nil || time.Now().After(*known.ReportExpiresAt) {
+			return errors.New("invalid or expired link")
+		}
+		userID = known.UserID
+
+		// 2. Not the owner's device - stop trusting it
+		if err := tx.Delete(&known).Error; err != nil {
+			return fmt.Errorf("failed to forget device: %w", err)
+		}
+
+		// 3. Sign out everywhere
+		revoked, err = revokeUserSessions(tx, known.UserID, "")
+		return err
+	})
+	if err != nil {
+		return RevokedCounts{}, err
+	}
+	if err := revoked.apply(); err != nil {
+		return RevokedCounts{}, err
+	}
+
+	recordUserEvent(models.EventSessionsRevoked, userID, device, revoked.details(map[string]string{"reason": "new_device_reported"}))
+	return revoked.counts(), nil
+}
+
+// noteLogin remembers the device of a successful sign-in and alerts the owner if it's new
+// The first device of an account (just registered, or signed in before devices were tracked)
+// is remembered without an alert
+// Best effort: failures are logged but never fail the sign-in
+func (s *KnownDeviceService) noteLogin(user *models.User, device DeviceInfo) {
+	// Guest placeholder addresses can't receive mail
+	if user.IsGuest() {
+		return
+	}
+
+	if err := s.noteDevice(user, device); err != nil {
+		utils.GetLogger().Error().Err(err).Uint64("user_id", user.ID).Msg("Failed to note login device")
+	}
+}
+
+func (s *KnownDeviceService) noteDevice(user *models.User, device DeviceInfo) error {
+	hash := deviceHash(device)
+	now := time.Now()
+
+	// 1. Seen before - just note the visit
+	result := db.DB.Model(&models.KnownDevice{}).
+		Where("user_id = ? AND device_hash = ?", user.ID, hash).
+		Update("last_seen_at", now)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update device: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	var count int64
+	if err := db.DB.Model(&models.KnownDevice{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count devices: %w", err)
+	}
+
+	// 2. Remember it
+	// A concurrent sign-in from the same device may have got here first; only one alerts
+	known := models.KnownDevice{
+		UserID:      user.ID,
+		DeviceHash:  hash,
+		UserAgent:   device.UserAgent,
+		IPAddress:   device.IPAddress,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}
+	result = db.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&known)
+	if result.Error != nil {
+		return fmt.Errorf("failed to store device: %w", result.Error)
+	}
+	if result.RowsAffected == 0 || count == 0 || !s.cfg.Auth.NewDeviceAlerts {
+		return nil
+	}
+
+	// 3. Alert the owner
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return err
+	}
+	tokenHash := utils.HashToken(token)
+	expiresAt := now.Add(newDeviceReportTTL)
+	err = db.DB.Model(&known).Updates(map[string]interface{}{
+		"report_token_hash": tokenHash,
+		"report_expires_at": expiresAt,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to store report token: %w", err)
+	}
+
+	link := fmt.Sprintf("%s/not-me?token=%s", s.cfg.App.FrontendURL, token)
+	return mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "New sign-in to your FilmFolk account",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nYour FilmFolk account was just signed in to from a device we haven't seen before:\n\n"+
+				"Time: %s\nDevice: %s\nIP address: %s\n\n"+
+				"If this was you, there's nothing to do. If it wasn't, open this link to sign out "+
+				"everywhere, then change your password:\n\n%s\n\n"+
+				"The link works for %d days.\n",
+			user.Username, now.UTC().Format("2006-01-02 15:04 MST"), device.UserAgent, device.IPAddress,
+			link, int(newDeviceReportTTL.Hours()/24),
+		),
+	})
+}
+
+// deviceHash identifies a device by user agent and IP address
+func deviceHash(device DeviceInfo) string {
+	return utils.HashToken(device.UserAgent + "\n" + device.IPAddress)
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/db"
+	"filmfolk/internal/mailer"
+	"filmfolk/internal/models"
+	"filmfolk/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// LoginThrottledError is returned when an account may not attempt a login right now
+// Handlers turn it into 429 with a Retry-After header
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool // true = lockout, false = progressive delay
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("account temporarily locked after too many failed logins, try again in %d minutes or use the unlock link sent by email",
+			int(math.Ceil(e.RetryAfter.Minutes())))
+	}
+	return fmt.Sprintf("too many failed login attempts, try again in %d seconds", int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// LockoutService tracks failed logins per account
+// Complements the per-IP AuthRateLimitMiddleware, which a distributed attacker can sidestep
+type LockoutService struct {
+	cfg *config.Config
+}
+
+// unknownLoginsMax caps how many unknown emails are tracked before idle ones are dropped
+const unknownLoginsMax = 10000
+
+// unknownLogins counts failed logins for emails without an account, in memory
+// They are throttled exactly like accounts, so a delay or lockout doesn't tell that an
+// account exists. Keyed by digest, the addresses themselves aren't kept
+var unknownLogins = struct {
+	sync.Mutex
+	entries map[string]*models.User
+}{entries: make(map[string]*models.User)}
+
+// NewLockoutService creates a new lockout service
+func NewLockoutService(cfg *config.Config) *LockoutService {
+	return &LockoutService{cfg: cfg}
+}
+
+// CheckLoginAllowed returns a LoginThrottledError if the account is locked
+// or the progressive delay since the last failure hasn't passed yet
+func (s *LockoutService) CheckLoginAllowed(user *models.User) error {
+	now := time.Now()
+
+	if user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+		return &LoginThrottledError{RetryAfter: user.LockedUntil.Sub(now), Locked: true}
+	}
+
+	if user.FailedLoginCount > 0 && user.LastFailedLoginAt != nil {
+		nextAttempt := user.LastFailedLoginAt.Add(s.retryDelay(user.FailedLoginCount))
+		if now.Before(nextAttempt) {
+			return &LoginThrottledError{RetryAfter: nextAttempt.Sub(now)}
+		}
+	}
+
+	return nil
+}
+
+// RecordFailure counts a failed login and locks the account once the threshold is reached
+func (s *LockoutService) RecordFailure(user *models.User) {
+	logger := utils.GetLogger()
+	now := time.Now()
+
+	// Increment in SQL so concurrent failures are all counted
+	var count int
+	err := db.DB.Raw(
+		"UPDATE users SET failed_login_count = failed_login_count + 1, last_failed_login_at = ? WHERE id = ? RETURNING failed_login_count",
+		now, user.ID,
+	).Scan(&count).Error
+	if err != nil {
+		logger.Error().Err(err).Uint64("user_id", user.ID).Msg("Failed to record failed login")
+		return
+	}
+
+	if s.cfg.Auth.LockoutThreshold <= 0 || count < s.cfg.Auth.LockoutThreshold {
+		return
+	}
+
+	// Lock and start counting afresh once the lock expires
+	lockedUntil := now.Add(time.Duration(s.cfg.Auth.LockoutDuration) * time.Minute)
+	err = db.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"locked_until":       lockedUntil,
+		"failed_login_count": 0,
+	}).Error
+	if err != nil {
+		logger.Error().Err(err).Uint64("user_id", user.ID).Msg("Failed to lock account")
+		return
+	}
+
+	logger.Warn().
+		Uint64("user_id", user.ID).
+		Int("failed_attempts", count).
+		Time("locked_until", lockedUntil).
+		Msg("Account locked after repeated failed logins")
+
+	if err := s.sendUnlockEmail(user); err != nil {
+		logger.Error().Err(err).Uint64("user_id", user.ID).Msg("Failed to send unlock email")
+	}
+}
+
+// CheckUnknownLogin is CheckLoginAllowed for an email without an account
+func (s *LockoutService) CheckUnknownLogin(email string) error {
+	unknownLogins.Lock()
+	defer unknownLogins.Unlock()
+
+	entry, ok := unknownLogins.entries[unknownLoginKey(email)]
+	if !ok {
+		return nil
+	}
+	return s.CheckLoginAllowed(entry)
+}
+
+// RecordUnknownFailure is RecordFailure for an email without an account
+// Counts and locks the same way; there is nobody to send an unlock email to
+func (s *LockoutService) RecordUnknownFailure(email string) {
+	unknownLogins.Lock()
+	defer unknownLogins.Unlock()
+
+	now := time.Now()
+	key := unknownLoginKey(email)
+	entry, ok := unknownLogins.entries[key]
+	if !ok {
+		if len(unknownLogins.entries) >= unknownLoginsMax {
+			s.pruneUnknownLogins(now)
+		}
+		entry = &models.User{}
+		unknownLogins.entries[key] = entry
+	}
+
+	entry.FailedLoginCount++
+	entry.LastFailedLoginAt = &now
+
+	if s.cfg.Auth.LockoutThreshold > 0 && entry.FailedLoginCount >= s.cfg.Auth.LockoutThreshold {
+		lockedUntil := now.Add(time.Duration(s.cfg.Auth.LockoutDuration) * time.Minute)
+		entry.LockedUntil = &lockedUntil
+		entry.FailedLoginCount = 0
+	}
+}
+
+// pruneUnknownLogins drops the entries that no longer throttle anything
+// Called with unknownLogins locked
+func (s *LockoutService) pruneUnknownLogins(now time.Time) {
+	idle := time.Duration(s.cfg.Auth.LoginDelayMax) * time.Second
+	for key, entry := range unknownLogins.entries {
+		locked := entry.LockedUntil != nil && now.Before(*entry.LockedUntil)
+		if !locked && now.Sub(*entry.LastFailedLoginAt) > idle {
+			delete(unknownLogins.entries, key)
+		}
+	}
+}
+
+// unknownLoginKey identifies an unknown email without keeping it
+func unknownLoginKey(email string) string {
+	return utils.HashToken(strings.ToLower(strings.TrimSpace(email)))
+}
+
+// RecordSuccess clears the failure counter after a completed login
+func (s *LockoutService) RecordSuccess(user *models.User) {
+	if user.FailedLoginCount == 0 && user.LockedUntil == nil {
+		return
+	}
+
+	db.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"failed_login_count":   0,
+		"last_failed_login_at": nil,
+		"locked_until":         nil,
+	})
+}
+
+// RequestUnlock mails a new unlock link if the account is locked or waiting out a delay
+// The lockout email goes out only once per lockout; this lets the owner get back in
+// however often someone else locks the account
+// Silently does nothing otherwise, so the response doesn't reveal accounts or their state
+func (s *LockoutService) RequestUnlock(email string) error {
+	var user models.User
+	err := db.DB.Where("email = ?", strings.TrimSpace(email)).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	// Guest placeholder addresses can't receive mail
+	if user.IsGuest() || s.CheckLoginAllowed(&user) == nil {
+		return nil
+	}
+
+	message, err := s.unlockMessage(&user)
+	if err != nil {
+		return err
+	}
+	mailer.SendAsync(message)
+	return nil
+}
+
+// Unlock lifts a lockout using the token from the unlock email
+func (s *LockoutService) Unlock(tokenString string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeVerificationToken(tx, tokenString, models.PurposeAccountUnlock)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&models.User{}).Where("id = ?", token.UserID).Updates(map[string]interface{}{
+			"failed_login_count":   0,
+			"last_failed_login_at": nil,
+			"locked_until":         nil,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to unlock account: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// retryDelay is the wait after the given number of consecutive failures
+// base * 2^(failures-1), capped at the configured maximum
+func (s *LockoutService) retryDelay(failures int) time.Duration {
+	base := time.Duration(s.cfg.Auth.LoginDelayBase) * time.Second
+	maxDelay := time.Duration(s.cfg.Auth.LoginDelayMax) * time.Second
+	if base <= 0 || failures <= 0 {
+		return 0
+	}
+
+	delay := base
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// sendUnlockEmail tells the owner about the lockout and offers an early unlock
+func (s *LockoutService) sendUnlockEmail(user *models.User) error {
+	message, err := s.unlockMessage(user)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(message)
+}
+
+// unlockMessage issues an unlock token and builds the email carrying it
+func (s *LockoutService) unlockMessage(user *models.User) (mailer.Message, error) {
+	ttl := time.Duration(s.cfg.Auth.LockoutDuration) * time.Minute
+	token, err := issueVerificationToken(db.DB, user.ID, models.PurposeAccountUnlock, ttl)
+	if err != nil {
+		return mailer.Message{}, err
+	}
+
+	link := fmt.Sprintf("%s/unlock-account?token=%s", s.cfg.App.FrontendURL, token)
+	return mailer.Message{
+		To:      user.Email,
+		Subject: "Your FilmFolk account has been temporarily locked",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nWe locked your account for %d minutes after several failed login attempts.\n\n"+
+				"If this was you, you can unlock it right away:\n\n%s\n\n"+
+				"If it wasn't you, someone may be guessing your password - consider changing it once you're back in.\n",
+			user.Username, s.cfg.Auth.LockoutDuration, link,
+		),
+	}, nil
+}
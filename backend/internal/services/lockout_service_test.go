@@ -0,0 +1,44 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"filmfolk/internal/config"
+)
+
+func testLockoutService() *LockoutService {
+	cfg := &config.Config{}
+	cfg.Auth.LoginDelayBase = 1
+	cfg.Auth.LoginDelayMax = 60
+	cfg.Auth.LockoutThreshold = 3
+	cfg.Auth.LockoutDuration = 15
+	return NewLockoutService(cfg)
+}
+
+func TestUnknownLoginThrottling(t *testing.T) {
+	lockout := testLockoutService()
+	email := "nobody-throttled@example.com"
+
+	if err := lockout.CheckUnknownLogin(email); err != nil {
+		t.Fatalf("CheckUnknownLogin() before any failure = %v, want nil", err)
+	}
+
+	// A failure starts the delay, like for an account
+	lockout.RecordUnknownFailure(email)
+	var throttled *LoginThrottledError
+	if err := lockout.CheckUnknownLogin(email); !errors.As(err, &throttled) || throttled.Locked {
+		t.Fatalf("CheckUnknownLogin() after a failure = %v, want a delay", err)
+	}
+
+	// The threshold locks it, and the case of the address doesn't matter
+	lockout.RecordUnknownFailure(email)
+	lockout.RecordUnknownFailure("Nobody-Throttled@example.com")
+	if err := lockout.CheckUnknownLogin(email); !errors.As(err, &throttled) || !throttled.Locked {
+		t.Fatalf("CheckUnknownLogin() after 3 failures = %v, want a lockout", err)
+	}
+
+	if err := lockout.CheckUnknownLogin("someone-else@example.com"); err != nil {
+		t.Errorf("CheckUnknownLogin() for another email = %v, want nil", err)
+	}
+}
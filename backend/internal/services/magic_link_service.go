@@ -0,0 +1,328 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/db"
+	"filmfolk/internal/mailer"
+	"filmfolk/internal/models"
+	"filmfolk/internal/oauth"
+	"filmfolk/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// magicLinkCooldown is how long to wait before another link is sent to the same address
+	magicLinkCooldown = time.Minute
+	// magicLinkWindow and magicLinkWindowLimit cap the links per address over a longer period
+	magicLinkWindow      = time.Hour
+	magicLinkWindowLimit = 5
+)
+
+// MagicLinkThrottledError is returned when too many links were asked for one address
+// Handlers turn it into 429 with a Retry-After header
+type MagicLinkThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *MagicLinkThrottledError) Error() string {
+	return fmt.Sprintf("a sign-in link was sent recently, try again in %d seconds", int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// MagicLinkDeviceError is returned when a link is opened in a browser other than the one
+// that asked for it. The link stays valid; sending Confirm signs in anyway.
+// Carries what we know about the requesting browser so the user can recognize it
+type MagicLinkDeviceError struct {
+	RequestedAt time.Time
+	UserAgent   string
+	IPAddress   string
+}
+
+func (e *MagicLinkDeviceError) Error() string {
+	return "this sign-in link was requested from another browser, confirm to sign in here"
+}
+
+// MagicLinkService handles passwordless sign-in with emailed links
+type MagicLinkService struct {
+	cfg *config.Config
+}
+
+// NewMagicLinkService creates a new magic link service
+func NewMagicLinkService(cfg *config.Config) *MagicLinkService {
+	return &MagicLinkService{cfg: cfg}
+}
+
+// RequestMagicLinkInput represents a request for a sign-in link
+type RequestMagicLinkInput struct {
+	Email string `json:"email" binding:"required,email,max=255"`
+}
+
+// ConsumeMagicLinkInput represents a sign-in with a link token
+type ConsumeMagicLinkInput struct {
+	Token       string `json:"token" binding:"required"`
+	DeviceToken string `json:"device_token"` // from the request response; browsers may rely on the cookie instead
+	Confirm     bool   `json:"confirm"`      // sign in although the link was requested from another browser
+	DeviceLabel string `json:"device_label" binding:"omitempty,max=100"`
+}
+
+// RequestLink emails a sign-in link and returns the device token that binds it to this browser
+// Behaves the same for every address so the response doesn't reveal which ones have an account
+func (s *MagicLinkService) RequestLink(email string, device DeviceInfo) (string, error) {
+	email = strings.TrimSpace(email)
+	now := time.Now()
+
+	// 1. Throttle per address
+	if err := s.checkThrottle(email, now); err != nil {
+		return "", err
+	}
+
+	// 2. Find the account, if any
+	var user *models.User
+	var existing models.User
+	err := db.DB.Where("email = ?", email).First(&existing).Error
+	if err == nil {
+		user = &existing
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", fmt.Errorf("database error: %w", err)
+	}
+
+	// 3. Store the link
+	// Always stored, even when no mail goes out, so throttling looks the same for every address
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	deviceToken, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	link := models.MagicLink{
+		Email:      email,
+		TokenHash:  utils.HashToken(token),
+		DeviceHash: utils.HashToken(deviceToken),
+		IPAddress:  device.IPAddress,
+		UserAgent:  device.UserAgent,
+		ExpiresAt:  now.Add(time.Duration(s.cfg.Auth.MagicLinkTTL) * time.Minute),
+	}
+	if user != nil {
+		link.UserID = &user.ID
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		// Drop old links while we're here; the throttle window needs the recent ones
+		if err := tx.Where("created_at < ?", now.Add(-magicLinkWindow)).Delete(&models.MagicLink{}).Error; err != nil {
+			return fmt.Errorf("failed to delete old links: %w", err)
+		}
+
+		// Only the latest link works
+		err := tx.Model(&models.MagicLink{}).
+			Where("LOWER(email) = LOWER(?) AND used_at IS NULL", email).
+			Update("used_at", now).Error
+		if err != nil {
+			return fmt.Errorf("failed to invalidate old links: %w", err)
+		}
+
+		if err := tx.Create(&link).Error; err != nil {
+			return fmt.Errorf("failed to store link: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// 4. Send it
+	switch {
+	case user == nil && !s.cfg.Auth.MagicLinkSignup:
+		return deviceToken, nil
+	case user != nil && (user.IsGuest() || user.AuthProvider == models.AuthSystem || user.Status == models.StatusDeleted):
+		return deviceToken, nil // nobody reads these addresses
+	}
+
+	s.sendLink(email, user, token)
+	return deviceToken, nil
+}
+
+// ConsumeLink signs in with a link token
+// Creates the account on first use if AUTH_MAGIC_LINK_SIGNUP allows it.
+// If the account has 2FA enabled, an MFAChallenge is returned instead of tokens, as with Login
+func (s *MagicLinkService) ConsumeLink(input ConsumeMagicLinkInput, device DeviceInfo) (*AuthResponse, *MFAChallenge, error) {
+	var user *models.User
+	var otherDevice, created bool
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. Lock the link so it can't be used twice
+		var link models.MagicLink
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(input.Token)).
+			First(&link).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("invalid or expired sign-in link")
+			}
+			return fmt.Errorf("database error: %w", err)
+		}
+		if !link.IsValid() {
+			return errors.New("invalid or expired sign-in link")
+		}
+
+		// 2. Opened somewhere else than where it was asked for - leave the link
+		// unused until the user confirms
+		otherDevice = input.DeviceToken == "" ||
+			subtle.ConstantTimeCompare([]byte(utils.HashToken(input.DeviceToken)), []byte(link.DeviceHash)) != 1
+		if otherDevice && !input.Confirm {
+			return &MagicLinkDeviceError{RequestedAt: link.CreatedAt, UserAgent: link.UserAgent, IPAddress: link.IPAddress}
+		}
+
+		if err := tx.Model(&link).Update("used_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("failed to use link: %w", err)
+		}
+
+		// 3. Find or create the account
+		var existing models.User
+		err = tx.Where("email = ?", link.Email).First(&existing).Error
+		if err == nil {
+			// Someone may have registered this address without owning it;
+			// the link would hand the owner an account the other person can still log into
+			if !existing.IsEmailVerified() {
+				return errors.New("this account's email address is not verified yet, log in with your password or reset it first")
+			}
+			user = &existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		if !s.cfg.Auth.MagicLinkSignup {
+			return errors.New("invalid or expired sign-in link")
+		}
+
+		user, err = s.createUser(tx, link.Email)
+		if err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if created {
+		recordUserEvent(models.EventRegister, user.ID, device, map[string]string{"method": "magic_link"})
+	}
+
+	// 4. Check if account is active
+	if err := checkAccountStatus(user); err != nil {
+		recordLoginFailure(user.ID, device, map[string]string{"reason": "account_" + string(user.Status)})
+		return nil, nil, err
+	}
+
+	// 5. The link replaces the password, not the second factor
+	mfaEnabled, err := isMFAEnabled(db.DB, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mfaEnabled {
+		challenge, err := NewTwoFactorService(s.cfg).newChallenge(user)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, challenge, nil
+	}
+
+	// 6. Update last login time
+	now := time.Now()
+	user.LastLoginAt = &now
+	db.DB.Model(user).Update("last_login_at", now)
+
+	details := map[string]string{"method": "magic_link"}
+	if otherDevice {
+		details["other_device"] = "true"
+	}
+	recordUserEvent(models.EventLogin, user.ID, device, details)
+	NewKnownDeviceService(s.cfg).noteLogin(user, device)
+
+	// 7. Generate tokens
+	device.Label = input.DeviceLabel
+	response, err := NewAuthService(s.cfg).generateAuthResponse(user, device)
+	return response, nil, err
+}
+
+// checkThrottle refuses a new link while the address is in its cooldown or over the window limit
+func (s *MagicLinkService) checkThrottle(email string, now time.Time) error {
+	var recent []time.Time
+	err := db.DB.Model(&models.MagicLink{}).
+		Where("LOWER(email) = LOWER(?) AND created_at > ?", email, now.Add(-magicLinkWindow)).
+		Order("created_at DESC").
+		Pluck("created_at", &recent).Error
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	if len(recent) > 0 {
+		if wait := recent[0].Add(magicLinkCooldown).Sub(now); wait > 0 {
+			return &MagicLinkThrottledError{RetryAfter: wait}
+		}
+	}
+	if len(recent) >= magicLinkWindowLimit {
+		oldest := recent[magicLinkWindowLimit-1]
+		return &MagicLinkThrottledError{RetryAfter: oldest.Add(magicLinkWindow).Sub(now)}
+	}
+
+	return nil
+}
+
+// createUser creates a passwordless account for an address that just proved it receives mail
+func (s *MagicLinkService) createUser(tx *gorm.DB, email string) (*models.User, error) {
+	localPart, _, _ := strings.Cut(email, "@")
+	now := time.Now()
+
+	user := models.User{
+		Username:        NewOAuthService(s.cfg).generateUsername(&oauth.UserInfo{Name: localPart}),
+		Email:           email,
+		AuthProvider:    models.AuthMagicLink,
+		Status:          models.StatusActive,
+		EmailVerifiedAt: &now, // the link went to this address
+	}
+	if err := tx.Create(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// sendLink mails the sign-in link
+// user is nil when the link will create the account
+// Sent in the background so neither timing nor a mail error tells addresses apart
+func (s *MagicLinkService) sendLink(email string, user *models.User, token string) {
+	link := fmt.Sprintf("%s/magic-link?token=%s", s.cfg.App.FrontendURL, token)
+
+	greeting := "Hi,"
+	action := "To create your FilmFolk account and sign in, open this link"
+	if user != nil {
+		greeting = fmt.Sprintf("Hi %s,", user.Username)
+		action = "To sign in to FilmFolk, open this link"
+	}
+
+	mailer.SendAsync(mailer.Message{
+		To:      email,
+		Subject: "Your FilmFolk sign-in link",
+		Body: fmt.Sprintf(
+			"%s\n\n%s in the same browser you asked for it from:\n\n%s\n\n"+
+				"The link expires in %d minutes and can only be used once. "+
+				"If you didn't ask for it, ignore this email.\n",
+			greeting, action, link, s.cfg.Auth.MagicLinkTTL,
+		),
+	})
+}
@@ -163,7 +163,88 @@ func (s *MovieService) UpdateMovie(movieID uint64, input UpdateMovieInput) (*mod
 	return &movie, nil
 }
 
+// ListPendingMovies retrieves movies awaiting moderator approval
+func (s *MovieService) ListPendingMovies(page, pageSize int) ([]models.Movie, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
 
+	var total int64
+	query := db.DB.Model(&models.Movie{}).Where("status = ?", models.MovieStatusPending)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count movies: %w", err)
+	}
+
+	var movies []models.Movie
+	offset := (page - 1) * pageSize
+	err := db.DB.Where("status = ?", models.MovieStatusPending).
+		Preload("SubmittedBy").
+		Order("created_at ASC").
+		Offset(offset).
+		Limit(pageSize).
+		Find(&movies).Error
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch movies: %w", err)
+	}
+
+	return movies, total, nil
+}
+
+// ApproveMovie publishes a pending movie (moderator only)
+func (s *MovieService) ApproveMovie(movieID, moderatorID uint64) (*models.Movie, error) {
+	movie, err := s.GetMovie(movieID)
+	if err != nil {
+		return nil, err
+	}
+
+	if movie.Status != models.MovieStatusPending {
+		return nil, errors.New("movie is not pending approval")
+	}
+
+	updates := map[string]interface{}{
+		"status":              models.MovieStatusApproved,
+		"approved_by_user_id": moderatorID,
+	}
+	if err := db.DB.Model(movie).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to approve movie: %w", err)
+	}
+
+	db.DB.Preload("ApprovedBy").First(movie, movieID)
+
+	return movie, nil
+}
+
+// RejectMovie rejects a pending movie (moderator only)
+func (s *MovieService) RejectMovie(movieID uint64) error {
+	movie, err := s.GetMovie(movieID)
+	if err != nil {
+		return err
+	}
+
+	if movie.Status != models.MovieStatusPending {
+		return errors.New("movie is not pending approval")
+	}
+
+	return db.DB.Model(movie).Update("status", models.MovieStatusRejected).Error
+}
+
+// DeleteMovie permanently deletes a movie (admin only)
+func (s *MovieService) DeleteMovie(movieID uint64) error {
+	result := db.DB.Delete(&models.Movie{}, movieID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete movie: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("movie not found")
+	}
+
+	return nil
+}
 
 // RecalculateMovieStats recalculates average rating and review count
 func (s *MovieService) RecalculateMovieStats(movieID uint64) error {
@@ -173,7 +254,7 @@ func (s *MovieService) RecalculateMovieStats(movieID uint64) error {
 	}
 
 	err := db.DB.Model(&models.Review{}).
-		Select("AVG(rating) as avg_rating, COUNT(*) as review_count").
+		Select("AVG(rating) as avg_rating, COUNT(*) FILTER (WHERE review_text <> '') as review_count"). // ratings without text aren't reviews
 		Where("movie_id = ?", movieID).
 		Scan(&stats).Error
 
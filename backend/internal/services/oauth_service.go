@@ -2,7 +2,6 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -10,154 +9,360 @@ import (
 	"filmfolk/internal/config"
 	"filmfolk/internal/db"
 	"filmfolk/internal/models"
+	"filmfolk/internal/oauth"
+	"filmfolk/internal/utils"
 
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // OAuthService handles OAuth authentication logic
+// Works with any provider in the oauth registry (Google, Facebook, configured OIDC providers)
 type OAuthService struct {
-	cfg          *config.Config
-	googleConfig *oauth2.Config
-}
-
-// GoogleUserInfo represents user data from Google OAuth
-type GoogleUserInfo struct {
-	ID            string `json:"id"`
-	Email         string `json:"email"`
-	VerifiedEmail bool   `json:"verified_email"`
-	Name          string `json:"name"`
-	GivenName     string `json:"given_name"`
-	FamilyName    string `json:"family_name"`
-	Picture       string `json:"picture"`
-	Locale        string `json:"locale"`
+	cfg *config.Config
 }
 
 // NewOAuthService creates a new OAuth service
 func NewOAuthService(cfg *config.Config) *OAuthService {
-	googleConfig := &oauth2.Config{
-		ClientID:     cfg.OAuth.GoogleClientID,
-		ClientSecret: cfg.OAuth.GoogleClientSecret,
-		RedirectURL:  cfg.OAuth.GoogleRedirectURL,
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.email",
-			"https://www.googleapis.com/auth/userinfo.profile",
-		},
-		Endpoint: google.Endpoint,
-	}
-
 	return &OAuthService{
-		cfg:          cfg,
-		googleConfig: googleConfig,
+		cfg: cfg,
 	}
 }
 
-// GetGoogleAuthURL generates the Google OAuth authorization URL
-func (s *OAuthService) GetGoogleAuthURL(state string) string {
-	return s.googleConfig.AuthCodeURL(state, oauth2.AccessTypeOffline)
+const (
+	// oauthFlowTTL is how long a user has to finish at the provider
+	oauthFlowTTL = 10 * time.Minute
+	// exchangeCodeTTL is how long the frontend has to trade the callback code for tokens
+	exchangeCodeTTL = time.Minute
+)
+
+// StartLogin begins a login at the provider
+// Returns the consent URL and the state, which the caller binds to the browser
+func (s *OAuthService) StartLogin(providerName string) (authURL, state string, err error) {
+	return s.startFlow(providerName, models.OAuthFlowLogin, nil)
 }
 
-// HandleGoogleCallback processes the Google OAuth callback
-func (s *OAuthService) HandleGoogleCallback(code string) (*AuthResponse, error) {
-	// 1. Exchange authorization code for token
-	ctx := context.Background()
-	token, err := s.googleConfig.Exchange(ctx, code)
+// HandleCallback processes the provider's OAuth callback
+// Returns a one-time exchange code for the frontend instead of tokens, so tokens
+// never appear in a URL (browser history, Referer headers, proxy logs)
+func (s *OAuthService) HandleCallback(providerName, code, state string) (string, error) {
+	provider, err := oauth.Get(providerName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to exchange code for token: %w", err)
+		return "", err
 	}
 
-	// 2. Get user info from Google
-	client := s.googleConfig.Client(ctx, token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
+	// 1. Consume the flow started by StartLogin
+	flow, err := consumeOAuthFlow(providerName, models.OAuthFlowLogin, state)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user info: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
 
-	var googleUser GoogleUserInfo
-	if err := json.NewDecoder(resp.Body).Decode(&googleUser); err != nil {
-		return nil, fmt.Errorf("failed to decode user info: %w", err)
+	// 2. Exchange authorization code for the provider profile (PKCE verifier, nonce check)
+	info, err := provider.Exchange(context.Background(), oauth.FlowLogin, code, flowAuthParams(flow, state))
+	if err != nil {
+		return "", err
 	}
 
-	// 3. Validate email is verified
-	if !googleUser.VerifiedEmail {
-		return nil, errors.New("email not verified with Google")
+	// 3. Find, link or create user
+	user, err := s.findOrCreateUser(providerName, info)
+	if err != nil {
+		return "", fmt.Errorf("failed to process user: %w", err)
+	}
+
+	// 4. Issue the exchange code
+	exchangeCode, err := issueVerificationToken(db.DB, user.ID, models.PurposeOAuthExchange, exchangeCodeTTL)
+	if err != nil {
+		return "", fmt.Errorf("failed to issue exchange code: %w", err)
+	}
+
+	return exchangeCode, nil
+}
+
+// ExchangeCode trades the one-time code from the callback redirect for tokens
+// If the account has 2FA enabled, an MFAChallenge is returned instead of tokens, as with Login
+func (s *OAuthService) ExchangeCode(code string, device DeviceInfo) (*AuthResponse, *MFAChallenge, error) {
+	// 1. Consume the code
+	var userID uint64
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeVerificationToken(tx, code, models.PurposeOAuthExchange)
+		if err != nil {
+			return err
+		}
+		userID = token.UserID
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.New("invalid or expired code")
+	}
+
+	// 2. The account may have been suspended in the meantime
+	user, err := findUserByID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkAccountStatus(user); err != nil {
+		recordLoginFailure(user.ID, device, map[string]string{"reason": "account_" + string(user.Status), "method": "oauth"})
+		return nil, nil, err
 	}
 
-	// 4. Find or create user
-	user, err := s.findOrCreateGoogleUser(&googleUser)
+	// 3. The provider replaces the password, not the second factor
+	mfaEnabled, err := isMFAEnabled(db.DB, user)
 	if err != nil {
-		return nil, fmt.Errorf("failed to process user: %w", err)
+		return nil, nil, err
+	}
+	if mfaEnabled {
+		challenge, err := NewTwoFactorService(s.cfg).newChallenge(user)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, challenge, nil
 	}
 
-	// 5. Update last login time
+	// 4. Update last login time
 	now := time.Now()
 	user.LastLoginAt = &now
-	db.DB.Model(&user).Update("last_login_at", now)
+	db.DB.Model(user).Update("last_login_at", now)
+	recordUserEvent(models.EventLogin, user.ID, device, map[string]string{"method": "oauth"})
+	NewKnownDeviceService(s.cfg).noteLogin(user, device)
 
-	// 6. Generate JWT tokens
-	return s.generateAuthResponse(user)
+	// 5. Generate JWT tokens
+	response, err := s.generateAuthResponse(user, device)
+	return response, nil, err
 }
 
-// findOrCreateGoogleUser finds existing user or creates new one
-func (s *OAuthService) findOrCreateGoogleUser(googleUser *GoogleUserInfo) (*models.User, error) {
-	var user models.User
+// GetLinkURL starts linking a provider account to a signed-in user
+// The provider redirects to the frontend link page, which posts code and state back to Link
+func (s *OAuthService) GetLinkURL(providerName string, userID uint64) (authURL, state string, err error) {
+	return s.startFlow(providerName, models.OAuthFlowLink, &userID)
+}
 
-	// Try to find user by Google provider ID
-	err := db.DB.Where("auth_provider = ? AND provider_id = ?", models.AuthGoogle, googleUser.ID).
-		First(&user).Error
+// Link finishes linking: the provider account from code is attached to the user
+// The flow must have been started by the same user, so a code can't be slipped into someone else's account
+func (s *OAuthService) Link(providerName string, userID uint64, code, state string, device DeviceInfo) (*models.UserIdentity, error) {
+	provider, err := oauth.Get(providerName)
+	if err != nil {
+		return nil, err
+	}
 
-	if err == nil {
-		// User exists, check if active
-		if user.Status != models.StatusActive {
-			return nil, fmt.Errorf("account is %s", user.Status)
-		}
-		return &user, nil
+	// 1. Consume the flow and check it belongs to this user
+	flow, err := consumeOAuthFlow(providerName, models.OAuthFlowLink, state)
+	if err != nil || flow.UserID == nil || *flow.UserID != userID {
+		return nil, errors.New("invalid or expired link state")
+	}
+
+	// 2. Exchange authorization code for the provider profile
+	info, err := provider.Exchange(context.Background(), oauth.FlowLink, code, flowAuthParams(flow, state))
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Link - the user proved control of both accounts, no email match needed
+	var identity *models.UserIdentity
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		identity, err = linkIdentity(tx, userID, externalIdentity(providerName, info))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recordUserEvent(models.EventOAuthLinked, userID, device, map[string]string{"provider": providerName})
+	return identity, nil
+}
+
+// startFlow generates state, PKCE verifier and nonce, stores them and returns the consent URL
+func (s *OAuthService) startFlow(providerName string, purpose models.OAuthFlowPurpose, userID *uint64) (authURL, state string, err error) {
+	provider, err := oauth.Get(providerName)
+	if err != nil {
+		return "", "", err
+	}
+
+	params, err := oauth.NewAuthParams()
+	if err != nil {
+		return "", "", err
+	}
+
+	// Drop abandoned flows while we're here
+	now := time.Now()
+	db.DB.Where("expires_at < ?", now).Delete(&models.OAuthFlow{})
+
+	flow := models.OAuthFlow{
+		StateHash:    utils.HashToken(params.State),
+		Provider:     providerName,
+		Purpose:      purpose,
+		UserID:       userID,
+		CodeVerifier: params.CodeVerifier,
+		Nonce:        params.Nonce,
+		ExpiresAt:    now.Add(oauthFlowTTL),
+	}
+	if err := db.DB.Create(&flow).Error; err != nil {
+		return "", "", fmt.Errorf("failed to store OAuth flow: %w", err)
+	}
+
+	flowType := oauth.FlowLogin
+	if purpose == models.OAuthFlowLink {
+		flowType = oauth.FlowLink
+	}
+
+	authURL, err = provider.AuthCodeURL(context.Background(), flowType, params)
+	if err != nil {
+		return "", "", err
+	}
+
+	return authURL, params.State, nil
+}
+
+// consumeOAuthFlow finds the flow for state and deletes it, so each state works once
+func consumeOAuthFlow(providerName string, purpose models.OAuthFlowPurpose, state string) (*models.OAuthFlow, error) {
+	if state == "" {
+		return nil, errors.New("invalid or expired OAuth state")
+	}
+
+	var flow models.OAuthFlow
+	result := db.DB.Clauses(clause.Returning{}).
+		Where("state_hash = ?", utils.HashToken(state)).
+		Delete(&flow)
+	if result.Error != nil {
+		return nil, fmt.Errorf("database error: %w", result.Error)
+	}
+
+	// A state from another provider or purpose is as good as none
+	if result.RowsAffected == 0 || flow.Provider != providerName || flow.Purpose != purpose || flow.IsExpired() {
+		return nil, errors.New("invalid or expired OAuth state")
+	}
+
+	return &flow, nil
+}
+
+// flowAuthParams rebuilds the provider parameters of a stored flow
+func flowAuthParams(flow *models.OAuthFlow, state string) oauth.AuthParams {
+	return oauth.AuthParams{State: state, CodeVerifier: flow.CodeVerifier, Nonce: flow.Nonce}
+}
+
+// externalIdentity converts a provider profile to an external identity
+func externalIdentity(providerName string, info *oauth.UserInfo) *ExternalIdentity {
+	return &ExternalIdentity{
+		Provider:      providerName,
+		Subject:       info.Subject,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
 	}
+}
+
+// findOrCreateUser finds the user linked to a provider account
+// If none is linked yet, the account is linked to the user with the same email
+// (only when both sides verified the address) or a new user is created
+func (s *OAuthService) findOrCreateUser(providerName string, info *oauth.UserInfo) (*models.User, error) {
+	ext := externalIdentity(providerName, info)
+	var user *models.User
+	created := false
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. Already linked - sign in regardless of the email
+		linked, err := findUserByIdentity(tx, ext)
+		if err == nil {
+			user = linked
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		if ext.Email == "" {
+			return fmt.Errorf("%s did not share an email address", providerName)
+		}
+
+		// 2. Existing account with this email - link automatically, but only if the
+		// provider vouches for the address
+		var existing models.User
+		err = tx.Where("email = ?", ext.Email).First(&existing).Error
+		if err == nil {
+			if !ext.EmailVerified {
+				return fmt.Errorf("an account with this email already exists, log in and link %s from your settings", providerName)
+			}
+			// An unverified account may have been registered by someone else
+			// with this address; linking would hand them the provider user's login
+			if !existing.IsEmailVerified() {
+				return errors.New("an account with this email exists but is not verified, log in with your password or reset it first")
+			}
+			if _, err := linkIdentity(tx, existing.ID, ext); err != nil {
+				return err
+			}
+			user = &existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("database error: %w", err)
+		}
 
-	if !errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, fmt.Errorf("database error: %w", err)
+		// 3. New user
+		newUser, err := s.createUser(tx, providerName, info)
+		if err != nil {
+			return err
+		}
+		if _, err := linkIdentity(tx, newUser.ID, ext); err != nil {
+			return err
+		}
+		user = newUser
+		created = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Check if user with this email already exists (different auth provider)
-	err = db.DB.Where("email = ?", googleUser.Email).First(&user).Error
-	if err == nil {
-		// Email exists but different provider
-		return nil, errors.New("email already registered with different login method")
+	// New account with an address the provider didn't vouch for - verify it ourselves
+	if created && !user.IsEmailVerified() {
+		if err := NewVerificationService(s.cfg).SendVerificationEmail(user); err != nil {
+			utils.GetLogger().Error().
+				Err(err).
+				Uint64("user_id", user.ID).
+				Msg("Failed to send verification email")
+		}
 	}
 
-	if !errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, fmt.Errorf("database error: %w", err)
+	// Check if active
+	if err := checkAccountStatus(user); err != nil {
+		return nil, err
 	}
 
-	// Create new user
-	username := s.generateUsername(googleUser)
-	providerID := googleUser.ID
+	return user, nil
+}
+
+// createUser creates a user for a provider account
+func (s *OAuthService) createUser(tx *gorm.DB, providerName string, info *oauth.UserInfo) (*models.User, error) {
+	username := s.generateUsername(info)
+	providerID := info.Subject
 
-	user = models.User{
+	user := models.User{
 		Username:     username,
-		Email:        googleUser.Email,
+		Email:        info.Email,
 		PasswordHash: nil, // OAuth users don't have passwords
-		AuthProvider: models.AuthGoogle,
+		AuthProvider: models.AuthProvider(providerName),
 		ProviderID:   &providerID,
 		Status:       models.StatusActive,
-		AvatarURL:    &googleUser.Picture,
+	}
+	if info.Picture != "" {
+		user.AvatarURL = &info.Picture
+	}
+	if info.EmailVerified {
+		now := time.Now() // the provider already verified the address
+		user.EmailVerifiedAt = &now
 	}
 
-	if err := db.DB.Create(&user).Error; err != nil {
+	if err := tx.Create(&user).Error; err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
 	return &user, nil
 }
 
-// generateUsername creates a unique username from Google user info
-func (s *OAuthService) generateUsername(googleUser *GoogleUserInfo) string {
+// generateUsername creates a unique username from the provider profile
+func (s *OAuthService) generateUsername(info *oauth.UserInfo) string {
 	// Try name first
-	baseUsername := googleUser.GivenName
+	baseUsername := info.GivenName
 	if baseUsername == "" {
-		baseUsername = googleUser.Name
+		baseUsername = info.Name
 	}
 	if baseUsername == "" {
 		baseUsername = "user"
@@ -165,6 +370,9 @@ func (s *OAuthService) generateUsername(googleUser *GoogleUserInfo) string {
 
 	// Remove spaces and special characters
 	baseUsername = sanitizeUsername(baseUsername)
+	if models.IsReservedUsername(baseUsername) {
+		baseUsername = "user"
+	}
 
 	// Check if username exists
 	username := baseUsername
@@ -212,8 +420,8 @@ func sanitizeUsername(s string) string {
 }
 
 // generateAuthResponse creates JWT tokens for OAuth user
-func (s *OAuthService) generateAuthResponse(user *models.User) (*AuthResponse, error) {
+func (s *OAuthService) generateAuthResponse(user *models.User, device DeviceInfo) (*AuthResponse, error) {
 	// Create service to reuse token generation logic
 	authService := NewAuthService(s.cfg)
-	return authService.generateAuthResponse(user)
+	return authService.generateAuthResponse(user, device)
 }
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/db"
+	"filmfolk/internal/mailer"
+	"filmfolk/internal/models"
+	"filmfolk/internal/passwordpolicy"
+	"filmfolk/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// PasswordService handles password changes and recovery
+type PasswordService struct {
+	cfg *config.Config
+}
+
+// NewPasswordService creates a new password service
+func NewPasswordService(cfg *config.Config) *PasswordService {
+	return &PasswordService{cfg: cfg}
+}
+
+// ResetPasswordInput represents data for setting a new password with a reset token
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"` // checked by the password policy
+}
+
+// ChangePasswordInput represents data for changing the password while signed in
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"` // checked by the password policy
+}
+
+// ForgotPassword mails a password reset link
+// Silently does nothing for unknown accounts to avoid user enumeration
+// OAuth-only accounts get the link too - it's how they add a password next to their linked providers
+func (s *PasswordService) ForgotPassword(email string) error {
+	var user models.User
+	err := db.DB.Where("email = ?", email).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	// Guest placeholder addresses can't receive mail
+	if user.IsGuest() {
+		return nil
+	}
+
+	ttl := time.Duration(s.cfg.Auth.PasswordResetTTL) * time.Minute
+	token, err := issueVerificationToken(db.DB, user.ID, models.PurposePasswordReset, ttl)
+	if err != nil {
+		return err
+	}
+
+	// Sent in the background so neither timing nor a mail error tells accounts apart
+	link := fmt.Sprintf("%s/reset-password?token=%s", s.cfg.App.FrontendURL, token)
+	mailer.SendAsync(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your FilmFolk password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone asked to reset the password for your FilmFolk account. "+
+				"To choose a new password, open this link:\n\n%s\n\n"+
+				"The link expires in %d minutes and can only be used once. "+
+				"If you didn't ask for this, ignore this email - your password won't change.\n",
+			user.Username, link, s.cfg.Auth.PasswordResetTTL,
+		),
+	})
+	return nil
+}
+
+// ResetPassword sets a new password using a reset token
+// All of the user's sessions and personal access tokens are revoked, so a stolen session
+// dies with the old password
+func (s *PasswordService) ResetPassword(input ResetPasswordInput, device DeviceInfo) (RevokedCounts, error) {
+	hashedPassword, err := utils.HashPassword(input.Password)
+	if err != nil {
+		return RevokedCounts{}, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	var userID uint64
+	var revoked *sessionRevocation
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeVerificationToken(tx, input.Token, models.PurposePasswordReset)
+		if err != nil {
+			return err
+		}
+		userID = token.UserID
+
+		// A refused password rolls back, the link stays usable for another try
+		var user models.User
+		if err := tx.First(&user, token.UserID).Error; err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+		if err := passwordpolicy.Check(input.Password, user.Username, user.Email); err != nil {
+			return err
+		}
+
+		// Following the emailed link also proves the address belongs to the user
+		err = tx.Model(&user).Updates(map[string]interface{}{
+			"password_hash":     hashedPassword,
+			"email_verified_at": gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()),
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+
+		revoked, err = revokeUserSessions(tx, token.UserID, "")
+		return err
+	})
+	if err != nil {
+		return RevokedCounts{}, err
+	}
+	if err := revoked.apply(); err != nil {
+		return RevokedCounts{}, err
+	}
+
+	recordUserEvent(models.EventPasswordReset, userID, device, revoked.details(nil))
+	return revoked.counts(), nil
+}
+
+// ChangePassword replaces the password of a signed-in user
+// Every other session and all personal access tokens are revoked; the session making
+// the change stays signed in
+func (s *PasswordService) ChangePassword(userID uint64, sessionID string, input ChangePasswordInput, device DeviceInfo) (RevokedCounts, error) {
+	// 1. Find user
+	user, err := findUserByID(userID)
+	if err != nil {
+		return RevokedCounts{}, err
+	}
+	if user.PasswordHash == nil {
+		return RevokedCounts{}, errors.New("account has no password, use forgot password to set one")
+	}
+
+	// 2. Verify the current password, throttled like a login
+	// Otherwise a stolen session could be used to guess the password
+	lockout := NewLockoutService(s.cfg)
+	if err := lockout.CheckLoginAllowed(user); err != nil {
+		return RevokedCounts{}, err
+	}
+	if !utils.VerifyPassword(*user.PasswordHash, input.CurrentPassword) {
+		lockout.RecordFailure(user)
+		return RevokedCounts{}, errors.New("current password is incorrect")
+	}
+
+	// 3. Check the new password
+	if input.NewPassword == input.CurrentPassword {
+		return RevokedCounts{}, passwordpolicy.SameAsCurrent()
+	}
+	if err := passwordpolicy.Check(input.NewPassword, user.Username, user.Email); err != nil {
+		return RevokedCounts{}, err
+	}
+
+	hashedPassword, err := utils.HashPassword(input.NewPassword)
+	if err != nil {
+		return RevokedCounts{}, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	// 4. Update and sign out everywhere else
+	var revoked *sessionRevocation
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("password_hash", hashedPassword).Error; err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+
+		revoked, err = revokeUserSessions(tx, userID, sessionID)
+		return err
+	})
+	if err != nil {
+		return RevokedCounts{}, err
+	}
+	if err := revoked.apply(); err != nil {
+		return RevokedCounts{}, err
+	}
+
+	lockout.RecordSuccess(user)
+	recordUserEvent(models.EventPasswordChanged, userID, device, revoked.details(nil))
+	return revoked.counts(), nil
+}
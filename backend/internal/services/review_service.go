@@ -25,6 +25,11 @@ type CreateReviewInput struct {
 	ReviewText string `json:"review_text" binding:"required,min=10"`
 }
 
+// RateMovieInput represents a rating without a written review
+type RateMovieInput struct {
+	Rating int `json:"rating" binding:"required,min=1,max=10"`
+}
+
 // UpdateReviewInput represents data for updating a review
 type UpdateReviewInput struct {
 	Rating     *int    `json:"rating,omitempty"`
@@ -39,11 +44,16 @@ type CreateCommentInput struct {
 }
 
 // CreateReview creates a new review
+// A rating given earlier without text (e.g. as a guest) becomes the review
 func (s *ReviewService) CreateReview(input CreateReviewInput, userID uint64) (*models.Review, error) {
 	// Check if user already reviewed this movie
 	var existing models.Review
 	err := db.DB.Where("user_id = ? AND movie_id = ?", userID, input.MovieID).First(&existing).Error
 	if err == nil {
+		if existing.IsRatingOnly() {
+			text := input.ReviewText
+			return s.UpdateReview(existing.ID, userID, UpdateReviewInput{Rating: &input.Rating, ReviewText: &text})
+		}
 		return nil, errors.New("you have already reviewed this movie")
 	}
 	if !errors.Is(err, gorm.ErrRecordNotFound) {
@@ -81,6 +91,44 @@ func (s *ReviewService) CreateReview(input CreateReviewInput, userID uint64) (*m
 	return &review, nil
 }
 
+// RateMovie sets the user's rating of a movie without writing a review
+// Counts towards the movie's average rating but isn't listed with the reviews.
+// If the user already reviewed the movie, only the review's rating changes
+func (s *ReviewService) RateMovie(movieID, userID uint64, input RateMovieInput) (*models.Review, error) {
+	// Verify movie exists
+	var movie models.Movie
+	if err := db.DB.First(&movie, movieID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("movie not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	var review models.Review
+	err := db.DB.Where("user_id = ? AND movie_id = ?", userID, movieID).First(&review).Error
+	if err == nil {
+		return s.UpdateReview(review.ID, userID, UpdateReviewInput{Rating: &input.Rating})
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	review = models.Review{
+		UserID:  userID,
+		MovieID: movieID,
+		Rating:  input.Rating,
+	}
+	if err := db.DB.Create(&review).Error; err != nil {
+		return nil, fmt.Errorf("failed to save rating: %w", err)
+	}
+
+	// Update movie stats
+	movieService := NewMovieService()
+	movieService.RecalculateMovieStats(movieID)
+
+	return &review, nil
+}
+
 // GetReview retrieves a review by ID
 func (s *ReviewService) GetReview(reviewID uint64) (*models.Review, error) {
 	var review models.Review
@@ -111,7 +159,7 @@ func (s *ReviewService) GetReviewsForMovie(movieID uint64, page, pageSize int) (
 
 	var total int64
 	query := db.DB.Model(&models.Review{}).
-		Where("movie_id = ? AND status = ?", movieID, models.ReviewStatusPublished)
+		Where("movie_id = ? AND status = ? AND review_text <> ''", movieID, models.ReviewStatusPublished)
 
 	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
@@ -119,7 +167,7 @@ func (s *ReviewService) GetReviewsForMovie(movieID uint64, page, pageSize int) (
 
 	var reviews []models.Review
 	offset := (page - 1) * pageSize
-	err := db.DB.Where("movie_id = ? AND status = ?", movieID, models.ReviewStatusPublished).
+	err := db.DB.Where("movie_id = ? AND status = ? AND review_text <> ''", movieID, models.ReviewStatusPublished).
 		Preload("User").
 		Order("created_at DESC").
 		Offset(offset).
@@ -144,7 +192,7 @@ func (s *ReviewService) GetUserReviews(userID uint64, page, pageSize int) ([]mod
 
 	var total int64
 	query := db.DB.Model(&models.Review{}).
-		Where("user_id = ? AND status = ?", userID, models.ReviewStatusPublished)
+		Where("user_id = ? AND status = ? AND review_text <> ''", userID, models.ReviewStatusPublished)
 
 	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
@@ -152,7 +200,7 @@ func (s *ReviewService) GetUserReviews(userID uint64, page, pageSize int) ([]mod
 
 	var reviews []models.Review
 	offset := (page - 1) * pageSize
-	err := db.DB.Where("user_id = ? AND status = ?", userID, models.ReviewStatusPublished).
+	err := db.DB.Where("user_id = ? AND status = ? AND review_text <> ''", userID, models.ReviewStatusPublished).
 		Preload("Movie").
 		Order("created_at DESC").
 		Offset(offset).
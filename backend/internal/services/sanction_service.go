@@ -0,0 +1,363 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"filmfolk/internal/db"
+	"filmfolk/internal/mailer"
+	"filmfolk/internal/models"
+	"filmfolk/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// sanctionExpiryInterval is how often run-out suspensions are lifted
+	// Logins lift them on the spot too, this keeps the status accurate for everyone else
+	sanctionExpiryInterval = 10 * time.Minute
+	// sanctionExpiryBatch limits how many suspensions are lifted per run
+	sanctionExpiryBatch = 500
+)
+
+// AccountStatusError is returned when a suspended, banned or deleted account tries to sign in
+// Handlers turn it into 403 with the reason and end date
+type AccountStatusError struct {
+	Status models.AccountStatus
+	Reason string
+	Until  *time.Time // end of a suspension, nil otherwise
+}
+
+func (e *AccountStatusError) Error() string {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "account is %s", e.Status)
+	if e.Until != nil {
+		fmt.Fprintf(&msg, " until %s", e.Until.UTC().Format("January 2, 2006 15:04 MST"))
+	}
+	if e.Reason != "" {
+		fmt.Fprintf(&msg, ": %s", e.Reason)
+	}
+	return msg.String()
+}
+
+// checkAccountStatus returns an AccountStatusError unless the account may be used
+// A suspension that has run out is lifted here rather than waiting for the next expiry run
+func checkAccountStatus(user *models.User) error {
+	if user.IsSuspensionOver() {
+		if err := liftSuspension(user.ID); err != nil {
+			return err
+		}
+		user.Status = models.StatusActive
+		user.StatusReason = nil
+		user.SuspendedUntil = nil
+	}
+
+	if user.Status == models.StatusActive {
+		return nil
+	}
+
+	statusErr := &AccountStatusError{Status: user.Status}
+	if user.StatusReason != nil {
+		statusErr.Reason = *user.StatusReason
+	}
+	if user.Status == models.StatusSuspended {
+		statusErr.Until = user.SuspendedUntil
+	}
+	return statusErr
+}
+
+// liftSuspension reactivates an account whose suspension has run out and records it
+// Safe to race: only the caller that actually flips the status writes the history entry
+func liftSuspension(userID uint64) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND status = ? AND suspended_until <= ?", userID, models.StatusSuspended, time.Now()).
+			Updates(map[string]interface{}{
+				"status":          models.StatusActive,
+				"status_reason":   nil,
+				"suspended_until": nil,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to lift suspension: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		if err := tx.Create(&models.AccountSanction{UserID: userID, Action: models.SanctionExpire}).Error; err != nil {
+			return fmt.Errorf("failed to record sanction: %w", err)
+		}
+		return nil
+	})
+}
+
+// SanctionService handles suspending, banning and reinstating users
+type SanctionService struct{}
+
+// NewSanctionService creates a new sanction service
+func NewSanctionService() *SanctionService {
+	return &SanctionService{}
+}
+
+// SuspendInput represents data for suspending a user
+type SuspendInput struct {
+	Reason string    `json:"reason" binding:"required,max=1000"`
+	Until  time.Time `json:"until" binding:"required"`
+}
+
+// BanInput represents data for banning a user
+type BanInput struct {
+	Reason string `json:"reason" binding:"required,max=1000"`
+}
+
+// ReinstateInput represents data for lifting a suspension or ban early
+type ReinstateInput struct {
+	Reason string `json:"reason" binding:"max=1000"`
+}
+
+// SuspendUser suspends a user until the given time
+// Suspending an already suspended user replaces the end date and reason
+func (s *SanctionService) SuspendUser(targetUserID, adminID uint64, input SuspendInput) (*models.User, error) {
+	if !input.Until.After(time.Now()) {
+		return nil, errors.New("suspension end must be in the future")
+	}
+
+	until := input.Until.UTC()
+	return s.sanction(targetUserID, adminID, models.SanctionSuspend, strings.TrimSpace(input.Reason), &until)
+}
+
+// BanUser bans a user indefinitely
+func (s *SanctionService) BanUser(targetUserID, adminID uint64, input BanInput) (*models.User, error) {
+	return s.sanction(targetUserID, adminID, models.SanctionBan, strings.TrimSpace(input.Reason), nil)
+}
+
+// sanction suspends or bans a user, signs them out everywhere and tells them why
+func (s *SanctionService) sanction(targetUserID, adminID uint64, action models.SanctionAction, reason string, until *time.Time) (*models.User, error) {
+	if reason == "" {
+		return nil, errors.New("a reason is required")
+	}
+
+	// 1. Check the target
+	if targetUserID == adminID {
+		return nil, errors.New("cannot sanction yourself")
+	}
+
+	user, err := findUserByID(targetUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case user.Role == models.RoleAdmin:
+		return nil, errors.New("cannot sanction an admin, change their role first")
+	case user.Status == models.StatusDeleted || user.AuthProvider == models.AuthSystem:
+		return nil, errors.New("cannot sanction this account")
+	case user.Status == models.StatusBanned && action == models.SanctionBan:
+		return nil, errors.New("user is already banned")
+	case user.Status == models.StatusBanned && action == models.SanctionSuspend:
+		// Don't turn a ban into something that runs out by accident
+		return nil, errors.New("user is banned, reinstate them first")
+	}
+
+	status := models.StatusSuspended
+	if action == models.SanctionBan {
+		status = models.StatusBanned
+	}
+
+	// 2. Apply, record and sign out
+	// Changing the status also bumps tokens_valid_after (DB trigger); a suspension being
+	// extended doesn't change it, so revokeUserSessions handles the access tokens either way
+	var revoked *sessionRevocation
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Updates(map[string]interface{}{
+			"status":          status,
+			"status_reason":   reason,
+			"suspended_until": until,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to update status: %w", err)
+		}
+
+		if err := tx.Create(&models.AccountSanction{
+			UserID:  user.ID,
+			Action:  action,
+			Reason:  &reason,
+			EndsAt:  until,
+			ActorID: &adminID,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to record sanction: %w", err)
+		}
+
+		revoked, err = revokeUserSessions(tx, user.ID, "")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := revoked.apply(); err != nil {
+		return nil, err
+	}
+
+	user.Status = status
+	user.StatusReason = &reason
+	user.SuspendedUntil = until
+
+	// 3. Tell the user
+	s.sendNotice(user)
+
+	return user, nil
+}
+
+// ReinstateUser lifts a suspension or ban early
+func (s *SanctionService) ReinstateUser(targetUserID, adminID uint64, input ReinstateInput) (*models.User, error) {
+	user, err := findUserByID(targetUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Status != models.StatusSuspended && user.Status != models.StatusBanned {
+		return nil, errors.New("user is not suspended or banned")
+	}
+
+	var reason *string
+	if trimmed := strings.TrimSpace(input.Reason); trimmed != "" {
+		reason = &trimmed
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		// Conditional on the status we saw, in case the suspension ran out meanwhile
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND status = ?", user.ID, user.Status).
+			Updates(map[string]interface{}{
+				"status":          models.StatusActive,
+				"status_reason":   nil,
+				"suspended_until": nil,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to update status: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("user is not suspended or banned")
+		}
+
+		if err := tx.Create(&models.AccountSanction{
+			UserID:  user.ID,
+			Action:  models.SanctionReinstate,
+			Reason:  reason,
+			ActorID: &adminID,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to record sanction: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user.Status = models.StatusActive
+	user.StatusReason = nil
+	user.SuspendedUntil = nil
+
+	s.sendNotice(user)
+
+	return user, nil
+}
+
+// ListSanctions returns a user's sanctions history, newest first
+func (s *SanctionService) ListSanctions(userID uint64) ([]models.AccountSanction, error) {
+	if _, err := findUserByID(userID); err != nil {
+		return nil, err
+	}
+
+	var sanctions []models.AccountSanction
+	err := db.DB.Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Find(&sanctions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sanctions: %w", err)
+	}
+
+	return sanctions, nil
+}
+
+// ProcessExpiredSuspensions lifts suspensions that have run out
+func (s *SanctionService) ProcessExpiredSuspensions() (int, error) {
+	var userIDs []uint64
+	err := db.DB.Model(&models.User{}).
+		Where("status = ? AND suspended_until <= ?", models.StatusSuspended, time.Now()).
+		Order("suspended_until").
+		Limit(sanctionExpiryBatch).
+		Pluck("id", &userIDs).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired suspensions: %w", err)
+	}
+
+	lifted := 0
+	for _, userID := range userIDs {
+		if err := liftSuspension(userID); err != nil {
+			utils.GetLogger().Error().Err(err).Uint64("user_id", userID).Msg("Failed to lift suspension")
+			continue
+		}
+		lifted++
+	}
+
+	return lifted, nil
+}
+
+// RunExpiry lifts run-out suspensions periodically
+// Blocks until ctx is cancelled
+func (s *SanctionService) RunExpiry(ctx context.Context) {
+	ticker := time.NewTicker(sanctionExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			lifted, err := s.ProcessExpiredSuspensions()
+			if err != nil {
+				utils.GetLogger().Error().Err(err).Msg("Failed to process expired suspensions")
+				continue
+			}
+			if lifted > 0 {
+				utils.GetLogger().Info().Int("count", lifted).Msg("Lifted expired suspensions")
+			}
+		}
+	}
+}
+
+// sendNotice emails the user their new account status
+// Best effort: the sanction stands even if the mail doesn't go out
+func (s *SanctionService) sendNotice(user *models.User) {
+	if user.IsGuest() {
+		return // placeholder address
+	}
+
+	var subject, body string
+	switch user.Status {
+	case models.StatusSuspended:
+		subject = "Your FilmFolk account has been suspended"
+		body = fmt.Sprintf(
+			"Hi %s,\n\nYour FilmFolk account has been suspended until %s.\n\nReason: %s\n\n"+
+				"You can log in again once the suspension ends.\n",
+			user.Username, user.SuspendedUntil.UTC().Format("January 2, 2006 15:04 MST"), *user.StatusReason,
+		)
+	case models.StatusBanned:
+		subject = "Your FilmFolk account has been banned"
+		body = fmt.Sprintf(
+			"Hi %s,\n\nYour FilmFolk account has been banned.\n\nReason: %s\n",
+			user.Username, *user.StatusReason,
+		)
+	default:
+		subject = "Your FilmFolk account has been reinstated"
+		body = fmt.Sprintf("Hi %s,\n\nYour FilmFolk account has been reinstated. You can log in again.\n", user.Username)
+	}
+
+	if err := mailer.Send(mailer.Message{To: user.Email, Subject: subject, Body: body}); err != nil {
+		utils.GetLogger().Error().Err(err).Uint64("user_id", user.ID).Msg("Failed to send account status notice")
+	}
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"filmfolk/internal/db"
+	"filmfolk/internal/models"
+	"filmfolk/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// RecordSecurityEvent appends an entry to the security audit log
+// IP, user agent and request ID are taken from device
+// Best effort: a failed write is logged but never fails the action being audited
+func RecordSecurityEvent(event models.SecurityEvent, device DeviceInfo) {
+	event.IPAddress = device.IPAddress
+	event.UserAgent = device.UserAgent
+	event.RequestID = device.RequestID
+	if event.Details == nil {
+		event.Details = map[string]string{}
+	}
+
+	if err := db.DB.Create(&event).Error; err != nil {
+		logger := utils.GetLogger().Error().Err(err).Str("event_type", string(event.EventType))
+		if event.UserID != nil {
+			logger = logger.Uint64("user_id", *event.UserID)
+		}
+		logger.Msg("Failed to record security event")
+	}
+}
+
+// recordUserEvent records an event the user performed on their own account
+func recordUserEvent(eventType models.SecurityEventType, userID uint64, device DeviceInfo, details map[string]string) {
+	RecordSecurityEvent(models.SecurityEvent{UserID: &userID, EventType: eventType, Details: details}, device)
+}
+
+// recordLoginFailure records a refused login
+// userID is 0 when no account matched
+func recordLoginFailure(userID uint64, device DeviceInfo, details map[string]string) {
+	event := models.SecurityEvent{EventType: models.EventLoginFailed, Details: details}
+	if userID != 0 {
+		event.UserID = &userID
+	}
+	RecordSecurityEvent(event, device)
+}
+
+// SecurityEventService reads the security audit log
+type SecurityEventService struct{}
+
+// NewSecurityEventService creates a new security event service
+func NewSecurityEventService() *SecurityEventService {
+	return &SecurityEventService{}
+}
+
+// SecurityEventFilter narrows an admin query of the audit log
+// Zero values don't filter
+type SecurityEventFilter struct {
+	UserID    uint64                   `form:"user_id"`
+	EventType models.SecurityEventType `form:"event_type"`
+	IPAddress string                   `form:"ip_address"`
+	RequestID string                   `form:"request_id"`
+	From      time.Time                `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To        time.Time                `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Page      int                      `form:"page"`
+	PageSize  int                      `form:"page_size"`
+}
+
+// ListUserEvents returns a user's own security events, newest first
+func (s *SecurityEventService) ListUserEvents(userID uint64, page, pageSize int) ([]models.SecurityEvent, int64, error) {
+	return s.QueryEvents(SecurityEventFilter{UserID: userID, Page: page, PageSize: pageSize})
+}
+
+// QueryEvents searches the audit log, newest first
+func (s *SecurityEventService) QueryEvents(filter SecurityEventFilter) ([]models.SecurityEvent, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 || filter.PageSize > 100 {
+		filter.PageSize = 50
+	}
+
+	filtered := func() *gorm.DB {
+		query := db.DB.Model(&models.SecurityEvent{})
+		if filter.UserID != 0 {
+			query = query.Where("user_id = ?", filter.UserID)
+		}
+		if filter.EventType != "" {
+			query = query.Where("event_type = ?", filter.EventType)
+		}
+		if filter.IPAddress != "" {
+			query = query.Where("ip_address = ?", filter.IPAddress)
+		}
+		if filter.RequestID != "" {
+			query = query.Where("request_id = ?", filter.RequestID)
+		}
+		if !filter.From.IsZero() {
+			query = query.Where("created_at >= ?", filter.From)
+		}
+		if !filter.To.IsZero() {
+			query = query.Where("created_at < ?", filter.To)
+		}
+		return query
+	}
+
+	var total int64
+	if err := filtered().Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count security events: %w", err)
+	}
+
+	var events []models.SecurityEvent
+	err := filtered().
+		Order("created_at DESC, id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&events).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch security events: %w", err)
+	}
+
+	return events, total, nil
+}
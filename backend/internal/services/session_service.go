@@ -0,0 +1,242 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"filmfolk/internal/db"
+	"filmfolk/internal/models"
+	"filmfolk/internal/revocation"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SessionService manages a user's active sessions
+// A session is one refresh token family: it survives rotation and ends on logout or revocation
+type SessionService struct{}
+
+// NewSessionService creates a new session service
+func NewSessionService() *SessionService {
+	return &SessionService{}
+}
+
+// Session is an active login as shown to its owner
+type Session struct {
+	ID         string    `json:"id"`
+	Label      *string   `json:"label,omitempty"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // the session the request was made from
+}
+
+// RenameSessionInput represents data for labelling a session
+type RenameSessionInput struct {
+	Label string `json:"label" binding:"required,max=100"`
+}
+
+// ListSessions returns the user's active sessions, most recently used first
+func (s *SessionService) ListSessions(userID uint64, currentSessionID string) ([]Session, error) {
+	// Only the newest token of each family is unrevoked, so one row = one session
+	var tokens []models.RefreshToken
+	err := db.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&tokens).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sessions: %w", err)
+	}
+
+	sessions := make([]Session, 0, len(tokens))
+	for _, t := range tokens {
+		sessions = append(sessions, Session{
+			ID:         t.FamilyID,
+			Label:      t.Label,
+			UserAgent:  t.UserAgent,
+			IPAddress:  t.IPAddress,
+			CreatedAt:  t.SessionStartedAt,
+			LastUsedAt: t.LastUsedAt,
+			ExpiresAt:  t.ExpiresAt,
+			Current:    t.FamilyID == currentSessionID,
+		})
+	}
+
+	return sessions, nil
+}
+
+// RenameSession sets the user-chosen label of a session
+func (s *SessionService) RenameSession(userID uint64, sessionID, label string) error {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return errors.New("session not found")
+	}
+
+	result := db.DB.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND family_id = ? AND revoked_at IS NULL", userID, sessionID).
+		Update("label", label)
+	if result.Error != nil {
+		return fmt.Errorf("failed to rename session: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("session not found")
+	}
+
+	return nil
+}
+
+// RevokeSession ends one of the user's sessions
+func (s *SessionService) RevokeSession(userID uint64, sessionID string, device DeviceInfo) error {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return errors.New("session not found")
+	}
+
+	result := db.DB.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND family_id = ? AND revoked_at IS NULL", userID, sessionID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke session: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("session not found")
+	}
+
+	// Kill access tokens already handed out for this session
+	if err := revocation.RevokeSession(sessionID); err != nil {
+		return fmt.Errorf("failed to revoke session access tokens: %w", err)
+	}
+
+	recordUserEvent(models.EventSessionRevoked, userID, device, map[string]string{"session_id": sessionID})
+	return nil
+}
+
+// RevokeAllSessions ends all of the user's sessions and personal access tokens
+// keepSessionID, if not empty, is left active (typically the caller's own session)
+func (s *SessionService) RevokeAllSessions(userID uint64, keepSessionID string, device DeviceInfo) (RevokedCounts, error) {
+	revoked, err := revokeUserSessions(db.DB, userID, keepSessionID)
+	if err != nil {
+		return RevokedCounts{}, err
+	}
+	if err := revoked.apply(); err != nil {
+		return RevokedCounts{}, err
+	}
+
+	recordUserEvent(models.EventSessionsRevoked, userID, device, revoked.details(map[string]string{"kept_session_id": keepSessionID}))
+	return revoked.counts(), nil
+}
+
+// RevokedCounts is what signing a user out everywhere ended
+type RevokedCounts struct {
+	Sessions     int64 // refresh tokens revoked
+	AccessTokens int64 // personal access tokens revoked
+}
+
+// sessionRevocation is what revokeUserSessions ended in the database
+// The access tokens are only rejected by apply, once the transaction has committed
+type sessionRevocation struct {
+	userID       uint64
+	familyIDs    []string
+	cutoff       bool  // tokens_valid_after was bumped
+	revoked      int64 // refresh tokens revoked
+	accessTokens int64 // personal access tokens revoked
+}
+
+// revokeUserSessions revokes every active refresh token and personal access token of a user
+// Shared by anything that must sign a user out everywhere (password reset etc.)
+// Personal access tokens never belong to the kept session, so they go in any case - one
+// an attacker created would otherwise outlive the recovery.
+// When no session is kept the user's token cutoff is bumped too, which also covers
+// tokens without a session. Call apply on the result after the transaction commits
+func revokeUserSessions(tx *gorm.DB, userID uint64, keepSessionID string) (*sessionRevocation, error) {
+	activeSessions := func() *gorm.DB {
+		query := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID)
+		if keepSessionID != "" {
+			query = query.Where("family_id <> ?", keepSessionID)
+		}
+		return query
+	}
+
+	// 1. Remember which sessions are ending before revoking them
+	var familyIDs []string
+	if err := activeSessions().Distinct().Pluck("family_id", &familyIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	// 2. Revoke the refresh tokens
+	result := activeSessions().Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", result.Error)
+	}
+
+	// 3. Revoke the personal access tokens
+	tokens := tx.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now())
+	if tokens.Error != nil {
+		return nil, fmt.Errorf("failed to revoke access tokens: %w", tokens.Error)
+	}
+
+	// 4. Signing out everywhere - invalidate every access token issued so far
+	if keepSessionID == "" {
+		err := tx.Model(&models.User{}).Where("id = ?", userID).
+			Update("tokens_valid_after", time.Now()).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to update token cutoff: %w", err)
+		}
+	}
+
+	return &sessionRevocation{
+		userID:       userID,
+		familyIDs:    familyIDs,
+		cutoff:       keepSessionID == "",
+		revoked:      result.RowsAffected,
+		accessTokens: tokens.RowsAffected,
+	}, nil
+}
+
+// counts returns how many sessions and personal access tokens were revoked
+// Zero on nil, for transactions that ended before revoking anything
+func (r *sessionRevocation) counts() RevokedCounts {
+	if r == nil {
+		return RevokedCounts{}
+	}
+	return RevokedCounts{Sessions: r.revoked, AccessTokens: r.accessTokens}
+}
+
+// details adds the number of revoked personal access tokens to security event details
+// so the owner sees them go in their security log
+func (r *sessionRevocation) details(details map[string]string) map[string]string {
+	if r == nil || r.accessTokens == 0 {
+		return details
+	}
+	if details == nil {
+		details = map[string]string{}
+	}
+	details["access_tokens_revoked"] = fmt.Sprint(r.accessTokens)
+	return details
+}
+
+// apply rejects the access tokens of the revoked sessions right away
+// Only call once the transaction is committed: a rollback would leave valid sessions
+// denylisted, and a request reloading the cutoff before the commit would cache the old one
+// Does nothing on nil, for transactions that ended before revoking anything
+func (r *sessionRevocation) apply() error {
+	if r == nil {
+		return nil
+	}
+
+	for _, familyID := range r.familyIDs {
+		if err := revocation.RevokeSession(familyID); err != nil {
+			return fmt.Errorf("failed to revoke session access tokens: %w", err)
+		}
+	}
+
+	if r.cutoff {
+		revocation.InvalidateUser(r.userID)
+	}
+	return nil
+}
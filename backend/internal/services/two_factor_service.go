@@ -0,0 +1,368 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/db"
+	"filmfolk/internal/models"
+	"filmfolk/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// mfaChallengeTTL is how long the user has to enter their code after the password step
+	mfaChallengeTTL = 5 * time.Minute
+
+	// recoveryCodeCount is how many backup codes are issued when 2FA is enabled
+	recoveryCodeCount = 10
+)
+
+// TwoFactorService handles TOTP enrollment and the second login step
+type TwoFactorService struct {
+	cfg *config.Config
+}
+
+// NewTwoFactorService creates a new two-factor service
+func NewTwoFactorService(cfg *config.Config) *TwoFactorService {
+	return &TwoFactorService{cfg: cfg}
+}
+
+// TwoFactorSetup is returned when enrollment starts
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`      // for manual entry
+	OTPAuthURI string `json:"otpauth_uri"` // render as QR code
+}
+
+// MFAChallenge is returned by Login instead of tokens when the account has 2FA enabled
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"` // seconds until the challenge expires
+	Code        bool   `json:"code"`       // an authenticator or recovery code can answer (/auth/2fa/verify)
+	Passkey     bool   `json:"passkey"`    // a passkey can answer (/auth/webauthn/login)
+}
+
+// ConfirmTwoFactorInput represents the first code from the authenticator app
+type ConfirmTwoFactorInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DisableTwoFactorInput represents data for turning 2FA off
+// Code may be a TOTP code or a recovery code
+type DisableTwoFactorInput struct {
+	Password string `json:"password"` // required for accounts with a password
+	Code     string `json:"code" binding:"required"`
+}
+
+// VerifyMFAInput represents the second login step
+// Exactly one of Code (TOTP) or RecoveryCode must be given
+type VerifyMFAInput struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	DeviceLabel  string `json:"device_label" binding:"omitempty,max=100"`
+}
+
+// Setup generates a new TOTP secret for the user
+// 2FA is not enforced until the user confirms a code from their app
+func (s *TwoFactorService) Setup(userID uint64) (*TwoFactorSetup, error) {
+	user, err := findUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.IsTwoFactorEnabled() {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.DB.Model(user).Update("totp_secret", secret).Error; err != nil {
+		return nil, fmt.Errorf("failed to store TOTP secret: %w", err)
+	}
+
+	return &TwoFactorSetup{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPAuthURI(s.cfg.App.Name, user.Email, secret),
+	}, nil
+}
+
+// Confirm enables 2FA once the user proves their app produces valid codes
+// Returns the recovery codes - the only time they are shown
+func (s *TwoFactorService) Confirm(userID uint64, code string) ([]string, error) {
+	var codes []string
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return fmt.Errorf("user not found: %w", err)
+		}
+
+		if user.IsTwoFactorEnabled() {
+			return errors.New("two-factor authentication is already enabled")
+		}
+		if user.TOTPSecret == nil {
+			return errors.New("two-factor setup has not been started")
+		}
+
+		step, ok := utils.ValidateTOTP(*user.TOTPSecret, code, time.Now())
+		if !ok {
+			return errors.New("invalid authentication code")
+		}
+
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"two_factor_enabled_at": time.Now(),
+			"totp_last_step":        step,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to enable two-factor authentication: %w", err)
+		}
+
+		codes, err = generateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable turns the authenticator app off and deletes the recovery codes
+// Returns whether login still asks for a second factor, because the user has passkeys
+func (s *TwoFactorService) Disable(userID uint64, input DisableTwoFactorInput) (bool, error) {
+	var stillRequired bool
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return fmt.Errorf("user not found: %w", err)
+		}
+
+		if !user.IsTwoFactorEnabled() {
+			return errors.New("two-factor authentication is not enabled")
+		}
+
+		if user.PasswordHash != nil && !utils.VerifyPassword(*user.PasswordHash, input.Password) {
+			return errors.New("invalid password")
+		}
+
+		// The code field accepts either kind of code here
+		if err := checkSecondFactor(tx, &user, input.Code, input.Code); err != nil {
+			return err
+		}
+
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_secret":           nil,
+			"totp_last_step":        0,
+			"two_factor_enabled_at": nil,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+
+		user.TOTPSecret = nil
+		user.TwoFactorEnabledAt = nil
+		stillRequired, err = isMFAEnabled(tx, &user)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return stillRequired, nil
+}
+
+// VerifyLogin completes a login that was answered with an MFA challenge
+func (s *TwoFactorService) VerifyLogin(input VerifyMFAInput, device DeviceInfo) (*AuthResponse, error) {
+	if (input.Code == "") == (input.RecoveryCode == "") {
+		return nil, errors.New("provide either code or recovery_code")
+	}
+
+	userID, err := utils.ValidateMFAToken(input.MFAToken)
+	if err != nil {
+		return nil, errors.New("invalid or expired MFA token")
+	}
+
+	user, err := findUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkAccountStatus(user); err != nil {
+		return nil, err
+	}
+
+	// The account's second factor may be passkeys only
+	if !user.IsTwoFactorEnabled() {
+		return nil, errors.New("no authenticator app is set up, answer with a passkey")
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	lockout := NewLockoutService(s.cfg)
+	if err := lockout.CheckLoginAllowed(user); err != nil {
+		return nil, err
+	}
+
+	if err := checkSecondFactor(db.DB, user, input.Code, input.RecoveryCode); err != nil {
+		lockout.RecordFailure(user)
+		recordLoginFailure(user.ID, device, map[string]string{"reason": "wrong_second_factor"})
+		return nil, err
+	}
+
+	// Login is complete only now
+	lockout.RecordSuccess(user)
+	now := time.Now()
+	user.LastLoginAt = &now
+	db.DB.Model(user).Update("last_login_at", now)
+
+	method := "totp"
+	if input.RecoveryCode != "" {
+		method = "recovery_code"
+	}
+	recordUserEvent(models.EventLogin, user.ID, device, map[string]string{"method": "password", "second_factor": method})
+	NewKnownDeviceService(s.cfg).noteLogin(user, device)
+	NewVerificationService(s.cfg).remindUnverified(user)
+
+	device.Label = input.DeviceLabel
+	return NewAuthService(s.cfg).generateAuthResponse(user, device)
+}
+
+// newChallenge creates the MFA challenge returned after a correct password
+func (s *TwoFactorService) newChallenge(user *models.User) (*MFAChallenge, error) {
+	token, err := utils.GenerateMFAToken(user.ID, mfaChallengeTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate MFA token: %w", err)
+	}
+
+	passkeys, err := countPasskeys(db.DB, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFAChallenge{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int(mfaChallengeTTL.Seconds()),
+		Code:        user.IsTwoFactorEnabled(),
+		Passkey:     passkeys > 0,
+	}, nil
+}
+
+// isMFAEnabled checks if the user has to give a second factor to sign in,
+// with the authenticator app or one of their passkeys
+func isMFAEnabled(tx *gorm.DB, user *models.User) (bool, error) {
+	if user.IsTwoFactorEnabled() {
+		return true, nil
+	}
+
+	passkeys, err := countPasskeys(tx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	return user.IsMFAEnabled(passkeys), nil
+}
+
+// countPasskeys returns how many passkeys the user has registered
+func countPasskeys(tx *gorm.DB, userID uint64) (int64, error) {
+	var passkeys int64
+	if err := tx.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&passkeys).Error; err != nil {
+		return 0, fmt.Errorf("database error: %w", err)
+	}
+	return passkeys, nil
+}
+
+// checkSecondFactor accepts a fresh TOTP code or consumes an unused recovery code
+// Both updates are conditional, so a code can't be accepted twice even under concurrency
+func checkSecondFactor(tx *gorm.DB, user *models.User, code, recoveryCode string) error {
+	if code != "" {
+		if step, ok := utils.ValidateTOTP(*user.TOTPSecret, code, time.Now()); ok {
+			result := tx.Model(&models.User{}).
+				Where("id = ? AND totp_last_step < ?", user.ID, step).
+				Update("totp_last_step", step)
+			if result.Error != nil {
+				return fmt.Errorf("database error: %w", result.Error)
+			}
+			if result.RowsAffected == 1 {
+				return nil
+			}
+		}
+	}
+
+	if recoveryCode != "" {
+		result := tx.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashToken(normalizeRecoveryCode(recoveryCode))).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return fmt.Errorf("database error: %w", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			return nil
+		}
+	}
+
+	return errors.New("invalid authentication code")
+}
+
+// generateRecoveryCodes replaces the user's recovery codes with a fresh set
+func generateRecoveryCodes(tx *gorm.DB, userID uint64) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+
+		// 10 base32 characters = 50 bits, displayed as xxxxx-xxxxx
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		rows = append(rows, models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(raw),
+		})
+	}
+
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode strips formatting so "ABCDE-FGHIJ" and "abcdefghij" match
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// findUserByID loads a user or returns a "user not found" error
+func findUserByID(userID uint64) (*models.User, error) {
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &user, nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/db"
+	"filmfolk/internal/mailer"
+	"filmfolk/internal/models"
+	"filmfolk/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// verificationResendCooldown is how long after a verification email another one may be sent
+// Keeps the resend endpoint from being used to flood an address
+const verificationResendCooldown = 5 * time.Minute
+
+// VerificationService handles email address verification
+type VerificationService struct {
+	cfg *config.Config
+}
+
+// NewVerificationService creates a new verification service
+func NewVerificationService(cfg *config.Config) *VerificationService {
+	return &VerificationService{cfg: cfg}
+}
+
+// SendVerificationEmail issues a fresh verification token and mails the link
+// Earlier unused tokens for the user are invalidated
+func (s *VerificationService) SendVerificationEmail(user *models.User) error {
+	ttl := time.Duration(s.cfg.Auth.VerificationTokenTTL) * time.Hour
+	token, err := issueVerificationToken(db.DB, user.ID, models.PurposeEmailVerification, ttl)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", s.cfg.App.FrontendURL, token)
+	return mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your FilmFolk email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your email address by opening this link:\n\n%s\n\n"+
+				"The link expires in %d hours. If you didn't create a FilmFolk account, ignore this email.\n",
+			user.Username, link, s.cfg.Auth.VerificationTokenTTL,
+		),
+	})
+}
+
+// VerifyEmail marks the token owner's email as verified
+// Access tokens pick up the new state on next refresh
+func (s *VerificationService) VerifyEmail(tokenString string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeVerificationToken(tx, tokenString, models.PurposeEmailVerification)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&models.User{}).
+			Where("id = ? AND email_verified_at IS NULL", token.UserID).
+			Update("email_verified_at", time.Now()).Error
+		if err != nil {
+			return fmt.Errorf("failed to verify email: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// ResendVerification mails a new verification link, at most once per verificationResendCooldown
+// Silently does nothing for unknown or already verified addresses to avoid user enumeration
+func (s *VerificationService) ResendVerification(email string) error {
+	var user models.User
+	err := db.DB.Where("email = ?", email).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	if user.IsEmailVerified() || user.IsGuest() {
+		return nil
+	}
+
+	// Quietly skip while the last email is recent; an error would reveal the account
+	var latest models.VerificationToken
+	err = db.DB.Where("user_id = ? AND purpose = ?", user.ID, models.PurposeEmailVerification).
+		Order("created_at DESC").
+		First(&latest).Error
+	if err == nil && time.Since(latest.CreatedAt) < verificationResendCooldown {
+		return nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	return s.SendVerificationEmail(&user)
+}
+
+// remindUnverified mails a verification link when an unverified user logs in
+// and no unused link is out, e.g. accounts created before verification existed
+// Best effort: failures are logged but never fail the login
+func (s *VerificationService) remindUnverified(user *models.User) {
+	if user.IsEmailVerified() || user.IsGuest() {
+		return
+	}
+
+	var pending int64
+	err := db.DB.Model(&models.VerificationToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", user.ID, models.PurposeEmailVerification, time.Now()).
+		Count(&pending).Error
+	if err == nil && pending > 0 {
+		return
+	}
+	if err == nil {
+		err = s.SendVerificationEmail(user)
+	}
+	if err != nil {
+		utils.GetLogger().Error().Err(err).Uint64("user_id", user.ID).Msg("Failed to send verification reminder")
+	}
+}
+
+// issueVerificationToken creates a single-use token for the given purpose
+// Any earlier unused token of the same purpose is invalidated, so only the latest email works
+func issueVerificationToken(tx *gorm.DB, userID uint64, purpose models.TokenPurpose, ttl time.Duration) (string, error) {
+	tokenString, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	err = tx.Model(&models.VerificationToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", now).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to invalidate old tokens: %w", err)
+	}
+
+	token := models.VerificationToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: utils.HashToken(tokenString),
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := tx.Create(&token).Error; err != nil {
+		return "", fmt.Errorf("failed to store token: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+// consumeVerificationToken looks up a token by digest and marks it used
+// Must run inside a transaction; the row lock stops the same token being used twice
+func consumeVerificationToken(tx *gorm.DB, tokenString string, purpose models.TokenPurpose) (*models.VerificationToken, error) {
+	var token models.VerificationToken
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? AND purpose = ?", utils.HashToken(tokenString), purpose).
+		First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("invalid or expired token")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if !token.IsValid() {
+		return nil, errors.New("invalid or expired token")
+	}
+
+	now := time.Now()
+	if err := tx.Model(&token).Update("used_at", now).Error; err != nil {
+		return nil, fmt.Errorf("failed to use token: %w", err)
+	}
+
+	return &token, nil
+}
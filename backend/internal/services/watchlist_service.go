@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"filmfolk/internal/db"
+	"filmfolk/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WatchlistService struct{}
+
+func NewWatchlistService() *WatchlistService {
+	return &WatchlistService{}
+}
+
+// GetWatchlist returns a user's watchlist, most recently added first
+func (s *WatchlistService) GetWatchlist(userID uint64) ([]models.WatchlistItem, error) {
+	var items []models.WatchlistItem
+	err := db.DB.Preload("Movie").
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&items).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get watchlist: %w", err)
+	}
+
+	return items, nil
+}
+
+// AddToWatchlist adds a movie to a user's watchlist
+// Adding a movie that's already on the list is not an error
+func (s *WatchlistService) AddToWatchlist(userID, movieID uint64) error {
+	// Verify movie exists
+	var movie models.Movie
+	if err := db.DB.First(&movie, movieID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("movie not found")
+		}
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	item := models.WatchlistItem{
+		UserID:  userID,
+		MovieID: movieID,
+	}
+
+	err := db.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&item).Error
+	if err != nil {
+		return fmt.Errorf("failed to add to watchlist: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveFromWatchlist removes a movie from a user's watchlist
+func (s *WatchlistService) RemoveFromWatchlist(userID, movieID uint64) error {
+	result := db.DB.Where("user_id = ? AND movie_id = ?", userID, movieID).Delete(&models.WatchlistItem{})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove from watchlist: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("movie not in watchlist")
+	}
+
+	return nil
+}
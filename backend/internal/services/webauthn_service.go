@@ -0,0 +1,586 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/db"
+	"filmfolk/internal/models"
+	"filmfolk/internal/utils"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// webauthnCeremonyTTL is how long the browser has to answer a passkey prompt
+	webauthnCeremonyTTL = 5 * time.Minute
+
+	// webauthnUserHandleSize is the length of the random WebAuthn user.id (at most 64)
+	webauthnUserHandleSize = 32
+)
+
+// WebAuthnService handles passkey registration and sign-in
+// A passkey signs in on its own (the authenticator verifies the user with a PIN or
+// biometric) or answers the 2FA challenge after a password login
+type WebAuthnService struct {
+	cfg *config.Config
+}
+
+// NewWebAuthnService creates a new WebAuthn service
+func NewWebAuthnService(cfg *config.Config) *WebAuthnService {
+	return &WebAuthnService{cfg: cfg}
+}
+
+// RegisterPasskeyInput represents the browser's answer to a registration ceremony
+// Credential is the PublicKeyCredential from navigator.credentials.create, as JSON
+type RegisterPasskeyInput struct {
+	Name       string          `json:"name" binding:"max=100"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+// BeginPasskeyLoginInput starts a passkey sign-in
+// With an MFA token the passkey answers that 2FA challenge; without one it's a passwordless login
+type BeginPasskeyLoginInput struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+// FinishPasskeyLoginInput represents the browser's answer to a sign-in ceremony
+// Credential is the PublicKeyCredential from navigator.credentials.get, as JSON
+type FinishPasskeyLoginInput struct {
+	MFAToken    string          `json:"mfa_token"` // same as in the begin request
+	Credential  json.RawMessage `json:"credential" binding:"required"`
+	DeviceLabel string          `json:"device_label" binding:"omitempty,max=100"`
+}
+
+// passkeyUser adapts a user and their passkeys to the webauthn library
+type passkeyUser struct {
+	user        *models.User
+	credentials []models.WebAuthnCredential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte          { return u.user.WebAuthnUserHandle }
+func (u *passkeyUser) WebAuthnName() string        { return u.user.Email }
+func (u *passkeyUser) WebAuthnDisplayName() string { return u.user.Username }
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, stored := range u.credentials {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(stored.Transports))
+		for _, transport := range stored.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              stored.CredentialID,
+			PublicKey:       stored.PublicKey,
+			AttestationType: stored.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: stored.BackupEligible,
+				BackupState:    stored.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    stored.AAGUID,
+				SignCount: stored.SignCount,
+			},
+		})
+	}
+	return credentials
+}
+
+// storedCredential returns the passkey with the given credential ID
+func (u *passkeyUser) storedCredential(credentialID []byte) *models.WebAuthnCredential {
+	for i := range u.credentials {
+		if string(u.credentials[i].CredentialID) == string(credentialID) {
+			return &u.credentials[i]
+		}
+	}
+	return nil
+}
+
+// newStoredCredential converts a verified new credential to the row that is stored
+func newStoredCredential(userID uint64, name string, credential *webauthn.Credential) models.WebAuthnCredential {
+	if name == "" {
+		name = "Passkey"
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	return models.WebAuthnCredential{
+		UserID:          userID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Name:            name,
+	}
+}
+
+// BeginRegistration starts adding a passkey to the user's account
+// The returned options go to navigator.credentials.create
+func (s *WebAuthnService) BeginRegistration(userID uint64) (*protocol.CredentialCreation, error) {
+	rp, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Find user and give them a user handle on their first passkey
+	user, err := findUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsGuest() {
+		return nil, errors.New("guest accounts cannot register passkeys, upgrade first")
+	}
+	if err := ensureWebAuthnUserHandle(user); err != nil {
+		return nil, err
+	}
+
+	pkUser, err := loadPasskeyUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Ask for a discoverable credential, so it can sign in without an email,
+	// and leave out authenticators that already hold one of the user's passkeys
+	creation, session, err := rp.BeginRegistration(pkUser,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(pkUser.WebAuthnCredentials()).CredentialDescriptors()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start passkey registration: %w", err)
+	}
+
+	// 3. Keep the challenge until the browser answers
+	if err := startCeremony(models.CeremonyRegister, &user.ID, session); err != nil {
+		return nil, err
+	}
+
+	return creation, nil
+}
+
+// FinishRegistration verifies the new passkey and stores it
+func (s *WebAuthnService) FinishRegistration(userID uint64, input RegisterPasskeyInput, device DeviceInfo) (*models.WebAuthnCredential, error) {
+	rp, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Parse the answer and find the ceremony it belongs to
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(input.Credential)
+	if err != nil {
+		return nil, errors.New("invalid passkey response")
+	}
+
+	session, ceremony, err := consumeCeremony(models.CeremonyRegister, parsed.Response.CollectedClientData.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	if *ceremony.UserID != userID {
+		return nil, errors.New("invalid or expired passkey challenge")
+	}
+
+	// 2. Verify attestation, origin and challenge
+	user, err := findUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	pkUser, err := loadPasskeyUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := rp.CreateCredential(pkUser, *session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("passkey verification failed: %w", err)
+	}
+
+	// 3. Store the public key
+	var existing int64
+	if err := db.DB.Model(&models.WebAuthnCredential{}).Where("credential_id = ?", credential.ID).Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if existing > 0 {
+		return nil, errors.New("this passkey is already registered")
+	}
+
+	stored := newStoredCredential(user.ID, strings.TrimSpace(input.Name), credential)
+	if err := db.DB.Create(&stored).Error; err != nil {
+		return nil, fmt.Errorf("failed to store passkey: %w", err)
+	}
+
+	recordUserEvent(models.EventPasskeyRegistered, user.ID, device, map[string]string{"passkey_id": fmt.Sprint(stored.ID), "name": stored.Name})
+	return &stored, nil
+}
+
+// BeginLogin starts a passkey sign-in
+// The returned options go to navigator.credentials.get
+func (s *WebAuthnService) BeginLogin(input BeginPasskeyLoginInput) (*protocol.CredentialAssertion, error) {
+	rp, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	// Passwordless: any of the user's passkeys, and the authenticator must verify the user
+	if input.MFAToken == "" {
+		assertion, session, err := rp.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+		if err != nil {
+			return nil, fmt.Errorf("failed to start passkey login: %w", err)
+		}
+		if err := startCeremony(models.CeremonyLogin, nil, session); err != nil {
+			return nil, err
+		}
+		return assertion, nil
+	}
+
+	// Second factor: the password was already checked, so one of this user's passkeys
+	// being present is enough
+	user, pkUser, err := secondFactorPasskeyUser(input.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+
+	assertion, session, err := rp.BeginLogin(pkUser, webauthn.WithUserVerification(protocol.VerificationPreferred))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start passkey login: %w", err)
+	}
+	if err := startCeremony(models.CeremonySecondFactor, &user.ID, session); err != nil {
+		return nil, err
+	}
+
+	return assertion, nil
+}
+
+// FinishLogin verifies the passkey assertion and issues tokens
+func (s *WebAuthnService) FinishLogin(input FinishPasskeyLoginInput, device DeviceInfo) (*AuthResponse, error) {
+	rp, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Parse the answer and find the ceremony it belongs to
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(input.Credential)
+	if err != nil {
+		return nil, errors.New("invalid passkey response")
+	}
+
+	purpose := models.CeremonyLogin
+	if input.MFAToken != "" {
+		purpose = models.CeremonySecondFactor
+	}
+
+	session, ceremony, err := consumeCeremony(purpose, parsed.Response.CollectedClientData.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Verify the signature against the stored public key
+	var user *models.User
+	var pkUser *passkeyUser
+	var credential *webauthn.Credential
+	var lockout *LockoutService
+
+	if purpose == models.CeremonyLogin {
+		// The user is whoever the passkey's user handle belongs to
+		handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+			var found models.User
+			if err := db.DB.Where("webauthn_user_handle = ?", userHandle).First(&found).Error; err != nil {
+				return nil, errors.New("unknown passkey")
+			}
+			user = &found
+
+			pkUser, err = loadPasskeyUser(user)
+			if err != nil {
+				return nil, err
+			}
+			return pkUser, nil
+		}
+
+		_, credential, err = rp.ValidatePasskeyLogin(handler, *session, parsed)
+		if err != nil {
+			var userID uint64
+			if user != nil {
+				userID = user.ID
+			}
+			recordLoginFailure(userID, device, map[string]string{"reason": "passkey_invalid"})
+			return nil, errors.New("passkey verification failed")
+		}
+	} else {
+		user, pkUser, err = secondFactorPasskeyUser(input.MFAToken)
+		if err != nil {
+			return nil, err
+		}
+		if *ceremony.UserID != user.ID {
+			return nil, errors.New("invalid or expired passkey challenge")
+		}
+
+		// Failures count towards the same lockout as wrong passwords and codes
+		lockout = NewLockoutService(s.cfg)
+		if err := lockout.CheckLoginAllowed(user); err != nil {
+			return nil, err
+		}
+
+		credential, err = rp.ValidateLogin(pkUser, *session, parsed)
+		if err != nil {
+			lockout.RecordFailure(user)
+			recordLoginFailure(user.ID, device, map[string]string{"reason": "wrong_second_factor"})
+			return nil, errors.New("passkey verification failed")
+		}
+	}
+
+	// 3. Refuse a counter that didn't go up, the passkey may have been copied
+	stored := pkUser.storedCredential(credential.ID)
+	if stored == nil {
+		return nil, errors.New("passkey verification failed")
+	}
+	if err := updatePasskeyUse(stored, credential); err != nil {
+		recordLoginFailure(user.ID, device, map[string]string{"reason": "passkey_sign_count", "passkey_id": fmt.Sprint(stored.ID)})
+		return nil, err
+	}
+
+	// 4. Check if account is active
+	if err := checkAccountStatus(user); err != nil {
+		recordLoginFailure(user.ID, device, map[string]string{"reason": "account_" + string(user.Status)})
+		return nil, err
+	}
+
+	// 5. Update last login time
+	details := map[string]string{"method": "passkey", "passkey_id": fmt.Sprint(stored.ID)}
+	if lockout != nil {
+		lockout.RecordSuccess(user)
+		details = map[string]string{"method": "password", "second_factor": "passkey", "passkey_id": fmt.Sprint(stored.ID)}
+	}
+	now := time.Now()
+	user.LastLoginAt = &now
+	db.DB.Model(user).Update("last_login_at", now)
+	recordUserEvent(models.EventLogin, user.ID, device, details)
+	NewKnownDeviceService(s.cfg).noteLogin(user, device)
+
+	// 6. Generate tokens
+	device.Label = input.DeviceLabel
+	return NewAuthService(s.cfg).generateAuthResponse(user, device)
+}
+
+// ListCredentials returns the user's passkeys
+func (s *WebAuthnService) ListCredentials(userID uint64) ([]models.WebAuthnCredential, error) {
+	var credentials []models.WebAuthnCredential
+	err := db.DB.Where("user_id = ?", userID).Order("created_at").Find(&credentials).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+	return credentials, nil
+}
+
+// DeleteCredential removes one of the user's passkeys
+// Refuses to remove the last way to sign in
+func (s *WebAuthnService) DeleteCredential(userID, credentialID uint64, device DeviceInfo) error {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. Lock the user so concurrent removals can't both pass the check below
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("user not found")
+			}
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		// 2. Find the passkey
+		var credential models.WebAuthnCredential
+		if err := tx.Where("id = ? AND user_id = ?", credentialID, userID).First(&credential).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("passkey not found")
+			}
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		// 3. Count the remaining login methods
+		remaining, err := countLoginMethods(tx, &user)
+		if err != nil {
+			return err
+		}
+		if remaining <= 1 {
+			return errors.New("cannot remove your only login method, set a password first (via forgot password)")
+		}
+
+		// 4. Remove
+		if err := tx.Delete(&credential).Error; err != nil {
+			return fmt.Errorf("failed to remove passkey: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	recordUserEvent(models.EventPasskeyRemoved, userID, device, map[string]string{"passkey_id": fmt.Sprint(credentialID)})
+	return nil
+}
+
+// relyingParty builds the webauthn library instance from the WEBAUTHN_* settings
+func (s *WebAuthnService) relyingParty() (*webauthn.WebAuthn, error) {
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: webauthnCeremonyTTL, TimeoutUVD: webauthnCeremonyTTL}
+
+	rp, err := webauthn.New(&webauthn.Config{
+		RPID:          s.cfg.WebAuthn.RPID,
+		RPDisplayName: s.cfg.WebAuthn.RPName,
+		RPOrigins:     s.cfg.WebAuthn.RPOrigins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			UserVerification:   protocol.VerificationRequired,
+		},
+		Timeouts: webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("passkeys are not configured correctly: %w", err)
+	}
+	return rp, nil
+}
+
+// secondFactorPasskeyUser returns the user of an MFA challenge, if they can answer it with a passkey
+func secondFactorPasskeyUser(mfaToken string) (*models.User, *passkeyUser, error) {
+	userID, err := utils.ValidateMFAToken(mfaToken)
+	if err != nil {
+		return nil, nil, errors.New("invalid or expired MFA token")
+	}
+
+	user, err := findUserByID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pkUser, err := loadPasskeyUser(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !user.IsMFAEnabled(int64(len(pkUser.credentials))) {
+		return nil, nil, errors.New("two-factor authentication is not enabled")
+	}
+	if len(pkUser.credentials) == 0 {
+		return nil, nil, errors.New("no passkeys registered")
+	}
+
+	return user, pkUser, nil
+}
+
+// loadPasskeyUser loads the user's passkeys
+func loadPasskeyUser(user *models.User) (*passkeyUser, error) {
+	var credentials []models.WebAuthnCredential
+	if err := db.DB.Where("user_id = ?", user.ID).Find(&credentials).Error; err != nil {
+		return nil, fmt.Errorf("failed to load passkeys: %w", err)
+	}
+	return &passkeyUser{user: user, credentials: credentials}, nil
+}
+
+// ensureWebAuthnUserHandle gives the user a random WebAuthn user handle if they have none
+// Conditional, so two first registrations at once end up with the same handle
+func ensureWebAuthnUserHandle(user *models.User) error {
+	if len(user.WebAuthnUserHandle) > 0 {
+		return nil
+	}
+
+	handle := make([]byte, webauthnUserHandleSize)
+	if _, err := rand.Read(handle); err != nil {
+		return fmt.Errorf("failed to generate user handle: %w", err)
+	}
+
+	err := db.DB.Model(&models.User{}).
+		Where("id = ? AND webauthn_user_handle IS NULL", user.ID).
+		Update("webauthn_user_handle", handle).Error
+	if err != nil {
+		return fmt.Errorf("failed to store user handle: %w", err)
+	}
+
+	return db.DB.Select("webauthn_user_handle").First(user, user.ID).Error
+}
+
+// updatePasskeyUse stores the new signature counter and last use of a passkey
+// The update only applies if the counter went up (or the authenticator doesn't keep one),
+// so a cloned passkey or a replay racing the original is refused too
+func updatePasskeyUse(stored *models.WebAuthnCredential, credential *webauthn.Credential) error {
+	if credential.Authenticator.CloneWarning {
+		return errors.New("passkey signature counter did not increase, it may have been cloned")
+	}
+
+	signCount := credential.Authenticator.SignCount
+	result := db.DB.Model(&models.WebAuthnCredential{}).
+		Where("id = ? AND (sign_count < ? OR (sign_count = 0 AND ? = 0))", stored.ID, signCount, signCount).
+		Updates(map[string]interface{}{
+			"sign_count":   signCount,
+			"backup_state": credential.Flags.BackupState,
+			"last_used_at": time.Now(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("database error: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("passkey signature counter did not increase, it may have been cloned")
+	}
+	return nil
+}
+
+// startCeremony stores the session data of a ceremony until the browser answers
+func startCeremony(purpose models.WebAuthnCeremonyPurpose, userID *uint64, session *webauthn.SessionData) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to encode passkey challenge: %w", err)
+	}
+
+	// Drop abandoned ceremonies while we're here
+	now := time.Now()
+	db.DB.Where("expires_at < ?", now).Delete(&models.WebAuthnCeremony{})
+
+	ceremony := models.WebAuthnCeremony{
+		ChallengeHash: utils.HashToken(session.Challenge),
+		Purpose:       purpose,
+		UserID:        userID,
+		SessionData:   data,
+		ExpiresAt:     now.Add(webauthnCeremonyTTL),
+	}
+	if err := db.DB.Create(&ceremony).Error; err != nil {
+		return fmt.Errorf("failed to store passkey challenge: %w", err)
+	}
+	return nil
+}
+
+// consumeCeremony finds the ceremony for challenge and deletes it, so each challenge works once
+func consumeCeremony(purpose models.WebAuthnCeremonyPurpose, challenge string) (*webauthn.SessionData, *models.WebAuthnCeremony, error) {
+	if challenge == "" {
+		return nil, nil, errors.New("invalid or expired passkey challenge")
+	}
+
+	var ceremony models.WebAuthnCeremony
+	result := db.DB.Clauses(clause.Returning{}).
+		Where("challenge_hash = ?", utils.HashToken(challenge)).
+		Delete(&ceremony)
+	if result.Error != nil {
+		return nil, nil, fmt.Errorf("database error: %w", result.Error)
+	}
+
+	// A challenge from another kind of ceremony is as good as none
+	if result.RowsAffected == 0 || ceremony.Purpose != purpose || ceremony.IsExpired() {
+		return nil, nil, errors.New("invalid or expired passkey challenge")
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(ceremony.SessionData, &session); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode passkey challenge: %w", err)
+	}
+
+	return &session, &ceremony, nil
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"filmfolk/internal/config"
+	"filmfolk/internal/models"
+	"filmfolk/internal/services/webauthntest"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const testOrigin = "https://filmfolk.test"
+
+// testRelyingParty builds the relying party the service uses, for a test frontend
+func testRelyingParty(t *testing.T) *webauthn.WebAuthn {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.WebAuthn.RPID = "filmfolk.test"
+	cfg.WebAuthn.RPName = "FilmFolk"
+	cfg.WebAuthn.RPOrigins = []string{testOrigin}
+
+	rp, err := NewWebAuthnService(cfg).relyingParty()
+	if err != nil {
+		t.Fatalf("relyingParty() error = %v", err)
+	}
+	return rp
+}
+
+// registerPasskey runs a registration ceremony and keeps the credential as it would be stored
+func registerPasskey(t *testing.T, rp *webauthn.WebAuthn, auth *webauthntest.Authenticator, pkUser *passkeyUser) *models.WebAuthnCredential {
+	t.Helper()
+
+	creation, session, err := rp.BeginRegistration(pkUser,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(pkUser.WebAuthnCredentials()).CredentialDescriptors()),
+	)
+	if err != nil {
+		t.Fatalf("BeginRegistration() error = %v", err)
+	}
+
+	response, err := auth.Register(creation)
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		t.Fatalf("ParseCredentialCreationResponseBytes() error = %v", err)
+	}
+
+	credential, err := rp.CreateCredential(pkUser, *session, parsed)
+	if err != nil {
+		t.Fatalf("CreateCredential() error = %v", err)
+	}
+
+	pkUser.credentials = append(pkUser.credentials, newStoredCredential(pkUser.user.ID, "", credential))
+	return &pkUser.credentials[len(pkUser.credentials)-1]
+}
+
+// passwordlessLogin signs in with a discoverable passkey, like FinishLogin without an MFA token
+func passwordlessLogin(rp *webauthn.WebAuthn, auth *webauthntest.Authenticator, pkUser *passkeyUser) (*webauthn.Credential, error) {
+	assertion, session, err := rp.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := assert(auth, assertion)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		if !bytes.Equal(userHandle, pkUser.WebAuthnID()) {
+			return nil, errors.New("unknown passkey")
+		}
+		return pkUser, nil
+	}
+	_, credential, err := rp.ValidatePasskeyLogin(handler, *session, parsed)
+	return credential, err
+}
+
+// secondFactorLogin answers an MFA challenge with a passkey, like FinishLogin with an MFA token
+func secondFactorLogin(rp *webauthn.WebAuthn, auth *webauthntest.Authenticator, pkUser *passkeyUser) (*webauthn.Credential, error) {
+	assertion, session, err := rp.BeginLogin(pkUser, webauthn.WithUserVerification(protocol.VerificationPreferred))
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := assert(auth, assertion)
+	if err != nil {
+		return nil, err
+	}
+
+	return rp.ValidateLogin(pkUser, *session, parsed)
+}
+
+func assert(auth *webauthntest.Authenticator, assertion *protocol.CredentialAssertion) (*protocol.ParsedCredentialAssertionData, error) {
+	response, err := auth.Assert(assertion)
+	if err != nil {
+		return nil, err
+	}
+	return protocol.ParseCredentialRequestResponseBytes(response)
+}
+
+func newPasskeyUser(id uint64, handle string) *passkeyUser {
+	return &passkeyUser{user: &models.User{
+		ID:                 id,
+		Username:           "jane",
+		Email:              "jane@example.com",
+		WebAuthnUserHandle: []byte(handle),
+	}}
+}
+
+func TestPasskeyRegistration(t *testing.T) {
+	rp := testRelyingParty(t)
+	auth := webauthntest.NewAuthenticator(testOrigin)
+	pkUser := newPasskeyUser(1, "handle-jane")
+
+	stored := registerPasskey(t, rp, auth, pkUser)
+
+	if !bytes.Equal(stored.CredentialID, auth.CredentialID()) {
+		t.Errorf("CredentialID = %x, want %x", stored.CredentialID, auth.CredentialID())
+	}
+	if stored.UserID != 1 || stored.Name != "Passkey" || len(stored.PublicKey) == 0 {
+		t.Errorf("stored credential = %+v, want user 1, the default name and a public key", stored)
+	}
+	if len(stored.Transports) != 1 || stored.Transports[0] != "internal" {
+		t.Errorf("Transports = %v, want [internal]", stored.Transports)
+	}
+}
+
+func TestPasskeyRegistrationRejectsWrongOrigin(t *testing.T) {
+	rp := testRelyingParty(t)
+	auth := webauthntest.NewAuthenticator("https://attacker.example.com")
+	pkUser := newPasskeyUser(1, "handle-jane")
+
+	creation, session, err := rp.BeginRegistration(pkUser)
+	if err != nil {
+		t.Fatalf("BeginRegistration() error = %v", err)
+	}
+	response, err := auth.Register(creation)
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		t.Fatalf("ParseCredentialCreationResponseBytes() error = %v", err)
+	}
+
+	if _, err := rp.CreateCredential(pkUser, *session, parsed); err == nil {
+		t.Error("CreateCredential() accepted a credential created for another origin")
+	}
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	rp := testRelyingParty(t)
+	auth := webauthntest.NewAuthenticator(testOrigin)
+	pkUser := newPasskeyUser(1, "handle-jane")
+	registerPasskey(t, rp, auth, pkUser)
+
+	credential, err := passwordlessLogin(rp, auth, pkUser)
+	if err != nil {
+		t.Fatalf("passwordless login error = %v", err)
+	}
+
+	stored := pkUser.storedCredential(credential.ID)
+	if stored == nil {
+		t.Fatal("storedCredential() found no passkey for the credential that signed in")
+	}
+	if credential.Authenticator.CloneWarning || credential.Authenticator.SignCount != 1 {
+		t.Errorf("Authenticator = %+v, want sign count 1 and no clone warning", credential.Authenticator)
+	}
+}
+
+func TestPasskeyLoginRequiresUserVerification(t *testing.T) {
+	rp := testRelyingParty(t)
+	auth := webauthntest.NewAuthenticator(testOrigin)
+	pkUser := newPasskeyUser(1, "handle-jane")
+	registerPasskey(t, rp, auth, pkUser)
+
+	// Without a PIN or biometric, the passkey alone isn't enough to sign in
+	auth.UserVerified = false
+	if _, err := passwordlessLogin(rp, auth, pkUser); err == nil {
+		t.Error("passwordless login accepted an assertion without user verification")
+	}
+}
+
+func TestPasskeyLoginRefusesSignCountRegression(t *testing.T) {
+	rp := testRelyingParty(t)
+	auth := webauthntest.NewAuthenticator(testOrigin)
+	pkUser := newPasskeyUser(1, "handle-jane")
+	stored := registerPasskey(t, rp, auth, pkUser)
+
+	credential, err := passwordlessLogin(rp, auth, pkUser)
+	if err != nil {
+		t.Fatalf("passwordless login error = %v", err)
+	}
+	stored.SignCount = credential.Authenticator.SignCount // what updatePasskeyUse stores
+
+	// A copy of the passkey answers with the counter it had before
+	auth.SignCount = 0
+	credential, err = passwordlessLogin(rp, auth, pkUser)
+	if err != nil {
+		t.Fatalf("passwordless login error = %v", err)
+	}
+	if !credential.Authenticator.CloneWarning {
+		t.Fatal("CloneWarning not set for a counter that didn't go up")
+	}
+	if err := updatePasskeyUse(stored, credential); err == nil {
+		t.Error("updatePasskeyUse() accepted a counter that didn't go up")
+	}
+}
+
+func TestPasskeySecondFactor(t *testing.T) {
+	rp := testRelyingParty(t)
+	auth := webauthntest.NewAuthenticator(testOrigin)
+	pkUser := newPasskeyUser(1, "handle-jane")
+	registerPasskey(t, rp, auth, pkUser)
+
+	// A passkey counts as a second factor even without an authenticator app
+	if !pkUser.user.IsMFAEnabled(int64(len(pkUser.credentials))) {
+		t.Error("IsMFAEnabled() = false for a user with a passkey")
+	}
+
+	// The password was checked already, so presence is enough
+	auth.UserVerified = false
+	if _, err := secondFactorLogin(rp, auth, pkUser); err != nil {
+		t.Fatalf("second factor login error = %v", err)
+	}
+}
+
+func TestPasskeySecondFactorRejectsOtherUsersPasskey(t *testing.T) {
+	rp := testRelyingParty(t)
+	pkUser := newPasskeyUser(1, "handle-jane")
+	registerPasskey(t, rp, webauthntest.NewAuthenticator(testOrigin), pkUser)
+
+	other := webauthntest.NewAuthenticator(testOrigin)
+	registerPasskey(t, rp, other, newPasskeyUser(2, "handle-john"))
+
+	if _, err := secondFactorLogin(rp, other, pkUser); err == nil {
+		t.Error("second factor login accepted another user's passkey")
+	}
+}
+
+func TestIsMFAEnabled(t *testing.T) {
+	secret := "JBSWY3DPEHPK3PXP"
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		user     models.User
+		passkeys int64
+		want     bool
+	}{
+		{name: "nothing", want: false},
+		{name: "authenticator app", user: models.User{TOTPSecret: &secret, TwoFactorEnabledAt: &now}, want: true},
+		{name: "unconfirmed authenticator app", user: models.User{TOTPSecret: &secret}, want: false},
+		{name: "passkey", passkeys: 1, want: true},
+		{name: "both", user: models.User{TOTPSecret: &secret, TwoFactorEnabledAt: &now}, passkeys: 2, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.user.IsMFAEnabled(tt.passkeys); got != tt.want {
+				t.Errorf("IsMFAEnabled(%d) = %v, want %v", tt.passkeys, got, tt.want)
+			}
+		})
+	}
+}
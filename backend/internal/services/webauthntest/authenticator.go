@@ -0,0 +1,215 @@
+// Package webauthntest is a software passkey authenticator for tests
+//
+//	auth := webauthntest.NewAuthenticator("https://filmfolk.com")
+//	credentialJSON, err := auth.Register(creation) // options from BeginRegistration
+//	assertionJSON, err := auth.Assert(assertion)   // options from BeginLogin
+//
+// It holds one ES256 key, answers with "none" attestation and signs like a platform
+// authenticator would. The output is the PublicKeyCredential JSON a browser sends.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+// Authenticator data flags (WebAuthn §6.1)
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// Authenticator is a software passkey holding a single credential
+type Authenticator struct {
+	// Origin is put in the client data, as the browser would
+	Origin string
+
+	// UserVerified sets the UV flag, as if the user entered a PIN or used a biometric
+	// Off, the authenticator only reports that a user was present
+	UserVerified bool
+
+	// SignCount is the signature counter; Assert increments it before signing
+	// Set it back to answer like a cloned authenticator
+	SignCount uint32
+
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+}
+
+// NewAuthenticator creates an authenticator with a fresh key that verifies the user
+func NewAuthenticator(origin string) *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic("webauthntest: " + err.Error())
+	}
+
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		panic("webauthntest: " + err.Error())
+	}
+
+	return &Authenticator{
+		Origin:       origin,
+		UserVerified: true,
+		key:          key,
+		credentialID: credentialID,
+	}
+}
+
+// CredentialID returns the ID of the authenticator's credential
+func (a *Authenticator) CredentialID() []byte {
+	return a.credentialID
+}
+
+// Register answers navigator.credentials.create with a new credential
+// Returns the PublicKeyCredential as JSON
+func (a *Authenticator) Register(creation *protocol.CredentialCreation) ([]byte, error) {
+	// Read the options the way the browser gets them
+	var options struct {
+		Challenge protocol.URLEncodedBase64 `json:"challenge"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		User struct {
+			ID protocol.URLEncodedBase64 `json:"id"`
+		} `json:"user"`
+	}
+	if err := roundTrip(creation.Response, &options); err != nil {
+		return nil, err
+	}
+	a.userHandle = options.User.ID
+
+	clientData, err := a.clientData(protocol.CreateCeremony, options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("webauthntest: encode public key: %w", err)
+	}
+
+	// Attested credential data: AAGUID (zero), credential ID length, ID, COSE key
+	attested := make([]byte, 16, 16+2+len(a.credentialID)+len(publicKey))
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, publicKey...)
+
+	authData := append(a.authData(options.RP.ID, flagAttestedData), attested...)
+	attestationObject, err := webauthncbor.Marshal(struct {
+		Format       string         `cbor:"fmt"`
+		AttStatement map[string]any `cbor:"attStmt"`
+		AuthData     []byte         `cbor:"authData"`
+	}{Format: "none", AttStatement: map[string]any{}, AuthData: authData})
+	if err != nil {
+		return nil, fmt.Errorf("webauthntest: encode attestation: %w", err)
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    protocol.URLEncodedBase64(a.credentialID),
+		"rawId": protocol.URLEncodedBase64(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    protocol.URLEncodedBase64(clientData),
+			"attestationObject": protocol.URLEncodedBase64(attestationObject),
+			"transports":        []string{"internal"},
+		},
+	})
+}
+
+// Assert answers navigator.credentials.get by signing the challenge
+// Returns the PublicKeyCredential as JSON
+func (a *Authenticator) Assert(assertion *protocol.CredentialAssertion) ([]byte, error) {
+	if a.userHandle == nil {
+		return nil, errors.New("webauthntest: authenticator has no credential, register first")
+	}
+
+	var options struct {
+		Challenge protocol.URLEncodedBase64 `json:"challenge"`
+		RPID      string                    `json:"rpId"`
+	}
+	if err := roundTrip(assertion.Response, &options); err != nil {
+		return nil, err
+	}
+
+	clientData, err := a.clientData(protocol.AssertCeremony, options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	a.SignCount++
+	authData := a.authData(options.RPID, 0)
+
+	// The signature covers the authenticator data and the hash of the client data
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("webauthntest: sign assertion: %w", err)
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    protocol.URLEncodedBase64(a.credentialID),
+		"rawId": protocol.URLEncodedBase64(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    protocol.URLEncodedBase64(clientData),
+			"authenticatorData": protocol.URLEncodedBase64(authData),
+			"signature":         protocol.URLEncodedBase64(signature),
+			"userHandle":        protocol.URLEncodedBase64(a.userHandle),
+		},
+	})
+}
+
+// clientData builds the clientDataJSON the browser would send
+func (a *Authenticator) clientData(ceremony protocol.CeremonyType, challenge []byte) ([]byte, error) {
+	return json.Marshal(protocol.CollectedClientData{
+		Type:      ceremony,
+		Challenge: protocol.URLEncodedBase64(challenge).String(),
+		Origin:    a.Origin,
+	})
+}
+
+// authData builds the authenticator data: RP ID hash, flags and signature counter
+func (a *Authenticator) authData(rpID string, flags byte) []byte {
+	flags |= flagUserPresent
+	if a.UserVerified {
+		flags |= flagUserVerified
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.SignCount)
+}
+
+// roundTrip decodes options from their JSON form
+func roundTrip(options, out any) error {
+	raw, err := json.Marshal(options)
+	if err != nil {
+		return fmt.Errorf("webauthntest: encode options: %w", err)
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("webauthntest: decode options: %w", err)
+	}
+	return nil
+}
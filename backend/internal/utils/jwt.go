@@ -8,6 +8,7 @@ import (
 	"filmfolk/internal/models"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 // Custom JWT claims
@@ -17,31 +18,57 @@ type JWTClaims struct {
 	UserID   uint64 `json:"user_id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
+	Role     string `json:"role"`
+	// SessionID is the refresh token family this access token was issued for
+	// Lets handlers tell which session is "current"
+	SessionID string `json:"sid,omitempty"`
+	// EmailVerified lets middleware apply the unverified-account policy without a DB hit
+	EmailVerified bool `json:"email_verified"`
+	// Guest tokens are limited to the watchlist and ratings until the account is upgraded
+	Guest bool `json:"guest,omitempty"`
 	jwt.RegisteredClaims
 }
 
-var jwtSecret []byte
+var keyRing *KeyRing
 
-// InitJWT initializes the JWT secret
+// mfaAudience marks 2FA challenge tokens so they can't pass as access or refresh tokens
+const mfaAudience = "filmfolk-mfa"
+
+// InitJWT loads the signing key ring
 // Call this once at app startup
-func InitJWT(secret string) {
-	jwtSecret = []byte(secret)
+func InitJWT(opts KeyRingOptions) error {
+	ring, err := NewKeyRing(opts)
+	if err != nil {
+		return err
+	}
+	keyRing = ring
+	return nil
+}
+
+// GetKeyRing returns the key ring set up by InitJWT
+func GetKeyRing() *KeyRing {
+	return keyRing
 }
 
 // GenerateAccessToken creates a short-lived access token
 // Access tokens are used for API requests
 // They're short-lived (15 min) for security
-func GenerateAccessToken(user *models.User, ttlMinutes int) (string, error) {
-	if jwtSecret == nil {
-		return "", errors.New("JWT secret not initialized")
+func GenerateAccessToken(user *models.User, sessionID string, ttlMinutes int) (string, error) {
+	if keyRing == nil {
+		return "", errors.New("JWT keys not initialized")
 	}
 
 	// Create claims with user info and expiration
 	claims := JWTClaims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Email:    user.Email,
+		UserID:        user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		Role:          string(user.Role),
+		SessionID:     sessionID,
+		EmailVerified: user.IsEmailVerified(),
+		Guest:         user.IsGuest(),
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(), // jti - lets a single token be revoked
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(ttlMinutes) * time.Minute)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
@@ -50,11 +77,8 @@ func GenerateAccessToken(user *models.User, ttlMinutes int) (string, error) {
 		},
 	}
 
-	// Create token with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Sign token with secret
-	tokenString, err := token.SignedString(jwtSecret)
+	// Sign token with the active key (kid header tells verifiers which one)
+	tokenString, err := keyRing.Sign(claims)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -66,13 +90,16 @@ func GenerateAccessToken(user *models.User, ttlMinutes int) (string, error) {
 // Refresh tokens are used to get new access tokens
 // They're stored in the database so we can revoke them
 func GenerateRefreshToken(userID uint64, ttlDays int) (string, time.Time, error) {
-	if jwtSecret == nil {
-		return "", time.Time{}, errors.New("JWT secret not initialized")
+	if keyRing == nil {
+		return "", time.Time{}, errors.New("JWT keys not initialized")
 	}
 
 	expiresAt := time.Now().Add(time.Duration(ttlDays) * 24 * time.Hour)
 
 	claims := jwt.RegisteredClaims{
+		// Unique ID so tokens issued within the same second never collide
+		// (rotation can issue several per user in quick succession)
+		ID:        uuid.NewString(),
 		ExpiresAt: jwt.NewNumericDate(expiresAt),
 		IssuedAt:  jwt.NewNumericDate(time.Now()),
 		NotBefore: jwt.NewNumericDate(time.Now()),
@@ -80,8 +107,7 @@ func GenerateRefreshToken(userID uint64, ttlDays int) (string, time.Time, error)
 		Subject:   fmt.Sprintf("%d", userID),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecret)
+	tokenString, err := keyRing.Sign(claims)
 	if err != nil {
 		return "", time.Time{}, fmt.Errorf("failed to sign refresh token: %w", err)
 	}
@@ -92,18 +118,12 @@ func GenerateRefreshToken(userID uint64, ttlDays int) (string, time.Time, error)
 // ValidateToken verifies and parses a JWT token
 // Returns the claims if valid, error if invalid/expired
 func ValidateToken(tokenString string) (*JWTClaims, error) {
-	if jwtSecret == nil {
-		return nil, errors.New("JWT secret not initialized")
+	if keyRing == nil {
+		return nil, errors.New("JWT keys not initialized")
 	}
 
-	// Parse token
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Verify signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return jwtSecret, nil
-	})
+	// Parse token - the key ring picks the key by kid and checks the algorithm
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, keyRing.Keyfunc)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
@@ -111,7 +131,7 @@ func ValidateToken(tokenString string) (*JWTClaims, error) {
 
 	// Extract claims
 	claims, ok := token.Claims.(*JWTClaims)
-	if !ok || !token.Valid {
+	if !ok || !token.Valid || len(claims.Audience) > 0 {
 		return nil, errors.New("invalid token")
 	}
 
@@ -120,24 +140,28 @@ func ValidateToken(tokenString string) (*JWTClaims, error) {
 
 // ValidateRefreshToken validates a refresh token
 // Returns the user ID if valid
+// Refresh tokens are only good if their hash is stored in the database, so the ones
+// signed with the legacy secret before the switch to asymmetric keys stay usable
+// after the secret is gone; their claims are read without checking the signature
 func ValidateRefreshToken(tokenString string) (uint64, error) {
-	if jwtSecret == nil {
-		return 0, errors.New("JWT secret not initialized")
+	if keyRing == nil {
+		return 0, errors.New("JWT keys not initialized")
 	}
 
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, keyRing.Keyfunc)
+	if errors.Is(err, ErrLegacyToken) {
+		token, _, err = jwt.NewParser().ParseUnverified(tokenString, &jwt.RegisteredClaims{})
+		if err == nil {
+			token.Valid = isUnexpired(token.Claims)
 		}
-		return jwtSecret, nil
-	})
+	}
 
 	if err != nil {
 		return 0, fmt.Errorf("failed to parse refresh token: %w", err)
 	}
 
 	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok || !token.Valid {
+	if !ok || !token.Valid || len(claims.Audience) > 0 {
 		return 0, errors.New("invalid refresh token")
 	}
 
@@ -150,3 +174,60 @@ func ValidateRefreshToken(tokenString string) (uint64, error) {
 
 	return userID, nil
 }
+
+// isUnexpired checks the expiry of claims read without verification
+func isUnexpired(claims jwt.Claims) bool {
+	expiresAt, err := claims.GetExpirationTime()
+	return err == nil && expiresAt != nil && time.Now().Before(expiresAt.Time)
+}
+
+// GenerateMFAToken creates a short-lived challenge token for the second login step
+// It only proves the password was correct - it grants no API access by itself
+func GenerateMFAToken(userID uint64, ttl time.Duration) (string, error) {
+	if keyRing == nil {
+		return "", errors.New("JWT keys not initialized")
+	}
+
+	claims := jwt.RegisteredClaims{
+		ID:        uuid.NewString(),
+		Audience:  jwt.ClaimStrings{mfaAudience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Issuer:    "filmfolk",
+		Subject:   fmt.Sprintf("%d", userID),
+	}
+
+	tokenString, err := keyRing.Sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign MFA token: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+// ValidateMFAToken validates a 2FA challenge token
+// Returns the user ID if valid
+func ValidateMFAToken(tokenString string) (uint64, error) {
+	if keyRing == nil {
+		return 0, errors.New("JWT keys not initialized")
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, keyRing.Keyfunc, jwt.WithAudience(mfaAudience))
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse MFA token: %w", err)
+	}
+
+	claims, ok := token.Claims.(*jwt.RegisteredClaims)
+	if !ok || !token.Valid {
+		return 0, errors.New("invalid MFA token")
+	}
+
+	var userID uint64
+	_, err = fmt.Sscanf(claims.Subject, "%d", &userID)
+	if err != nil {
+		return 0, errors.New("invalid user ID in token")
+	}
+
+	return userID, nil
+}
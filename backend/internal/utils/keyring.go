@@ -0,0 +1,536 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key lifecycle:
+//  1. pending   - generated and published in the JWKS, not used for signing yet
+//     (gives other instances time to load it before tokens signed with it show up)
+//  2. active    - the newest activated key, signs new tokens
+//  3. retired   - a newer key took over; still verifies tokens until the grace period ends
+//  4. pruned    - removed from the ring and deleted from disk
+//
+// Keys are PKCS#8 PEM files named <kid>.pem in the keys directory.
+// Point every instance at the same directory so they share one key ring.
+
+const (
+	// keyPropagationDelay is how long a new key is published before it signs tokens
+	keyPropagationDelay = 2 * time.Minute
+
+	// keyReloadInterval is how often the key directory is re-read and rotation checked
+	keyReloadInterval = time.Minute
+
+	// pemActivatesAtHeader stores when a key starts signing
+	pemActivatesAtHeader = "Activates-At"
+)
+
+// KeyRingOptions configures token signing keys
+type KeyRingOptions struct {
+	Algorithm        string        // EdDSA, RS256 or HS256
+	Dir              string        // key directory (asymmetric algorithms)
+	RotationInterval time.Duration // 0 disables scheduled rotation
+	GracePeriod      time.Duration // how long a retired key still verifies tokens
+	// LegacySecret is the HS256 secret. With HS256 it signs tokens; with an asymmetric
+	// algorithm it only verifies tokens without a kid issued before the switch.
+	LegacySecret string
+	// LegacyUntil is when an asymmetric ring stops accepting tokens without a kid
+	// Zero rejects them right away
+	LegacyUntil time.Time
+}
+
+// ErrLegacyToken means a token has no kid and the legacy HS256 secret can't verify it
+// (asymmetric signing, and the secret is gone, the cutoff has passed or the token is too new)
+var ErrLegacyToken = errors.New("token without key ID is no longer accepted")
+
+// signingKey is one key of the ring
+type signingKey struct {
+	ID          string
+	Method      jwt.SigningMethod
+	Private     crypto.Signer
+	ActivatesAt time.Time
+}
+
+// KeyRing holds the signing key and every key that may still verify tokens
+type KeyRing struct {
+	opts   KeyRingOptions
+	legacy []byte
+
+	// switchedAt is when this ring started signing asymmetrically;
+	// legacy tokens issued after it were not signed by an older instance
+	switchedAt time.Time
+
+	mu   sync.RWMutex
+	keys []*signingKey // sorted by ActivatesAt, oldest first
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewKeyRing loads the key directory and makes sure there's a key to sign with
+func NewKeyRing(opts KeyRingOptions) (*KeyRing, error) {
+	r := &KeyRing{opts: opts, switchedAt: time.Now()}
+	if opts.LegacyUntil.Before(r.switchedAt) {
+		r.switchedAt = opts.LegacyUntil
+	}
+	if opts.LegacySecret != "" {
+		r.legacy = []byte(opts.LegacySecret)
+	}
+
+	switch opts.Algorithm {
+	case "HS256":
+		if r.legacy == nil {
+			return nil, errors.New("HS256 requires a JWT secret")
+		}
+		return r, nil
+	case "RS256", "EdDSA":
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm: %s", opts.Algorithm)
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	// First start (or algorithm change) - a key is needed right away
+	if r.signingKey() == nil {
+		if _, err := r.generate(time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Reload re-reads the key directory, picking up keys generated by other instances
+func (r *KeyRing) Reload() error {
+	entries, err := os.ReadDir(r.opts.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to read key directory: %w", err)
+	}
+
+	var keys []*signingKey
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".pem") {
+			continue
+		}
+
+		key, err := loadSigningKey(filepath.Join(r.opts.Dir, entry.Name()))
+		if err != nil {
+			// One bad file shouldn't take down token verification
+			GetLogger().Warn().Err(err).Str("file", entry.Name()).Msg("Skipping unreadable signing key")
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ActivatesAt.Before(keys[j].ActivatesAt)
+	})
+
+	r.mu.Lock()
+	r.keys = keys
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Rotate publishes a new key; it starts signing after the propagation delay
+func (r *KeyRing) Rotate() (string, error) {
+	key, err := r.generate(time.Now().Add(keyPropagationDelay))
+	if err != nil {
+		return "", err
+	}
+	return key.ID, nil
+}
+
+// RotateIfDue rotates when the newest key is older than the rotation interval
+func (r *KeyRing) RotateIfDue() error {
+	if r.opts.RotationInterval <= 0 {
+		return nil
+	}
+
+	r.mu.RLock()
+	var newest *signingKey
+	for _, key := range r.keys {
+		if key.Method.Alg() == r.opts.Algorithm {
+			newest = key
+		}
+	}
+	r.mu.RUnlock()
+
+	if newest != nil && time.Since(newest.ActivatesAt) < r.opts.RotationInterval {
+		return nil
+	}
+
+	kid, err := r.Rotate()
+	if err != nil {
+		return err
+	}
+
+	GetLogger().Info().Str("kid", kid).Msg("Rotated JWT signing key")
+	return nil
+}
+
+// Prune drops keys whose grace period is over
+func (r *KeyRing) Prune() error {
+	now := time.Now()
+
+	r.mu.Lock()
+	var kept, expired []*signingKey
+	for i, key := range r.keys {
+		if r.expiredAt(i).Before(now) {
+			expired = append(expired, key)
+		} else {
+			kept = append(kept, key)
+		}
+	}
+	r.keys = kept
+	r.mu.Unlock()
+
+	for _, key := range expired {
+		err := os.Remove(filepath.Join(r.opts.Dir, key.ID+".pem"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to delete expired key %s: %w", key.ID, err)
+		}
+		GetLogger().Info().Str("kid", key.ID).Msg("Removed expired JWT signing key")
+	}
+
+	return nil
+}
+
+// Run keeps the ring in sync with the key directory and rotates on schedule
+// Blocks until ctx is cancelled
+func (r *KeyRing) Run(ctx context.Context) {
+	if r.opts.Algorithm == "HS256" {
+		return
+	}
+
+	ticker := time.NewTicker(keyReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Reload first so two instances don't both rotate
+			if err := r.Reload(); err != nil {
+				GetLogger().Error().Err(err).Msg("Failed to reload JWT signing keys")
+				continue
+			}
+			if err := r.RotateIfDue(); err != nil {
+				GetLogger().Error().Err(err).Msg("Failed to rotate JWT signing key")
+			}
+			if err := r.Prune(); err != nil {
+				GetLogger().Error().Err(err).Msg("Failed to prune JWT signing keys")
+			}
+		}
+	}
+}
+
+// JWKS returns the public half of every key that may verify tokens
+func (r *KeyRing) JWKS() JWKSet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	now := time.Now()
+	for i, key := range r.keys {
+		if r.expiredAt(i).Before(now) {
+			continue
+		}
+		set.Keys = append(set.Keys, publicJWK(key))
+	}
+	return set
+}
+
+// Sign signs claims with the active key
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	if r.opts.Algorithm == "HS256" {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(r.legacy)
+	}
+
+	key := r.signingKey()
+	if key == nil {
+		return "", errors.New("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// Keyfunc picks the verification key for a token (use with jwt.Parse)
+func (r *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("token has no key ID")
+		}
+		if r.opts.Algorithm == "HS256" {
+			return r.legacy, nil
+		}
+
+		// Tokens from before the switch to asymmetric signing
+		if err := r.checkLegacy(token); err != nil {
+			return nil, err
+		}
+		return r.legacy, nil
+	}
+
+	key := r.verificationKey(kid)
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+
+	// Never let the token choose the algorithm
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.Private.Public(), nil
+}
+
+// checkLegacy decides if a token without a kid may still be verified with the legacy secret
+// Only until LegacyUntil, and only tokens issued before the switch - anything newer was
+// not signed by an instance from before it, so the secret must have leaked
+func (r *KeyRing) checkLegacy(token *jwt.Token) error {
+	if r.legacy == nil || time.Now().After(r.opts.LegacyUntil) {
+		return ErrLegacyToken
+	}
+
+	issuedAt, err := token.Claims.GetIssuedAt()
+	if err != nil || issuedAt == nil || issuedAt.After(r.switchedAt) {
+		return ErrLegacyToken
+	}
+	return nil
+}
+
+// signingKey returns the newest activated key of the configured algorithm
+func (r *KeyRing) signingKey() *signingKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	var current *signingKey
+	for _, key := range r.keys {
+		if key.Method.Alg() == r.opts.Algorithm && !key.ActivatesAt.After(now) {
+			current = key
+		}
+	}
+	return current
+}
+
+// verificationKey finds a key by ID, as long as its grace period isn't over
+// Pending keys verify too, another instance may have started signing with them already
+func (r *KeyRing) verificationKey(kid string) *signingKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i, key := range r.keys {
+		if key.ID == kid {
+			if r.expiredAt(i).Before(time.Now()) {
+				return nil
+			}
+			return key
+		}
+	}
+	return nil
+}
+
+// expiredAt returns when keys[i] stops verifying: grace period after its successor activated
+// Caller must hold r.mu
+func (r *KeyRing) expiredAt(i int) time.Time {
+	now := time.Now()
+	for _, next := range r.keys[i+1:] {
+		if !next.ActivatesAt.After(now) {
+			return next.ActivatesAt.Add(r.opts.GracePeriod)
+		}
+	}
+	// Still the newest activated key (or pending)
+	return now.Add(time.Hour)
+}
+
+// generate creates a key of the configured algorithm, writes it to disk and adds it to the ring
+func (r *KeyRing) generate(activatesAt time.Time) (*signingKey, error) {
+	var private crypto.Signer
+	var method jwt.SigningMethod
+	var err error
+
+	switch r.opts.Algorithm {
+	case "RS256":
+		method = jwt.SigningMethodRS256
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "EdDSA":
+		method = jwt.SigningMethodEdDSA
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm: %s", r.opts.Algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("failed to generate key ID: %w", err)
+	}
+
+	key := &signingKey{
+		ID:          time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix),
+		Method:      method,
+		Private:     private,
+		ActivatesAt: activatesAt,
+	}
+
+	if err := writeSigningKey(filepath.Join(r.opts.Dir, key.ID+".pem"), key); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.keys = append(r.keys, key)
+	sort.Slice(r.keys, func(i, j int) bool {
+		return r.keys[i].ActivatesAt.Before(r.keys[j].ActivatesAt)
+	})
+	r.mu.Unlock()
+
+	return key, nil
+}
+
+// writeSigningKey stores a key as PKCS#8 PEM
+// Written to a temp file and renamed so other instances never read half a key
+func writeSigningKey(path string, key *signingKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return fmt.Errorf("failed to encode signing key: %w", err)
+	}
+
+	block := &pem.Block{
+		Type:    "PRIVATE KEY",
+		Headers: map[string]string{pemActivatesAtHeader: key.ActivatesAt.UTC().Format(time.RFC3339)},
+		Bytes:   der,
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".key-*")
+	if err != nil {
+		return fmt.Errorf("failed to write signing key: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write signing key: %w", err)
+	}
+	if err := pem.Encode(tmp, block); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write signing key: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write signing key: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write signing key: %w", err)
+	}
+	return nil
+}
+
+// loadSigningKey reads a key written by writeSigningKey
+func loadSigningKey(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("not a PKCS#8 PEM private key")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{ID: strings.TrimSuffix(filepath.Base(path), ".pem")}
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private = jwt.SigningMethodRS256, private
+	case ed25519.PrivateKey:
+		key.Method, key.Private = jwt.SigningMethodEdDSA, private
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	// Keys without the header (e.g. dropped in by hand) count as active since creation
+	if activatesAt, ok := block.Headers[pemActivatesAtHeader]; ok {
+		key.ActivatesAt, err = time.Parse(time.RFC3339, activatesAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s header: %w", pemActivatesAtHeader, err)
+		}
+	} else {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		key.ActivatesAt = info.ModTime()
+	}
+
+	return key, nil
+}
+
+// publicJWK converts a key to its public JWK
+func publicJWK(key *signingKey) JWK {
+	jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+
+	switch public := key.Private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+
+	return jwk
+}
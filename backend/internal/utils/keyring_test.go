@@ -0,0 +1,237 @@
+package utils_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"filmfolk/internal/models"
+	"filmfolk/internal/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const legacySecret = "legacy-hs256-secret"
+
+// newKeyRing creates a ring with its own key directory
+func newKeyRing(t *testing.T, opts utils.KeyRingOptions) *utils.KeyRing {
+	t.Helper()
+
+	if opts.Dir == "" {
+		opts.Dir = t.TempDir()
+	}
+	ring, err := utils.NewKeyRing(opts)
+	if err != nil {
+		t.Fatalf("NewKeyRing() error = %v", err)
+	}
+	return ring
+}
+
+// signLegacy signs a token like instances did before key IDs: HS256 with the shared secret
+func signLegacy(t *testing.T, issuedAt time.Time) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   "7",
+		IssuedAt:  jwt.NewNumericDate(issuedAt),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte(legacySecret))
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+	return token
+}
+
+func parse(ring *utils.KeyRing, token string) error {
+	_, err := jwt.ParseWithClaims(token, &jwt.RegisteredClaims{}, ring.Keyfunc)
+	return err
+}
+
+func TestKeyRingSignAndVerify(t *testing.T) {
+	for _, alg := range []string{"EdDSA", "RS256"} {
+		t.Run(alg, func(t *testing.T) {
+			ring := newKeyRing(t, utils.KeyRingOptions{Algorithm: alg})
+
+			token, err := ring.Sign(jwt.RegisteredClaims{Subject: "7"})
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+
+			parsed, err := jwt.Parse(token, ring.Keyfunc)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			kid, _ := parsed.Header["kid"].(string)
+			if parsed.Method.Alg() != alg || kid == "" {
+				t.Errorf("token header = %v, want %s with a kid", parsed.Header, alg)
+			}
+
+			jwks := ring.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != kid || jwks.Keys[0].Alg != alg {
+				t.Errorf("JWKS() = %+v, want the signing key %s", jwks, kid)
+			}
+		})
+	}
+}
+
+func TestKeyRingRejects(t *testing.T) {
+	ring := newKeyRing(t, utils.KeyRingOptions{Algorithm: "EdDSA"})
+	other := newKeyRing(t, utils.KeyRingOptions{Algorithm: "EdDSA"})
+
+	signed, err := ring.Sign(jwt.RegisteredClaims{Subject: "7"})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(signed, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified() error = %v", err)
+	}
+	kid := parsed.Header["kid"].(string)
+
+	// HS256 under the kid of an EdDSA key - the token must not choose the algorithm
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "7"})
+	confused.Header["kid"] = kid
+	confusedToken, err := confused.SignedString([]byte(kid))
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+
+	foreignToken, err := other.Sign(jwt.RegisteredClaims{Subject: "7"})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "other algorithm for the kid", token: confusedToken},
+		{name: "unknown kid", token: foreignToken},
+		{name: "no kid, asymmetric", token: withoutKid(t, other)},
+		{name: "tampered signature", token: signed[:len(signed)-4] + "AAAA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := parse(ring, tt.token); err == nil {
+				t.Error("Keyfunc accepted the token")
+			}
+		})
+	}
+}
+
+// withoutKid returns a token of ring with the kid header removed
+func withoutKid(t *testing.T, ring *utils.KeyRing) string {
+	t.Helper()
+
+	token, err := ring.Sign(jwt.RegisteredClaims{Subject: "7"})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified() error = %v", err)
+	}
+	delete(parsed.Header, "kid")
+
+	signingString, err := parsed.SigningString()
+	if err != nil {
+		t.Fatalf("SigningString() error = %v", err)
+	}
+	// The signature doesn't matter, the missing kid is refused first
+	return signingString + ".c2lnbmF0dXJl"
+}
+
+func TestKeyRingLegacyTokens(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		opts     utils.KeyRingOptions
+		issuedAt time.Time
+		wantErr  error // nil: accepted
+	}{
+		{
+			name:     "HS256 ring",
+			opts:     utils.KeyRingOptions{Algorithm: "HS256", LegacySecret: legacySecret},
+			issuedAt: now,
+		},
+		{
+			name:     "issued before the switch, within the cutoff",
+			opts:     utils.KeyRingOptions{Algorithm: "EdDSA", LegacySecret: legacySecret, LegacyUntil: now.Add(time.Hour)},
+			issuedAt: now.Add(-time.Minute),
+		},
+		{
+			name:     "issued after the switch",
+			opts:     utils.KeyRingOptions{Algorithm: "EdDSA", LegacySecret: legacySecret, LegacyUntil: now.Add(time.Hour)},
+			issuedAt: now.Add(time.Minute),
+			wantErr:  utils.ErrLegacyToken,
+		},
+		{
+			name:     "cutoff passed",
+			opts:     utils.KeyRingOptions{Algorithm: "EdDSA", LegacySecret: legacySecret, LegacyUntil: now.Add(-time.Minute)},
+			issuedAt: now.Add(-time.Hour),
+			wantErr:  utils.ErrLegacyToken,
+		},
+		{
+			name:     "no cutoff",
+			opts:     utils.KeyRingOptions{Algorithm: "EdDSA", LegacySecret: legacySecret},
+			issuedAt: now.Add(-time.Hour),
+			wantErr:  utils.ErrLegacyToken,
+		},
+		{
+			name:     "secret removed",
+			opts:     utils.KeyRingOptions{Algorithm: "EdDSA", LegacyUntil: now.Add(time.Hour)},
+			issuedAt: now.Add(-time.Minute),
+			wantErr:  utils.ErrLegacyToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring := newKeyRing(t, tt.opts)
+			err := parse(ring, signLegacy(t, tt.issuedAt))
+
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Keyfunc error = %v, want the token accepted", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Keyfunc error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLegacyTokensAfterCutoff(t *testing.T) {
+	err := utils.InitJWT(utils.KeyRingOptions{
+		Algorithm:    "EdDSA",
+		Dir:          t.TempDir(),
+		LegacySecret: legacySecret,
+		LegacyUntil:  time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("InitJWT() error = %v", err)
+	}
+	legacy := signLegacy(t, time.Now().Add(-time.Hour))
+
+	// Access tokens from before the switch are refused once the cutoff passed
+	if _, err := utils.ValidateToken(legacy); !errors.Is(err, utils.ErrLegacyToken) {
+		t.Errorf("ValidateToken() error = %v, want %v", err, utils.ErrLegacyToken)
+	}
+
+	// Refresh tokens still work, the database decides if they're valid
+	userID, err := utils.ValidateRefreshToken(legacy)
+	if err != nil || userID != 7 {
+		t.Errorf("ValidateRefreshToken() = %d, %v, want user 7", userID, err)
+	}
+
+	// New tokens carry a kid and verify normally
+	access, err := utils.GenerateAccessToken(&models.User{ID: 7, Username: "jane"}, "session", 15)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error = %v", err)
+	}
+	claims, err := utils.ValidateToken(access)
+	if err != nil || claims.UserID != 7 {
+		t.Errorf("ValidateToken() = %+v, %v, want user 7", claims, err)
+	}
+}
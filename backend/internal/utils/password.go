@@ -1,25 +1,105 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword hashes a plain text password using bcrypt
-// Bcrypt is slow ON PURPOSE - makes brute force attacks impractical
-// Cost of 12 means ~250ms to hash (perfect balance)
+// Stored hashes say how they were made, so several formats can live side by side:
+//   - bcrypt:   $2a$<cost>$<salt+hash>                      (the original format)
+//   - argon2id: $argon2id$v=19$m=<KiB>,t=<passes>,p=<lanes>$<salt>$<hash>  (PHC string format)
+//
+// New hashes use the configured algorithm and parameters. PasswordNeedsRehash reports
+// hashes made any other way, so they can be upgraded on the next successful login.
+
+// Password hash algorithms
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// PasswordHashOptions configures how new passwords are hashed
+type PasswordHashOptions struct {
+	Algorithm string // argon2id or bcrypt
+
+	// Bcrypt cost: 10 = fast (testing), 12 = recommended, 14 = paranoid
+	BcryptCost int
+
+	// Argon2id parameters (RFC 9106)
+	Argon2Memory      uint32 // KiB
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+}
+
+var (
+	hashOptionsMu sync.RWMutex
+	// Until InitPasswordHashing is called, hash like we always did
+	hashOptions = PasswordHashOptions{Algorithm: HashBcrypt, BcryptCost: 12}
+)
+
+// InitPasswordHashing sets the algorithm and parameters for new password hashes
+// Call this once at app startup
+func InitPasswordHashing(opts PasswordHashOptions) error {
+	switch opts.Algorithm {
+	case HashBcrypt:
+		if opts.BcryptCost < bcrypt.MinCost || opts.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case HashArgon2id:
+		if opts.Argon2Iterations < 1 || opts.Argon2Parallelism < 1 {
+			return errors.New("argon2id iterations and parallelism must be at least 1")
+		}
+		if opts.Argon2Memory < 8*uint32(opts.Argon2Parallelism) {
+			return errors.New("argon2id memory must be at least 8 KiB per lane")
+		}
+	default:
+		return fmt.Errorf("unsupported password hash algorithm: %s", opts.Algorithm)
+	}
+
+	hashOptionsMu.Lock()
+	defer hashOptionsMu.Unlock()
+	hashOptions = opts
+	return nil
+}
+
+// PasswordHashAlgorithm returns the algorithm used for new hashes
+func PasswordHashAlgorithm() string {
+	return currentHashOptions().Algorithm
+}
+
+func currentHashOptions() PasswordHashOptions {
+	hashOptionsMu.RLock()
+	defer hashOptionsMu.RUnlock()
+	return hashOptions
+}
+
+// HashPassword hashes a plain text password with the configured algorithm
+// Both algorithms are slow ON PURPOSE - makes brute force attacks impractical
+// Both add a random salt, so even the same password produces different hashes!
 func HashPassword(password string) (string, error) {
 	if password == "" {
 		return "", errors.New("password cannot be empty")
 	}
 
-	// Bcrypt cost: 10 = fast (testing), 12 = recommended, 14 = paranoid
-	const cost = 12
+	opts := currentHashOptions()
+	if opts.Algorithm == HashArgon2id {
+		return hashArgon2id(password, opts)
+	}
 
-	// bcrypt automatically adds salt, so each hash is unique
-	// Even same password produces different hashes!
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), opts.BcryptCost)
 	if err != nil {
 		return "", err
 	}
@@ -27,9 +107,113 @@ func HashPassword(password string) (string, error) {
 	return string(hashedBytes), nil
 }
 
-// VerifyPassword checks if a password matches its hash
+// VerifyPassword checks if a password matches its hash, whatever format the hash is in
 // Constant-time comparison prevents timing attacks
 func VerifyPassword(hashedPassword, password string) bool {
+	if strings.HasPrefix(hashedPassword, "$"+HashArgon2id+"$") {
+		params, salt, key, err := decodeArgon2id(hashedPassword)
+		if err != nil {
+			return false
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(computed, key) == 1
+	}
+
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	return err == nil
 }
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// VerifyDummyPassword does the work of VerifyPassword without an account to check against
+// Lets a login for an unknown email take as long as one with a wrong password
+func VerifyDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("dummy password, never matches")
+	})
+	VerifyPassword(dummyHash, password)
+}
+
+// PasswordNeedsRehash reports whether a hash was made with another algorithm or other
+// parameters than are configured now
+// Only meaningful right after VerifyPassword succeeded - that's when the password is at hand
+func PasswordNeedsRehash(hashedPassword string) bool {
+	opts := currentHashOptions()
+
+	if opts.Algorithm == HashArgon2id {
+		params, _, key, err := decodeArgon2id(hashedPassword)
+		if err != nil {
+			return true
+		}
+		return params.memory != opts.Argon2Memory ||
+			params.iterations != opts.Argon2Iterations ||
+			params.parallelism != opts.Argon2Parallelism ||
+			len(key) != argon2KeyLength
+	}
+
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	if err != nil {
+		return true
+	}
+	return cost != opts.BcryptCost
+}
+
+// argon2Params are the parameters encoded in an argon2id hash
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func hashArgon2id(password string, opts PasswordHashOptions) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, opts.Argon2Iterations, opts.Argon2Memory, opts.Argon2Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		HashArgon2id, argon2.Version,
+		opts.Argon2Memory, opts.Argon2Iterations, opts.Argon2Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// decodeArgon2id parses a PHC-format argon2id hash
+func decodeArgon2id(encoded string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2 version")
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+	if params.iterations < 1 || params.parallelism < 1 {
+		return params, nil, nil, errors.New("invalid argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,178 @@
+package utils_test
+
+import (
+	"strings"
+	"testing"
+
+	"filmfolk/internal/utils"
+)
+
+// Cheap parameters, the tests check formats and not strength
+var (
+	testBcrypt   = utils.PasswordHashOptions{Algorithm: utils.HashBcrypt, BcryptCost: 4}
+	testArgon2id = utils.PasswordHashOptions{Algorithm: utils.HashArgon2id, Argon2Memory: 64, Argon2Iterations: 1, Argon2Parallelism: 1}
+)
+
+// useHashOptions configures password hashing for one test, then puts the default back
+func useHashOptions(t *testing.T, opts utils.PasswordHashOptions) {
+	t.Helper()
+
+	if err := utils.InitPasswordHashing(opts); err != nil {
+		t.Fatalf("InitPasswordHashing(%+v) error = %v", opts, err)
+	}
+	t.Cleanup(func() {
+		utils.InitPasswordHashing(utils.PasswordHashOptions{Algorithm: utils.HashBcrypt, BcryptCost: 12})
+	})
+}
+
+// hashWith hashes a password with the given options
+func hashWith(t *testing.T, opts utils.PasswordHashOptions, password string) string {
+	t.Helper()
+
+	useHashOptions(t, opts)
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	return hash
+}
+
+func TestHashPassword(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   utils.PasswordHashOptions
+		prefix string
+	}{
+		{name: "bcrypt", opts: testBcrypt, prefix: "$2a$04$"},
+		{name: "argon2id", opts: testArgon2id, prefix: "$argon2id$v=19$m=64,t=1,p=1$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash := hashWith(t, tt.opts, "correct horse battery staple")
+			if !strings.HasPrefix(hash, tt.prefix) {
+				t.Errorf("HashPassword() = %q, want prefix %q", hash, tt.prefix)
+			}
+
+			if !utils.VerifyPassword(hash, "correct horse battery staple") {
+				t.Error("VerifyPassword() = false for the right password")
+			}
+			if utils.VerifyPassword(hash, "correct horse battery stapler") {
+				t.Error("VerifyPassword() = true for a wrong password")
+			}
+
+			// Salted: the same password never hashes the same twice
+			again, err := utils.HashPassword("correct horse battery staple")
+			if err != nil {
+				t.Fatalf("HashPassword() error = %v", err)
+			}
+			if again == hash {
+				t.Error("HashPassword() returned the same hash twice")
+			}
+
+			if _, err := utils.HashPassword(""); err == nil {
+				t.Error("HashPassword(\"\") accepted an empty password")
+			}
+		})
+	}
+}
+
+func TestVerifyPasswordAcrossAlgorithms(t *testing.T) {
+	bcryptHash := hashWith(t, testBcrypt, "secret-password")
+	argonHash := hashWith(t, testArgon2id, "secret-password")
+
+	// Whatever is configured now, hashes of either format keep working
+	for _, opts := range []utils.PasswordHashOptions{testBcrypt, testArgon2id} {
+		useHashOptions(t, opts)
+		if !utils.VerifyPassword(bcryptHash, "secret-password") || !utils.VerifyPassword(argonHash, "secret-password") {
+			t.Errorf("VerifyPassword() failed with %s configured", opts.Algorithm)
+		}
+	}
+}
+
+func TestVerifyPasswordMalformedHash(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "empty", hash: ""},
+		{name: "plain text", hash: "secret-password"},
+		{name: "argon2id missing parts", hash: "$argon2id$v=19$m=64,t=1,p=1$c2FsdA"},
+		{name: "argon2id other version", hash: "$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHRzYWx0$aGFzaA"},
+		{name: "argon2id zero passes", hash: "$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHRzYWx0$aGFzaA"},
+		{name: "argon2id bad salt", hash: "$argon2id$v=19$m=64,t=1,p=1$!!!$aGFzaA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if utils.VerifyPassword(tt.hash, "secret-password") {
+				t.Errorf("VerifyPassword(%q) = true, want false", tt.hash)
+			}
+		})
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	bcryptHash := hashWith(t, testBcrypt, "secret-password")
+	argonHash := hashWith(t, testArgon2id, "secret-password")
+
+	strongerBcrypt := testBcrypt
+	strongerBcrypt.BcryptCost = 5
+	moreMemory := testArgon2id
+	moreMemory.Argon2Memory = 128
+	morePasses := testArgon2id
+	morePasses.Argon2Iterations = 2
+	moreLanes := testArgon2id
+	moreLanes.Argon2Parallelism = 2
+
+	tests := []struct {
+		name string
+		opts utils.PasswordHashOptions
+		hash string
+		want bool
+	}{
+		{name: "bcrypt, same cost", opts: testBcrypt, hash: bcryptHash, want: false},
+		{name: "bcrypt, cost raised", opts: strongerBcrypt, hash: bcryptHash, want: true},
+		{name: "argon2id, same parameters", opts: testArgon2id, hash: argonHash, want: false},
+		{name: "argon2id, memory raised", opts: moreMemory, hash: argonHash, want: true},
+		{name: "argon2id, passes raised", opts: morePasses, hash: argonHash, want: true},
+		{name: "argon2id, lanes raised", opts: moreLanes, hash: argonHash, want: true},
+		{name: "bcrypt hash, argon2id configured", opts: testArgon2id, hash: bcryptHash, want: true},
+		{name: "argon2id hash, bcrypt configured", opts: testBcrypt, hash: argonHash, want: true},
+		{name: "unreadable hash", opts: testBcrypt, hash: "garbage", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useHashOptions(t, tt.opts)
+			if got := utils.PasswordNeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("PasswordNeedsRehash(%q) = %v, want %v", tt.hash, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitPasswordHashingRejectsBadOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts utils.PasswordHashOptions
+	}{
+		{name: "unknown algorithm", opts: utils.PasswordHashOptions{Algorithm: "md5"}},
+		{name: "bcrypt cost too low", opts: utils.PasswordHashOptions{Algorithm: utils.HashBcrypt, BcryptCost: 3}},
+		{name: "bcrypt cost too high", opts: utils.PasswordHashOptions{Algorithm: utils.HashBcrypt, BcryptCost: 32}},
+		{name: "argon2id no passes", opts: utils.PasswordHashOptions{Algorithm: utils.HashArgon2id, Argon2Memory: 64, Argon2Parallelism: 1}},
+		{name: "argon2id no lanes", opts: utils.PasswordHashOptions{Algorithm: utils.HashArgon2id, Argon2Memory: 64, Argon2Iterations: 1}},
+		{name: "argon2id too little memory", opts: utils.PasswordHashOptions{Algorithm: utils.HashArgon2id, Argon2Memory: 15, Argon2Iterations: 1, Argon2Parallelism: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := utils.InitPasswordHashing(tt.opts); err == nil {
+				t.Errorf("InitPasswordHashing(%+v) accepted invalid options", tt.opts)
+			}
+			if got := utils.PasswordHashAlgorithm(); got != utils.HashBcrypt {
+				t.Errorf("PasswordHashAlgorithm() = %q after a rejected change, want the default", got)
+			}
+		})
+	}
+}
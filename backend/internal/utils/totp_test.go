@@ -0,0 +1,113 @@
+package utils_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"filmfolk/internal/utils"
+)
+
+// rfcSecret is the RFC 6238 SHA-1 test key "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPVectors(t *testing.T) {
+	// RFC 6238 Appendix B, SHA-1 - the last 6 of the 8 digits, as apps show them
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+		{unix: 20000000000, code: "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			step, ok := utils.ValidateTOTP(rfcSecret, tt.code, time.Unix(tt.unix, 0))
+			if !ok {
+				t.Fatalf("ValidateTOTP(%q) at %d = false, want true", tt.code, tt.unix)
+			}
+			if want := tt.unix / 30; step != want {
+				t.Errorf("ValidateTOTP(%q) step = %d, want %d", tt.code, step, want)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	// "050471" is the code of step 37037037 (1111111110 - 1111111139)
+	const code = "050471"
+	const step = 37037037
+
+	tests := []struct {
+		name   string
+		offset int64 // seconds from the start of the code's step
+		want   bool
+	}{
+		{name: "same step", offset: 0, want: true},
+		{name: "end of step", offset: 29, want: true},
+		{name: "one step late", offset: 30, want: true},
+		{name: "one step early", offset: -30, want: true},
+		{name: "two steps late", offset: 60, want: false},
+		{name: "two steps early", offset: -31, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := time.Unix(step*30+tt.offset, 0)
+			matched, ok := utils.ValidateTOTP(rfcSecret, code, at)
+			if ok != tt.want {
+				t.Fatalf("ValidateTOTP() at %+ds = %v, want %v", tt.offset, ok, tt.want)
+			}
+			// The step of the code itself, not of the clock, so replays are caught
+			if ok && matched != step {
+				t.Errorf("ValidateTOTP() step = %d, want %d", matched, step)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		want   bool
+	}{
+		{name: "surrounding spaces", secret: rfcSecret, code: " 050471\n", want: true},
+		{name: "lowercase secret", secret: strings.ToLower(rfcSecret), code: "050471", want: true},
+		{name: "wrong code", secret: rfcSecret, code: "050472", want: false},
+		{name: "8 digits", secret: rfcSecret, code: "14050471", want: false},
+		{name: "empty", secret: rfcSecret, code: "", want: false},
+		{name: "invalid secret", secret: "not base32!", code: "050471", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := utils.ValidateTOTP(tt.secret, tt.code, at); ok != tt.want {
+				t.Errorf("ValidateTOTP(%q, %q) = %v, want %v", tt.secret, tt.code, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("GenerateTOTPSecret() = %q, want 160 bits in 32 base32 characters", secret)
+	}
+
+	uri := utils.TOTPAuthURI("FilmFolk", "jane@example.com", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/FilmFolk:jane@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("TOTPAuthURI() = %q, want the label and secret", uri)
+	}
+}
@@ -0,0 +1,18 @@
+-- Add Role-Based Access Control
+-- Every user gets a role; moderators and admins unlock catalog and moderation endpoints
+
+-- ============================================================================
+-- ENUMS
+-- ============================================================================
+
+CREATE TYPE user_role AS ENUM ('user', 'moderator', 'admin');
+
+-- ============================================================================
+-- ADD ROLE TO USERS TABLE
+-- ============================================================================
+
+ALTER TABLE users ADD COLUMN role user_role NOT NULL DEFAULT 'user';
+
+CREATE INDEX idx_users_role ON users(role);
+
+COMMENT ON COLUMN users.role IS 'Access level: user, moderator or admin. Embedded in access tokens, picked up on next refresh';
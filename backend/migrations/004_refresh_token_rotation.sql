@@ -0,0 +1,21 @@
+-- Refresh Token Rotation
+-- Every refresh revokes the presented token and issues a child in the same family.
+-- Presenting an already-rotated token again revokes the whole family (reuse detection).
+
+-- ============================================================================
+-- ADD FAMILY / LINEAGE COLUMNS TO REFRESH TOKENS
+-- ============================================================================
+
+ALTER TABLE refresh_tokens ADD COLUMN family_id UUID;
+ALTER TABLE refresh_tokens ADD COLUMN parent_id BIGINT REFERENCES refresh_tokens(id) ON DELETE SET NULL;
+ALTER TABLE refresh_tokens ADD COLUMN replaced_by_id BIGINT REFERENCES refresh_tokens(id) ON DELETE SET NULL;
+
+-- Existing tokens each start their own family
+UPDATE refresh_tokens SET family_id = gen_random_uuid() WHERE family_id IS NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+
+COMMENT ON COLUMN refresh_tokens.family_id IS 'Shared by all tokens descended from one login';
+COMMENT ON COLUMN refresh_tokens.parent_id IS 'Token that was rotated to produce this one';
+COMMENT ON COLUMN refresh_tokens.replaced_by_id IS 'Set when this token was rotated; presenting it again means reuse';
@@ -0,0 +1,24 @@
+-- Store Refresh Tokens Hashed
+-- Only a SHA-256 digest of each refresh token is persisted, so a database leak
+-- no longer hands out usable tokens. Existing rows are converted in place:
+-- clients keep their current refresh token and nobody is logged out.
+
+-- ============================================================================
+-- ADD DIGEST COLUMN AND CONVERT EXISTING TOKENS
+-- ============================================================================
+
+ALTER TABLE refresh_tokens ADD COLUMN token_hash CHAR(64);
+
+UPDATE refresh_tokens SET token_hash = encode(sha256(convert_to(token, 'UTF8')), 'hex');
+
+ALTER TABLE refresh_tokens ALTER COLUMN token_hash SET NOT NULL;
+ALTER TABLE refresh_tokens ADD CONSTRAINT unique_refresh_token_hash UNIQUE(token_hash);
+
+-- ============================================================================
+-- DROP PLAINTEXT TOKENS
+-- ============================================================================
+
+DROP INDEX IF EXISTS idx_refresh_tokens_token;
+ALTER TABLE refresh_tokens DROP COLUMN token;
+
+COMMENT ON COLUMN refresh_tokens.token_hash IS 'Hex SHA-256 of the refresh token; the token itself is never stored';
@@ -0,0 +1,26 @@
+-- Session Metadata
+-- Device info on refresh tokens so users can see and revoke where they are logged in.
+-- A session is one refresh token family; label and start time survive rotation.
+
+-- ============================================================================
+-- ADD DEVICE METADATA TO REFRESH TOKENS
+-- ============================================================================
+
+ALTER TABLE refresh_tokens ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN ip_address VARCHAR(45) NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN label VARCHAR(100);
+ALTER TABLE refresh_tokens ADD COLUMN session_started_at TIMESTAMPTZ;
+ALTER TABLE refresh_tokens ADD COLUMN last_used_at TIMESTAMPTZ;
+
+-- Existing tokens: best guess is the time they were issued
+UPDATE refresh_tokens SET session_started_at = created_at, last_used_at = created_at;
+
+ALTER TABLE refresh_tokens ALTER COLUMN session_started_at SET NOT NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN session_started_at SET DEFAULT NOW();
+ALTER TABLE refresh_tokens ALTER COLUMN last_used_at SET NOT NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN last_used_at SET DEFAULT NOW();
+
+CREATE INDEX idx_refresh_tokens_user_active ON refresh_tokens(user_id, last_used_at DESC) WHERE revoked_at IS NULL;
+
+COMMENT ON COLUMN refresh_tokens.label IS 'User-chosen session name, e.g. "Work laptop"';
+COMMENT ON COLUMN refresh_tokens.session_started_at IS 'Login time of the session (family), carried over on rotation';
@@ -0,0 +1,35 @@
+-- Email Verification
+-- New email accounts must confirm their address; unverified access is limited by config.
+
+-- ============================================================================
+-- ADD VERIFICATION STATE TO USERS TABLE
+-- ============================================================================
+
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+-- Google only created accounts for addresses it had verified. Email accounts were never
+-- checked and stay unverified: they are asked to confirm on their next login
+UPDATE users SET email_verified_at = created_at
+WHERE auth_provider = 'google' AND provider_id IS NOT NULL;
+
+COMMENT ON COLUMN users.email_verified_at IS 'NULL until the address is confirmed';
+
+-- ============================================================================
+-- VERIFICATION TOKENS (single-use secrets sent by email)
+-- ============================================================================
+
+CREATE TABLE verification_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(50) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_verification_tokens_user_purpose ON verification_tokens(user_id, purpose);
+CREATE INDEX idx_verification_tokens_expires_at ON verification_tokens(expires_at);
+
+COMMENT ON TABLE verification_tokens IS 'Single-use emailed tokens, stored as SHA-256 digests';
+COMMENT ON COLUMN verification_tokens.purpose IS 'What the token proves, e.g. email_verification';
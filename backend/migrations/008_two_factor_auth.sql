@@ -0,0 +1,31 @@
+-- Two-Factor Authentication (TOTP)
+-- Authenticator-app codes as a second login step, plus one-time recovery codes.
+
+-- ============================================================================
+-- ADD TOTP STATE TO USERS TABLE
+-- ============================================================================
+
+ALTER TABLE users ADD COLUMN totp_secret VARCHAR(64);
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN two_factor_enabled_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN users.totp_secret IS 'Base32 TOTP secret; pending until two_factor_enabled_at is set';
+COMMENT ON COLUMN users.totp_last_step IS 'Last accepted TOTP time step, prevents replaying a code';
+
+-- ============================================================================
+-- RECOVERY CODES
+-- ============================================================================
+
+CREATE TABLE recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT unique_recovery_code UNIQUE(user_id, code_hash)
+);
+
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes(user_id);
+
+COMMENT ON TABLE recovery_codes IS 'One-time 2FA backup codes, stored as SHA-256 digests';
@@ -0,0 +1,14 @@
+-- Per-Account Brute-Force Protection
+-- Failed logins are counted per account; attempts are slowed down progressively
+-- and the account is locked for a while after too many failures.
+
+-- ============================================================================
+-- ADD FAILED LOGIN TRACKING TO USERS TABLE
+-- ============================================================================
+
+ALTER TABLE users ADD COLUMN failed_login_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN last_failed_login_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN locked_until TIMESTAMPTZ;
+
+COMMENT ON COLUMN users.failed_login_count IS 'Consecutive failed logins, reset on success or lockout';
+COMMENT ON COLUMN users.locked_until IS 'Logins refused until this time; cleared early via emailed unlock link';
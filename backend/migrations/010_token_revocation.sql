@@ -0,0 +1,30 @@
+-- Access Token Revocation
+-- Access tokens issued before users.tokens_valid_after are rejected by the API,
+-- so banning a user or signing them out everywhere takes effect immediately.
+
+-- ============================================================================
+-- ADD TOKEN CUTOFF TO USERS TABLE
+-- ============================================================================
+
+ALTER TABLE users ADD COLUMN tokens_valid_after TIMESTAMPTZ;
+
+COMMENT ON COLUMN users.tokens_valid_after IS 'Access tokens issued before this time are invalid';
+
+-- ============================================================================
+-- BUMP CUTOFF ON STATUS CHANGE
+-- ============================================================================
+
+-- Done in the database so every code path (and manual SQL) that suspends
+-- or bans a user also kills their outstanding access tokens
+CREATE OR REPLACE FUNCTION bump_tokens_valid_after_on_status_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.status IS DISTINCT FROM OLD.status THEN
+        NEW.tokens_valid_after = NOW();
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE 'plpgsql';
+
+CREATE TRIGGER bump_tokens_valid_after_on_status_change BEFORE UPDATE OF status ON users
+    FOR EACH ROW EXECUTE FUNCTION bump_tokens_valid_after_on_status_change();
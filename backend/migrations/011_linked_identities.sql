@@ -0,0 +1,36 @@
+-- Linked Identities
+-- A user can sign in with a password and/or any number of external providers.
+-- users.auth_provider/provider_id only record how the account was created.
+
+-- ============================================================================
+-- USER IDENTITIES TABLE
+-- ============================================================================
+
+CREATE TABLE user_identities (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    provider_user_id VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ,
+
+    -- An external account belongs to one user; one account per provider per user
+    CONSTRAINT unique_provider_identity UNIQUE(provider, provider_user_id),
+    CONSTRAINT unique_user_provider UNIQUE(user_id, provider)
+);
+
+CREATE INDEX idx_user_identities_user ON user_identities(user_id);
+
+COMMENT ON TABLE user_identities IS 'External login methods (OAuth accounts) linked to users';
+COMMENT ON COLUMN user_identities.provider_user_id IS 'Subject ID at the provider, e.g. Google account ID';
+
+-- ============================================================================
+-- BACKFILL EXISTING OAUTH USERS
+-- ============================================================================
+
+INSERT INTO user_identities (user_id, provider, provider_user_id, email, created_at)
+SELECT id, auth_provider::text, provider_id, email, created_at
+FROM users
+WHERE auth_provider <> 'email' AND provider_id IS NOT NULL;
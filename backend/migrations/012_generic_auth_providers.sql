@@ -0,0 +1,15 @@
+-- Generic Login Providers
+-- Login providers are configuration now (Google, Facebook, any OpenID Connect
+-- provider), so the provider an account was created with can't be a fixed enum.
+
+-- ============================================================================
+-- USERS.AUTH_PROVIDER: ENUM -> VARCHAR
+-- ============================================================================
+
+ALTER TABLE users ALTER COLUMN auth_provider DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN auth_provider TYPE VARCHAR(50) USING auth_provider::text;
+ALTER TABLE users ALTER COLUMN auth_provider SET DEFAULT 'email';
+
+DROP TYPE auth_provider;
+
+COMMENT ON COLUMN users.auth_provider IS 'How the account was created: email or a login provider name (see user_identities for linked logins)';
@@ -0,0 +1,31 @@
+-- OAuth PKCE, Nonce and Code Handoff
+-- Every authorization request gets a PKCE verifier and a nonce, kept server-side
+-- until the provider calls back. After login the frontend receives a one-time
+-- exchange code (verification_tokens, purpose 'oauth_exchange') instead of tokens
+-- in the redirect URL.
+
+-- ============================================================================
+-- OAUTH FLOWS TABLE
+-- ============================================================================
+
+CREATE TABLE oauth_flows (
+    id BIGSERIAL PRIMARY KEY,
+    state_hash CHAR(64) NOT NULL UNIQUE,
+    provider VARCHAR(50) NOT NULL,
+    purpose VARCHAR(10) NOT NULL CHECK (purpose IN ('login', 'link')),
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    code_verifier VARCHAR(128) NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    -- Link flows are bound to the user who started them
+    CONSTRAINT link_flow_has_user CHECK (purpose <> 'link' OR user_id IS NOT NULL)
+);
+
+CREATE INDEX idx_oauth_flows_expires ON oauth_flows(expires_at);
+
+COMMENT ON TABLE oauth_flows IS 'Pending OAuth authorization requests, deleted when the callback arrives';
+COMMENT ON COLUMN oauth_flows.state_hash IS 'SHA-256 of the state parameter';
+COMMENT ON COLUMN oauth_flows.code_verifier IS 'PKCE verifier; only its S256 challenge is sent to the provider';
@@ -0,0 +1,28 @@
+-- Guest Accounts and Watchlists
+-- Guests (auth_provider 'guest') get a placeholder email and no password. They can
+-- keep a watchlist and rate movies; upgrading fills in real credentials in place,
+-- so everything created as a guest stays with the account.
+
+-- ============================================================================
+-- WATCHLIST TABLE
+-- ============================================================================
+
+CREATE TABLE watchlist_items (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    movie_id BIGINT NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT unique_watchlist_movie UNIQUE(user_id, movie_id)
+);
+
+CREATE INDEX idx_watchlist_items_user ON watchlist_items(user_id, created_at DESC);
+
+COMMENT ON TABLE watchlist_items IS 'Movies users want to watch';
+
+-- ============================================================================
+-- GUEST PURGE
+-- ============================================================================
+
+-- Stale guests are found by age; keeps the purge off a full users scan
+CREATE INDEX idx_users_guests ON users(created_at) WHERE auth_provider = 'guest';
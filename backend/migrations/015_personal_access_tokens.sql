@@ -0,0 +1,28 @@
+-- Personal Access Tokens
+-- Long-lived, scoped tokens for scripts and integrations. Accepted by the API only on
+-- route groups that declare a scope; everything else still needs a login session.
+
+-- ============================================================================
+-- PERSONAL ACCESS TOKENS TABLE
+-- ============================================================================
+
+CREATE TABLE personal_access_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    token_prefix VARCHAR(16) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    scopes JSONB NOT NULL DEFAULT '[]',
+
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    last_used_ip VARCHAR(45),
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_personal_access_tokens_user ON personal_access_tokens(user_id) WHERE revoked_at IS NULL;
+
+COMMENT ON TABLE personal_access_tokens IS 'User-created API tokens, stored by SHA-256 digest only';
+COMMENT ON COLUMN personal_access_tokens.token_prefix IS 'Leading characters of the token, shown in the token list';
+COMMENT ON COLUMN personal_access_tokens.scopes IS 'JSON array of scopes, e.g. ["reviews:read", "lists:write"]';
@@ -0,0 +1,91 @@
+-- Account Deletion and Data Export
+-- Users can download their data and delete their account. Deletion waits out a
+-- grace period, then the account is anonymized or removed; reviews and comments
+-- are removed or kept under a "deleted user" depending on configuration.
+-- Deleting a user row no longer silently takes their reviews and comments along.
+
+-- ============================================================================
+-- ACCOUNT STATUS
+-- ============================================================================
+
+-- Anonymized accounts keep their row (and content) but can't be used
+ALTER TYPE account_status ADD VALUE IF NOT EXISTS 'deleted';
+
+-- ============================================================================
+-- SCHEDULED DELETION
+-- ============================================================================
+
+ALTER TABLE users ADD COLUMN deletion_scheduled_at TIMESTAMPTZ;
+
+CREATE INDEX idx_users_deletion_scheduled ON users(deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
+
+COMMENT ON COLUMN users.deletion_scheduled_at IS 'Account is deleted at this time unless the user cancels; NULL = not scheduled';
+
+-- ============================================================================
+-- DELETED USER PLACEHOLDER
+-- ============================================================================
+
+-- Content kept from hard-deleted accounts is reattributed to this account.
+-- It collects many reviews per movie, so it is left out of the one-review-per-movie rule.
+-- The account is found by its email and 'system' provider, never by username: someone may
+-- have registered 'deleted_user' before it was reserved, then the placeholder gets a suffix.
+DO $$
+DECLARE
+    placeholder_id BIGINT;
+    placeholder_name TEXT := 'deleted_user';
+BEGIN
+    IF EXISTS (SELECT 1 FROM users WHERE username = placeholder_name) THEN
+        placeholder_name := placeholder_name || '_' || substr(md5(random()::text), 1, 8);
+    END IF;
+
+    INSERT INTO users (username, email, auth_provider, status)
+    VALUES (placeholder_name, 'deleted-user@filmfolk.invalid', 'system', 'active')
+    ON CONFLICT (email) DO NOTHING;
+
+    SELECT id INTO STRICT placeholder_id
+    FROM users
+    WHERE email = 'deleted-user@filmfolk.invalid' AND auth_provider = 'system';
+
+    ALTER TABLE reviews DROP CONSTRAINT unique_user_movie_review;
+    EXECUTE format(
+        'CREATE UNIQUE INDEX unique_user_movie_review ON reviews(user_id, movie_id) WHERE user_id <> %s',
+        placeholder_id
+    );
+END $$;
+
+-- ============================================================================
+-- NO SILENT CASCADE FOR CONTENT
+-- ============================================================================
+
+-- Reviews and comments must be removed or reattributed before their author is deleted
+ALTER TABLE reviews DROP CONSTRAINT reviews_user_id_fkey;
+ALTER TABLE reviews ADD CONSTRAINT reviews_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT;
+
+ALTER TABLE review_comments DROP CONSTRAINT review_comments_user_id_fkey;
+ALTER TABLE review_comments ADD CONSTRAINT review_comments_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT;
+
+-- ============================================================================
+-- DATA EXPORTS TABLE
+-- ============================================================================
+
+CREATE TABLE data_exports (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    file_path TEXT,
+    size_bytes BIGINT,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ,
+    downloaded_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_data_exports_user ON data_exports(user_id, created_at DESC);
+CREATE INDEX idx_data_exports_pending ON data_exports(created_at) WHERE status IN ('pending', 'processing');
+
+COMMENT ON TABLE data_exports IS 'Personal data archives, built in the background and downloadable once';
+COMMENT ON COLUMN data_exports.status IS 'pending, processing, ready, downloaded, failed or expired';
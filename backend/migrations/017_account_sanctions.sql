@@ -0,0 +1,40 @@
+-- Account Sanctions
+-- Admins can suspend a user until a given time or ban them outright, with a reason
+-- the user gets to see. Suspensions lift themselves when they run out. Every
+-- sanction and reinstatement is kept in a history table.
+
+-- ============================================================================
+-- CURRENT SANCTION ON THE USER
+-- ============================================================================
+
+ALTER TABLE users ADD COLUMN status_reason TEXT;
+ALTER TABLE users ADD COLUMN suspended_until TIMESTAMPTZ;
+
+CREATE INDEX idx_users_suspended_until ON users(suspended_until) WHERE status = 'suspended';
+
+COMMENT ON COLUMN users.status_reason IS 'Why the account is suspended or banned, shown to the user';
+COMMENT ON COLUMN users.suspended_until IS 'Suspension is lifted at this time; NULL for bans and active accounts';
+
+-- ============================================================================
+-- SANCTIONS HISTORY TABLE
+-- ============================================================================
+
+CREATE TABLE account_sanctions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    action VARCHAR(20) NOT NULL,
+    reason TEXT,
+    ends_at TIMESTAMPTZ,
+
+    -- NULL when the system acted, e.g. a suspension ran out
+    actor_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT valid_sanction_action CHECK (action IN ('suspend', 'ban', 'reinstate', 'expire'))
+);
+
+CREATE INDEX idx_account_sanctions_user ON account_sanctions(user_id, created_at DESC);
+
+COMMENT ON TABLE account_sanctions IS 'History of suspensions, bans and reinstatements';
+COMMENT ON COLUMN account_sanctions.action IS 'suspend, ban, reinstate (by an admin) or expire (suspension ran out)';
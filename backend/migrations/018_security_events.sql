@@ -0,0 +1,48 @@
+-- Security Audit Log
+-- Logins, failed logins, refreshes, logouts, provider links, password and role changes,
+-- with the IP, user agent and request ID they came from.
+-- Entries are never edited. They only go away together with the account they belong to.
+
+-- ============================================================================
+-- SECURITY EVENTS TABLE
+-- ============================================================================
+
+CREATE TABLE security_events (
+    id BIGSERIAL PRIMARY KEY,
+
+    -- NULL for failed logins with an unknown email
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    -- Who acted, when it isn't the user themselves (e.g. an admin changing a role)
+    actor_id BIGINT,
+
+    event_type VARCHAR(50) NOT NULL,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    request_id VARCHAR(100),
+    details JSONB NOT NULL DEFAULT '{}',
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_security_events_user ON security_events(user_id, created_at DESC);
+CREATE INDEX idx_security_events_type ON security_events(event_type, created_at DESC);
+CREATE INDEX idx_security_events_ip ON security_events(ip_address, created_at DESC);
+CREATE INDEX idx_security_events_created ON security_events(created_at DESC);
+
+COMMENT ON TABLE security_events IS 'Append-only security audit log';
+COMMENT ON COLUMN security_events.actor_id IS 'User who performed the action if not the user themselves; not a foreign key so the entry outlives them';
+COMMENT ON COLUMN security_events.details IS 'Event specific data, e.g. the failure reason or the old and new role';
+
+-- ============================================================================
+-- APPEND-ONLY
+-- ============================================================================
+
+CREATE OR REPLACE FUNCTION reject_security_event_update()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'security_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER reject_security_event_update BEFORE UPDATE ON security_events
+    FOR EACH ROW EXECUTE FUNCTION reject_security_event_update();
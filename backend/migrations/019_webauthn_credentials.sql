@@ -0,0 +1,62 @@
+-- WebAuthn Passkeys
+-- Passkeys registered by signed-in users. They sign in without a password, or answer
+-- the 2FA challenge instead of an authenticator-app code.
+-- Each ceremony's challenge is kept server-side until the browser answers it.
+
+-- ============================================================================
+-- ADD USER HANDLE TO USERS TABLE
+-- ============================================================================
+
+-- Random, so the authenticator never stores anything that identifies the user
+ALTER TABLE users ADD COLUMN webauthn_user_handle BYTEA UNIQUE;
+
+COMMENT ON COLUMN users.webauthn_user_handle IS 'WebAuthn user.id, set when the first passkey is registered';
+
+-- ============================================================================
+-- CREDENTIALS TABLE
+-- ============================================================================
+
+CREATE TABLE webauthn_credentials (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id BYTEA NOT NULL UNIQUE,
+    public_key BYTEA NOT NULL,
+    attestation_type VARCHAR(50) NOT NULL DEFAULT 'none',
+    transports JSONB NOT NULL DEFAULT '[]',
+    aaguid BYTEA,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+    backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+    name VARCHAR(100) NOT NULL,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+
+COMMENT ON TABLE webauthn_credentials IS 'Registered passkeys (WebAuthn public key credentials)';
+COMMENT ON COLUMN webauthn_credentials.sign_count IS 'Last signature counter seen; an assertion that does not raise it is refused as a possible clone';
+
+-- ============================================================================
+-- CEREMONIES TABLE
+-- ============================================================================
+
+CREATE TABLE webauthn_ceremonies (
+    id BIGSERIAL PRIMARY KEY,
+    challenge_hash CHAR(64) NOT NULL UNIQUE,
+    purpose VARCHAR(20) NOT NULL CHECK (purpose IN ('register', 'login', 'second_factor')),
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    session_data JSONB NOT NULL,
+
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    -- Only passwordless login starts without knowing the user
+    CONSTRAINT ceremony_has_user CHECK (purpose = 'login' OR user_id IS NOT NULL)
+);
+
+CREATE INDEX idx_webauthn_ceremonies_expires ON webauthn_ceremonies(expires_at);
+
+COMMENT ON TABLE webauthn_ceremonies IS 'Pending WebAuthn challenges, deleted when the browser answers';
+COMMENT ON COLUMN webauthn_ceremonies.challenge_hash IS 'SHA-256 of the challenge; the answer carries the challenge so no extra handle is needed';
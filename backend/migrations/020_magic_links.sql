@@ -0,0 +1,33 @@
+-- Magic-Link Login
+-- Single-use sign-in links sent by email. A link is bound to the browser that asked
+-- for it; opening it anywhere else needs an extra confirmation.
+-- Every request is stored, also for unknown addresses, so throttling per email
+-- doesn't reveal which addresses have an account.
+
+-- ============================================================================
+-- MAGIC LINKS TABLE
+-- ============================================================================
+
+CREATE TABLE magic_links (
+    id BIGSERIAL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    -- NULL until the account exists; the account is looked up by email when the link is used
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    device_hash CHAR(64) NOT NULL,
+
+    -- The browser that asked for the link, shown when it's opened somewhere else
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_magic_links_email ON magic_links(LOWER(email), created_at DESC);
+CREATE INDEX idx_magic_links_created ON magic_links(created_at);
+
+COMMENT ON TABLE magic_links IS 'Emailed sign-in links, stored as SHA-256 digests';
+COMMENT ON COLUMN magic_links.device_hash IS 'SHA-256 of the device token given to the requesting browser';
+COMMENT ON COLUMN magic_links.used_at IS 'Set when the link signs in or a newer link replaces it';
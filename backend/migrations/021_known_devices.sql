@@ -0,0 +1,29 @@
+-- New-Device Login Alerts
+-- Every user agent + IP combination a user has signed in from. A sign-in from a
+-- combination not seen before mails the owner, with a "this wasn't me" link that
+-- signs the account out everywhere.
+
+-- ============================================================================
+-- KNOWN DEVICES TABLE
+-- ============================================================================
+
+CREATE TABLE known_devices (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_hash CHAR(64) NOT NULL,
+    user_agent TEXT,
+    ip_address VARCHAR(45),
+
+    -- "This wasn't me" link from the alert mail, cleared once used
+    report_token_hash CHAR(64) UNIQUE,
+    report_expires_at TIMESTAMPTZ,
+
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT known_devices_user_device UNIQUE (user_id, device_hash)
+);
+
+COMMENT ON TABLE known_devices IS 'User agent + IP combinations each user has signed in from';
+COMMENT ON COLUMN known_devices.device_hash IS 'SHA-256 of user agent and IP address';
+COMMENT ON COLUMN known_devices.report_token_hash IS 'SHA-256 of the token in the new-device alert mail';
@@ -0,0 +1,30 @@
+-- Email Address Change
+-- A new address is confirmed from a link sent to it before it replaces the old one.
+-- The old address gets a notice with a cancel link, which also undoes a change that
+-- was already confirmed (and logs out every session) while the link is valid.
+
+-- ============================================================================
+-- EMAIL CHANGES TABLE
+-- ============================================================================
+
+CREATE TABLE email_changes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_email VARCHAR(255) NOT NULL,
+    new_email VARCHAR(255) NOT NULL,
+    confirm_token_hash CHAR(64) NOT NULL UNIQUE,
+    cancel_token_hash CHAR(64) NOT NULL UNIQUE,
+
+    expires_at TIMESTAMPTZ NOT NULL,
+    confirmed_at TIMESTAMPTZ,
+    cancelled_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- At most one change waiting for confirmation per user
+CREATE UNIQUE INDEX idx_email_changes_pending ON email_changes(user_id)
+    WHERE confirmed_at IS NULL AND cancelled_at IS NULL;
+
+COMMENT ON TABLE email_changes IS 'Requested email address changes, tokens stored as SHA-256 digests';
+COMMENT ON COLUMN email_changes.confirm_token_hash IS 'Link sent to the new address';
+COMMENT ON COLUMN email_changes.cancel_token_hash IS 'Link sent to the old address; undoes the change until expires_at';